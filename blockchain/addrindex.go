@@ -0,0 +1,191 @@
+package blockchain
+
+import (
+	"encoding/binary"
+
+	badger "github.com/dgraph-io/badger/v3"
+	"main.go/codec"
+)
+
+// AddrIndexName names the optional index of the outputs received and spent by each
+// PubKeyHash, see EnableIndex
+const AddrIndexName = "addrindex"
+
+// Directions of an address index entry. The inputs of a transaction come before its outputs
+const (
+	Spent    = byte(0)
+	Received = byte(1)
+)
+
+// addrIndexPrefix keys the entries of a PubKeyHash, ordered as the best chain:
+// PubKeyHash, height and position of the transaction in its block as 8 and 4 bytes
+// big endian, direction and the output or input index as 4 bytes big endian.
+// addrOutPrefix keys the PubKeyHash and value of an indexed output, by outpoint, so
+// the input spending it can be indexed
+var (
+	addrIndexPrefix = []byte("ai-")
+	addrOutPrefix   = []byte("ao-")
+)
+
+// AddressEntry is an output received or spent by a PubKeyHash in the best chain.
+// Balance is the PubKeyHash's balance after the entry
+type AddressEntry struct {
+	Height    int
+	TxID      []byte
+	Direction byte
+	Index     int
+	Amount    int
+	Balance   int
+}
+
+func addrEntryKey(pubKeyHash []byte, height, pos int, direction byte, index int) []byte {
+	var h [8]byte
+	var p, i [4]byte
+	binary.BigEndian.PutUint64(h[:], uint64(height))
+	binary.BigEndian.PutUint32(p[:], uint32(pos))
+	binary.BigEndian.PutUint32(i[:], uint32(index))
+	key := append(append([]byte{}, addrIndexPrefix...), pubKeyHash...)
+	key = append(append(key, h[:]...), p[:]...)
+	return append(append(key, direction), i[:]...)
+}
+
+func addrEntryValue(txid []byte, amount int) []byte {
+	w := codec.NewRawWriter()
+	w.Bytes(txid)
+	w.Varint(int64(amount))
+	return w.Data()
+}
+
+// readAddrOut returns the PubKeyHash and value of an indexed output
+func readAddrOut(txn *badger.Txn, txid []byte, vout int) ([]byte, int, error) {
+	value, err := getValue(txn, addrOutPrefix, OutpointItem(txid, vout))
+	if err != nil {
+		return nil, 0, err
+	}
+	r := codec.NewRawReader(value)
+	pubKeyHash := r.Bytes()
+	amount := r.Int()
+	return pubKeyHash, amount, r.Done()
+}
+
+var addrIndex = &chainIndex{
+	name:     AddrIndexName,
+	prefixes: [][]byte{addrIndexPrefix, addrOutPrefix},
+	connect: func(txn *badger.Txn, block *Block) error {
+		for pos, tx := range block.Transactions {
+			if !tx.IsCoinbaseTxn() {
+				for i, in := range tx.Vin {
+					pubKeyHash, amount, err := readAddrOut(txn, in.TXID, in.Vout)
+					if err == badger.ErrKeyNotFound {
+						continue
+					}
+					if err != nil {
+						return err
+					}
+					key := addrEntryKey(pubKeyHash, block.Height, pos, Spent, i)
+					if err := txn.Set(key, addrEntryValue(tx.ID, amount)); err != nil {
+						return err
+					}
+				}
+			}
+			for vout, out := range tx.Vout {
+				if out.IsData() || len(out.PubKeyHash) == 0 {
+					continue
+				}
+				key := addrEntryKey(out.PubKeyHash, block.Height, pos, Received, vout)
+				if err := txn.Set(key, addrEntryValue(tx.ID, out.Value)); err != nil {
+					return err
+				}
+				w := codec.NewRawWriter()
+				w.Bytes(out.PubKeyHash)
+				w.Varint(int64(out.Value))
+				outKey := append(append([]byte{}, addrOutPrefix...), OutpointItem(tx.ID, vout)...)
+				if err := txn.Set(outKey, w.Data()); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	},
+	// outputs are removed after the inputs of later transactions in the block spending them
+	disconnect: func(txn *badger.Txn, block *Block) error {
+		for pos := len(block.Transactions) - 1; pos >= 0; pos-- {
+			tx := block.Transactions[pos]
+			for vout, out := range tx.Vout {
+				if out.IsData() || len(out.PubKeyHash) == 0 {
+					continue
+				}
+				if err := txn.Delete(addrEntryKey(out.PubKeyHash, block.Height, pos, Received, vout)); err != nil {
+					return err
+				}
+				outKey := append(append([]byte{}, addrOutPrefix...), OutpointItem(tx.ID, vout)...)
+				if err := txn.Delete(outKey); err != nil {
+					return err
+				}
+			}
+			if tx.IsCoinbaseTxn() {
+				continue
+			}
+			for i, in := range tx.Vin {
+				pubKeyHash, _, err := readAddrOut(txn, in.TXID, in.Vout)
+				if err == badger.ErrKeyNotFound {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if err := txn.Delete(addrEntryKey(pubKeyHash, block.Height, pos, Spent, i)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	},
+}
+
+// AddressHistory returns up to count entries of pubKeyHash after the first skip, oldest
+// first, and the number of entries. A count of 0 returns all entries after skip
+func (chain *BlockChain) AddressHistory(pubKeyHash []byte, skip, count int) ([]AddressEntry, int, error) {
+	var entries []AddressEntry
+	total, balance := 0, 0
+	prefix := append(append([]byte{}, addrIndexPrefix...), pubKeyHash...)
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := it.Item().KeyCopy(nil)[len(prefix):]
+			if len(key) != 8+4+1+4 {
+				continue
+			}
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			r := codec.NewRawReader(value)
+			entry := AddressEntry{
+				Height:    int(binary.BigEndian.Uint64(key[:8])),
+				TxID:      r.Bytes(),
+				Direction: key[12],
+				Index:     int(binary.BigEndian.Uint32(key[13:])),
+				Amount:    r.Int(),
+			}
+			if err := r.Done(); err != nil {
+				return err
+			}
+			if entry.Direction == Spent {
+				balance -= entry.Amount
+			} else {
+				balance += entry.Amount
+			}
+			entry.Balance = balance
+			if total >= skip && (count == 0 || len(entries) < count) {
+				entries = append(entries, entry)
+			}
+			total++
+		}
+		return nil
+	})
+	return entries, total, err
+}
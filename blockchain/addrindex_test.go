@@ -0,0 +1,88 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"main.go/wallet"
+)
+
+type wantEntry struct {
+	height    int
+	txid      []byte
+	direction byte
+	amount    int
+	balance   int
+}
+
+func checkHistory(t *testing.T, chain *BlockChain, pubKeyHash []byte, want ...wantEntry) {
+	t.Helper()
+	entries, total, err := chain.AddressHistory(pubKeyHash, 0, 0)
+	if err != nil || total != len(want) || len(entries) != len(want) {
+		t.Fatalf("%d of %d entries, %v, want %d", len(entries), total, err, len(want))
+	}
+	for i, entry := range entries {
+		e := want[i]
+		if entry.Height != e.height || !bytes.Equal(entry.TxID, e.txid) || entry.Direction != e.direction ||
+			entry.Amount != e.amount || entry.Balance != e.balance {
+			t.Errorf("entry %d is %+v, want %+v", i, entry, e)
+		}
+	}
+}
+
+// The payment's entries move to the height of the block mining it again, and the
+// disconnected block's coinbase leaves the miner's history
+func TestAddrIndexReorg(t *testing.T) {
+	f := newReorg(t, AddrIndexName)
+	genesis, err := f.chain.GetBlock(f.genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funding := genesis.Transactions[0].ID
+	paid := f.payment.ID
+	payer, payee := wallet.PubKeyHash(f.payer.PubKey), wallet.PubKeyHash(f.payee.PubKey)
+	miner := wallet.AddressHash(f.miner)
+
+	checkHistory(t, f.chain, payer,
+		wantEntry{0, funding, Received, 50, 50},
+		wantEntry{1, paid, Spent, 50, 0},
+		wantEntry{1, paid, Received, 30, 30})
+	checkHistory(t, f.chain, payee, wantEntry{1, paid, Received, 20, 20})
+	checkHistory(t, f.chain, miner, wantEntry{1, f.a1.Transactions[0].ID, Received, 50, 50})
+
+	f.reorg()
+	if !f.chain.IndexInSync(AddrIndexName) {
+		t.Fatal("address index not in sync after the reorg")
+	}
+	checkHistory(t, f.chain, payer,
+		wantEntry{0, funding, Received, 50, 50},
+		wantEntry{2, paid, Spent, 50, 0},
+		wantEntry{2, paid, Received, 30, 30})
+	checkHistory(t, f.chain, payee, wantEntry{2, paid, Received, 20, 20})
+	checkHistory(t, f.chain, miner,
+		wantEntry{1, f.b1.Transactions[0].ID, Received, 50, 50},
+		wantEntry{2, f.b2.Transactions[0].ID, Received, 50, 100})
+	checkRebuilt(t, f.chain, AddrIndexName, addrIndexPrefix, addrOutPrefix)
+}
+
+// Pages keep the balance of the whole history
+func TestAddressHistoryPages(t *testing.T) {
+	f := newReorg(t, AddrIndexName)
+	payer := wallet.PubKeyHash(f.payer.PubKey)
+	entries, total, err := f.chain.AddressHistory(payer, 1, 1)
+	if err != nil || total != 3 || len(entries) != 1 {
+		t.Fatalf("%d of %d entries, %v, want 1 of 3", len(entries), total, err)
+	}
+	if entries[0].Direction != Spent || entries[0].Balance != 0 {
+		t.Errorf("second entry is %+v, want the spend down to 0", entries[0])
+	}
+	if entries, _, _ := f.chain.AddressHistory(payer, 2, 0); len(entries) != 1 || entries[0].Balance != 30 {
+		t.Errorf("entries after 2: %+v, want the change at balance 30", entries)
+	}
+	if entries, total, _ := f.chain.AddressHistory(payer, 5, 10); len(entries) != 0 || total != 3 {
+		t.Errorf("entries after 5: %d of %d", len(entries), total)
+	}
+	if entries, total, _ := f.chain.AddressHistory(wallet.PubKeyHash(wallet.MakeWallet().PubKey), 0, 0); len(entries) != 0 || total != 0 {
+		t.Errorf("unused address has %d entries", total)
+	}
+}
@@ -3,20 +3,20 @@ package blockchain
 import (
 	// "crypto/sha256"
 	"bytes"
-	"encoding/gob"
 	"log"
 	"time"
+
+	"main.go/codec"
 )
 
 // Module describing Blocks
 
 type Block struct {
-	PrevHash     []byte
+	BlockHeader
 	Transactions []*Transaction
 	Hash         []byte
-	Nonce        int
-	Timestamp    int64
-	Height       int
+	// Not part of the header: a block's height is its parent's plus one
+	Height int
 }
 
 // Method to derive hash of block
@@ -28,7 +28,14 @@ type Block struct {
 // }
 
 func CreateBlock(txs []*Transaction, prevHash []byte, height int) *Block {
-	block := &Block{prevHash, txs, []byte{}, 0, time.Now().Unix(), height}
+	header := BlockHeader{
+		Version:   BlockVersion,
+		PrevHash:  prevHash,
+		Timestamp: time.Now().Unix(),
+		Bits:      DIFFICULTY_BITS,
+	}
+	block := &Block{header, txs, []byte{}, height}
+	block.MerkleRoot = block.HashTransactions()
 	pow := ComputeTargetForBlock(block)
 	nonce, hash := pow.RunPOW()
 	block.Nonce = nonce
@@ -49,35 +56,27 @@ func (block *Block) HashTransactions() []byte{
 	}
 	// data := bytes.Join(txHashes, []byte{})
 	// txHash = sha256.Sum256(data ) 
-	tree := NewMerkleTree(txHashes)
+	tree := NewMerkleTreeVersion(txHashes, MerkleVersion(block.Version))
 	return tree.RootNode.Data
 }
 
-func (b *Block) Serialize() []byte {
-	// to uses gobs, create an encoder and present it with a series of data
-	// Create bytes buffer, for storing data streams
-	buff := new(bytes.Buffer)
-
-	// Create an encoder, to encode buffer containing bytes streams for transfer
-	encoder := gob.NewEncoder(buff)
-
-	//  Encode the data to the sent, also transmits the data
-	err := encoder.Encode(b)
-	HandleErr(err)
+// CheckMerkleRoot reports whether the header commits to the block's transactions
+func (block *Block) CheckMerkleRoot() bool {
+	return bytes.Equal(block.MerkleRoot, block.HashTransactions())
+}
 
-	return buff.Bytes()
+// Serialize returns the canonical encoding of the block, see docs/serialization.md
+func (b *Block) Serialize() []byte {
+	w := codec.NewWriter()
+	b.encode(w)
+	return w.Data()
 }
 
 func Deserialize(data []byte) *Block {
-	var block Block
-
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-
-	err := decoder.Decode(&block)
-
+	block, err := parseStoredBlock(data)
 	HandleErr(err)
 
-	return &block
+	return block
 }
 
 func HandleErr(err error) {
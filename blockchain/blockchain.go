@@ -3,7 +3,6 @@ package blockchain
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"encoding/gob"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -37,6 +36,12 @@ func DBexist(path string) bool {
 	}
 	return true
 }
+
+// ChainExists reports whether the node has a blockchain database
+func ChainExists(nodeId string) bool {
+	return DBexist(fmt.Sprintf(dbPath, nodeId))
+}
+
 func InitializeBlockchain(address, nodeId string) *BlockChain {
 	var lastHash []byte
 	path := fmt.Sprintf(dbPath, nodeId)
@@ -44,13 +49,17 @@ func InitializeBlockchain(address, nodeId string) *BlockChain {
 		fmt.Printf("Blockchain exist\n")
 		runtime.Goexit()
 	}
-	opts := badger.DefaultOptions(dbPath)
+	opts := badger.DefaultOptions(path)
 	db, err := openDB(path, opts)
 	HandleErr(err)
 	err = db.Update(func(txn *badger.Txn) error {
 		coinbaseTrx := CoinbaseTx(address, genesisData)
 		genesis := CreateGenesisBlock(coinbaseTrx)
-		err = txn.Set(genesis.Hash, genesis.Serialize())
+		err = putBlock(txn, genesis)
+		HandleErr(err)
+		err = initIndexes(txn)
+		HandleErr(err)
+		err = setTip(txn, nil, genesis.Hash)
 		HandleErr(err)
 		err = txn.Set([]byte("lh"), genesis.Hash)
 		lastHash = genesis.Hash
@@ -96,7 +105,7 @@ func ContinueBlockchain(nodeId string) *BlockChain {
 		fmt.Printf("No Blockchain found\n")
 		runtime.Goexit()
 	}
-	opts := badger.DefaultOptions(dbPath)
+	opts := badger.DefaultOptions(path)
 	db, err := openDB(path, opts)
 	HandleErr(err)
 	err = db.View(func(txn *badger.Txn) error {
@@ -117,20 +126,27 @@ func ContinueBlockchain(nodeId string) *BlockChain {
 func (chain *BlockChain) AddBlock(block *Block){
 	var lastHash []byte
 	var lastBlock *Block
+	if err := chain.CheckBlock(block); err != nil{
+		log.Printf("Rejected block %x: %s\n", block.Hash, err)
+		return
+	}
+	if err := chain.CheckBlockLocks(block); err != nil{
+		log.Printf("Rejected block %x: %s\n", block.Hash, err)
+		return
+	}
 	err := chain.Database.Update(func(txn *badger.Txn) error{
 		if _, err := txn.Get(block.Hash); err == nil{
 			return nil
 		}
 
-		blockData := block.Serialize()
-		err := txn.Set(block.Hash, blockData)
+		err := putBlock(txn, block)
 		HandleErr(err)
 	
 
 		item, err := txn.Get([]byte("lh"))
 		HandleErr(err)
 		_ = item.Value(func(val []byte) error{
-			lastHash = val
+			lastHash = append([]byte{}, val...)
 			return  nil
 		})
 		// HandleErr(err)
@@ -144,6 +160,8 @@ func (chain *BlockChain) AddBlock(block *Block){
 		if block.Height > lastBlock.Height{
 			err = txn.Set([]byte("lh"), block.Hash)
 			HandleErr(err)
+			err = setTip(txn, lastHash, block.Hash)
+			HandleErr(err)
 			chain.LastHash = block.Hash
 		}
 		return nil
@@ -152,6 +170,76 @@ func (chain *BlockChain) AddBlock(block *Block){
 	HandleErr(err)
 }
 
+// CheckBlock checks the proof of work of the header, that the header commits to the
+// transactions, which must not repeat and must pass CheckInBlock for the block's version,
+// and, when the parent is known, the height
+func (chain *BlockChain) CheckBlock(block *Block) error{
+	if !ComputeTargetForBlock(block).ValidatePOW(){
+		return errors.New("invalid proof of work")
+	}
+	if len(block.Transactions) == 0{
+		return errors.New("block has no transactions")
+	}
+	seen := make(map[string]bool)
+	for _, tx := range block.Transactions{
+		txHash := hex.EncodeToString(tx.HashTx())
+		if seen[txHash]{
+			return fmt.Errorf("duplicate transaction %x", tx.ID)
+		}
+		seen[txHash] = true
+		if err := tx.CheckInBlock(block.Version); err != nil{
+			return fmt.Errorf("transaction %x: %v", tx.ID, err)
+		}
+	}
+	if !block.CheckMerkleRoot(){
+		return errors.New("merkle root does not match the transactions")
+	}
+	if block.Version == 0{
+		if err := chain.checkLegacyVersion(block); err != nil{
+			return err
+		}
+	}
+	if len(block.PrevHash) == 0{
+		if block.Height != 0{
+			return errors.New("genesis block must have height 0")
+		}
+		return nil
+	}
+	if _, parentHeight, err := chain.GetHeader(block.PrevHash); err == nil && block.Height != parentHeight+1{
+		return fmt.Errorf("height %d does not follow parent height %d", block.Height, parentHeight)
+	}
+	return nil
+}
+
+// checkLegacyVersion rejects a version 0 block above the height where the chain moved to
+// versioned headers. The proof of work of version 0 blocks does not cover their timestamp,
+// so they are only accepted where the chain still has them: their parent, when known, and
+// the best chain block at their height, or the tip below it, must be version 0 too.
+// Blocks read from legacy storage are not checked
+func (chain *BlockChain) checkLegacyVersion(block *Block) error{
+	if len(block.PrevHash) > 0{
+		if parent, _, err := chain.GetHeader(block.PrevHash); err == nil && parent.Version != 0{
+			return fmt.Errorf("version 0 block on top of a version %d block", parent.Version)
+		}
+	}
+	height := block.Height
+	if best := chain.GetBestHeight(); height > best{
+		height = best
+	}
+	hash, err := chain.GetBlockHash(height)
+	if err != nil{
+		return err
+	}
+	header, _, err := chain.GetHeader(hash)
+	if err != nil{
+		return err
+	}
+	if header.Version != 0{
+		return fmt.Errorf("version 0 block at height %d, where the chain has version %d blocks", block.Height, header.Version)
+	}
+	return nil
+}
+
 func (chain *BlockChain)MineBlock(transaction []*Transaction) *Block{
 	var lastHash []byte
 	var lastHeight int
@@ -167,7 +255,7 @@ func (chain *BlockChain)MineBlock(transaction []*Transaction) *Block{
 		item, err := txn.Get([]byte("lh"))
 		HandleErr(err)
 		err = item.Value(func(val []byte) error {
-			lastHash = val
+			lastHash = append([]byte{}, val...)
 			return nil
 		})
 		item, err = txn.Get(lastHash)
@@ -182,9 +270,14 @@ func (chain *BlockChain)MineBlock(transaction []*Transaction) *Block{
 	HandleErr(err)
 
 	newBlock := CreateBlock(transaction, lastHash, lastHeight+1)
+	if err := chain.CheckBlockLocks(newBlock); err != nil{
+		log.Panic(err)
+	}
 
 	err = chain.Database.Update(func(txn *badger.Txn) error {
-		err := txn.Set(newBlock.Hash, newBlock.Serialize())
+		err := putBlock(txn, newBlock)
+		HandleErr(err)
+		err = setTip(txn, lastHash, newBlock.Hash)
 		HandleErr(err)
 		err = txn.Set([]byte("lh"), newBlock.Hash)
 		chain.LastHash = newBlock.Hash
@@ -256,6 +349,23 @@ func (chain *BlockChain) GetBestHeight() int{
 	return lastBlock.Height
 }
 
+// UsedPubKeyHashes returns the PubKeyHash of every output in the best chain, as strings
+func (chain *BlockChain) UsedPubKeyHashes() map[string]bool {
+	used := make(map[string]bool)
+	iter := chain.Iterator()
+	for len(iter.CurrentHash) > 0 {
+		block := iter.Next()
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Vout {
+				if !out.IsData() {
+					used[string(out.PubKeyHash)] = true
+				}
+			}
+		}
+	}
+	return used
+}
+
 func (chain *BlockChain) FindUTXO() map[string]OutputsArr{
 	// var unspentTxs []Transaction
 	UTXO := make(map[string]OutputsArr)
@@ -268,6 +378,9 @@ func (chain *BlockChain) FindUTXO() map[string]OutputsArr{
 			txID := hex.EncodeToString(tx.ID)
 		Outputs:
 			for outIdx, out := range tx.Vout {
+				if out.IsData() {
+					continue
+				}
 				if spentTXOs[txID] != nil {
 					for _, spentOut := range spentTXOs[txID] {
 						if spentOut == outIdx {
@@ -276,7 +389,7 @@ func (chain *BlockChain) FindUTXO() map[string]OutputsArr{
 					}
 				}
 				outs := UTXO[txID]
-				outs.Outputs = append(outs.Outputs, out)
+				outs.Add(outIdx, out)
 				UTXO[txID] = outs
 			}
 			if !tx.IsCoinbaseTxn() {
@@ -298,13 +411,55 @@ func (chain *BlockChain) FindUTXO() map[string]OutputsArr{
 
 
 func (chain *BlockChain) FindTrxById(ID []byte) (Transaction, error) {
+	tx, _, err := chain.FindTrxBlock(ID)
+	return tx, err
+}
+
+// FindTrxBlock returns a transaction together with the block it was mined in
+func (chain *BlockChain) FindTrxBlock(ID []byte) (Transaction, *Block, error) {
+	if chain.IndexInSync(TxIndexName) {
+		blockHash, pos, found := chain.LookupTx(ID)
+		if !found {
+			return Transaction{}, nil, errors.New("Transaction does not exist ")
+		}
+		block, err := chain.GetBlock(blockHash)
+		if err != nil {
+			return Transaction{}, nil, err
+		}
+		return *block.Transactions[pos], &block, nil
+	}
 	iter := chain.Iterator()
 	for {
 		block := iter.Next()
 
 		for _, tx := range block.Transactions {
 			if bytes.Compare(tx.ID, ID) == 0 {
-				return *tx, nil
+				return *tx, block, nil
+			}
+		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	return Transaction{}, nil, errors.New("Transaction does not exist ")
+}
+
+// FindSpendingTrx returns the transaction spending output vout of transaction ID, if it has been mined
+func (chain *BlockChain) FindSpendingTrx(ID []byte, vout int) (Transaction, bool) {
+	iter := chain.Iterator()
+	for {
+		block := iter.Next()
+
+		for _, tx := range block.Transactions {
+			if tx.IsCoinbaseTxn() {
+				continue
+			}
+			for _, in := range tx.Vin {
+				if bytes.Equal(in.TXID, ID) && in.Vout == vout {
+					return *tx, true
+				}
 			}
 		}
 
@@ -312,11 +467,36 @@ func (chain *BlockChain) FindTrxById(ID []byte) (Transaction, error) {
 			break
 		}
 	}
+	return Transaction{}, false
+}
+
+// FindDataOutput returns the first mined transaction with a data output holding data, and its block
+func (chain *BlockChain) FindDataOutput(data []byte) (Transaction, *Block, bool) {
+	iter := chain.Iterator()
+	for {
+		block := iter.Next()
+
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Vout {
+				if out.IsData() && bytes.Equal(out.Data, data) {
+					return *tx, block, true
+				}
+			}
+		}
 
-	return Transaction{}, errors.New("Transaction does not exist ")
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	return Transaction{}, nil, false
 }
 
 func (chain *BlockChain) SignTrx(tx *Transaction, privKey ecdsa.PrivateKey) {
+	chain.SignTrxWithType(tx, privKey, SigHashAll)
+}
+
+// SignTrxWithType signs tx under a chosen signature hash type, see SignatureHash
+func (chain *BlockChain) SignTrxWithType(tx *Transaction, privKey ecdsa.PrivateKey, hashType byte) {
 	prevTxs := make(map[string]Transaction)
 
 	for _, in := range tx.Vin {
@@ -324,13 +504,16 @@ func (chain *BlockChain) SignTrx(tx *Transaction, privKey ecdsa.PrivateKey) {
 		HandleErr(err)
 		prevTxs[hex.EncodeToString(prevTx.ID)] = prevTx
 	}
-	tx.Sign(privKey, prevTxs)
+	tx.SignWithType(privKey, prevTxs, hashType)
 }
 
 func (chain *BlockChain) VerifyTx(tx *Transaction) bool {
 	if tx.IsCoinbaseTxn(){
 		return true
 	}
+	if err := tx.CheckSanity(); err != nil{
+		return false
+	}
 	prevTxs := make(map[string]Transaction)
 
 	for _, in := range tx.Vin {
@@ -342,9 +525,7 @@ func (chain *BlockChain) VerifyTx(tx *Transaction) bool {
 }
 
 func DeserializeTrx(data []byte) Transaction{
-	var transaction Transaction
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-	err := decoder.Decode(&transaction)
+	transaction, err := ParseTrx(data)
 	HandleErr(err)
 	return transaction
 }
\ No newline at end of file
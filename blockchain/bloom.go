@@ -0,0 +1,152 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// Limits and update flags of BIP37 Bloom filters
+const (
+	MaxBloomFilterSize = 36000
+	MaxBloomHashFuncs  = 50
+
+	// BloomUpdateNone never changes the filter while matching
+	BloomUpdateNone = 0
+	// BloomUpdateAll adds the outpoint of every output whose PubKeyHash matches,
+	// so later spends of it match too
+	BloomUpdateAll = 1
+)
+
+// BloomFilter is a BIP37 Bloom filter a thin client loads into a peer, so the peer
+// relays and serves only the transactions it may care about
+type BloomFilter struct {
+	Filter    []byte
+	HashFuncs uint32
+	Tweak     uint32
+	Flags     byte
+}
+
+// NewBloomFilter sizes a filter for elements items at a false positive rate of fpRate
+func NewBloomFilter(elements int, fpRate float64, tweak uint32, flags byte) *BloomFilter {
+	if elements < 1 {
+		elements = 1
+	}
+	sizeBits := -1 / (math.Ln2 * math.Ln2) * float64(elements) * math.Log(fpRate)
+	size := int(math.Min(sizeBits, MaxBloomFilterSize*8)) / 8
+	if size < 1 {
+		size = 1
+	}
+	hashFuncs := uint32(float64(size*8) / float64(elements) * math.Ln2)
+	if hashFuncs > MaxBloomHashFuncs {
+		hashFuncs = MaxBloomHashFuncs
+	}
+	if hashFuncs < 1 {
+		hashFuncs = 1
+	}
+	return &BloomFilter{
+		Filter:    make([]byte, size),
+		HashFuncs: hashFuncs,
+		Tweak:     tweak,
+		Flags:     flags,
+	}
+}
+
+// Validate checks the limits of a filter sent by a peer
+func (bf *BloomFilter) Validate() error {
+	if len(bf.Filter) == 0 || len(bf.Filter) > MaxBloomFilterSize {
+		return errors.New("bloom filter size out of range")
+	}
+	if bf.HashFuncs == 0 || bf.HashFuncs > MaxBloomHashFuncs {
+		return errors.New("too many bloom filter hash functions")
+	}
+	if bf.Flags > BloomUpdateAll {
+		return errors.New("unknown bloom filter flags")
+	}
+	return nil
+}
+
+// murmur3 is MurmurHash3 x86 32 bit
+func murmur3(seed uint32, data []byte) uint32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+	h := seed
+	length := len(data)
+	for ; len(data) >= 4; data = data[4:] {
+		k := binary.LittleEndian.Uint32(data)
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+	var k uint32
+	switch len(data) {
+	case 3:
+		k ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(data[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+	h ^= uint32(length)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+func (bf *BloomFilter) bit(i uint32, data []byte) uint32 {
+	return murmur3(i*0xfba4c795+bf.Tweak, data) % uint32(len(bf.Filter)*8)
+}
+
+func (bf *BloomFilter) Add(data []byte) {
+	for i := uint32(0); i < bf.HashFuncs; i++ {
+		idx := bf.bit(i, data)
+		bf.Filter[idx/8] |= 1 << (idx % 8)
+	}
+}
+
+func (bf *BloomFilter) Contains(data []byte) bool {
+	for i := uint32(0); i < bf.HashFuncs; i++ {
+		idx := bf.bit(i, data)
+		if bf.Filter[idx/8]&(1<<(idx%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchTx reports whether tx may interest the filter's owner: its ID, the PubKeyHash
+// of one of its outputs or an outpoint it spends is in the filter.
+// With BloomUpdateAll, the outpoints of matching outputs are added to the filter
+func (bf *BloomFilter) MatchTx(tx *Transaction) bool {
+	match := bf.Contains(tx.ID)
+	for vout, out := range tx.Vout {
+		if out.IsData() || len(out.PubKeyHash) == 0 || !bf.Contains(out.PubKeyHash) {
+			continue
+		}
+		match = true
+		if bf.Flags == BloomUpdateAll {
+			bf.Add(OutpointItem(tx.ID, vout))
+		}
+	}
+	if match || tx.IsCoinbaseTxn() {
+		return match
+	}
+	for _, in := range tx.Vin {
+		if bf.Contains(OutpointItem(in.TXID, in.Vout)) {
+			return true
+		}
+	}
+	return false
+}
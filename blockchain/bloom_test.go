@@ -0,0 +1,128 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// The MurmurHash3 vectors BIP37 implementations are checked against
+func TestMurmur3Vectors(t *testing.T) {
+	tests := []struct {
+		want uint32
+		seed uint32
+		data string
+	}{
+		{0x00000000, 0x00000000, ""},
+		{0x6a396f08, 0xfba4c795, ""},
+		{0x81f16f39, 0xffffffff, ""},
+		{0x514e28b7, 0x00000000, "00"},
+		{0xea3f0b17, 0xfba4c795, "00"},
+		{0xfd6cf10d, 0x00000000, "ff"},
+		{0x16c6b7ab, 0x00000000, "0011"},
+		{0x8eb51c3d, 0x00000000, "001122"},
+		{0xb4471bf8, 0x00000000, "00112233"},
+		{0xe2301fa8, 0x00000000, "0011223344"},
+		{0xfc2e4a15, 0x00000000, "001122334455"},
+		{0xb074502c, 0x00000000, "00112233445566"},
+		{0x8034d2a0, 0x00000000, "0011223344556677"},
+		{0xb4698def, 0x00000000, "001122334455667788"},
+	}
+	for _, test := range tests {
+		data, _ := hex.DecodeString(test.data)
+		if got := murmur3(test.seed, data); got != test.want {
+			t.Errorf("murmur3(%#x, %s) = %#x, want %#x", test.seed, test.data, got, test.want)
+		}
+	}
+}
+
+// The filters of BIP37's reference tests: 3 elements at 1% false positives
+func TestBloomFilterVectors(t *testing.T) {
+	tests := []struct {
+		tweak  uint32
+		filter string
+	}{
+		{0, "614e9b"},
+		{2147483649, "ce4299"},
+	}
+	for _, test := range tests {
+		bf := NewBloomFilter(3, 0.01, test.tweak, BloomUpdateAll)
+		first, _ := hex.DecodeString("99108ad8ed9bb6274d3980bab5a85c048f0950c8")
+		bf.Add(first)
+		if !bf.Contains(first) {
+			t.Errorf("tweak %d: added item not contained", test.tweak)
+		}
+		other, _ := hex.DecodeString("19108ad8ed9bb6274d3980bab5a85c048f0950c8")
+		if bf.Contains(other) {
+			t.Errorf("tweak %d: item differing in one byte contained", test.tweak)
+		}
+		for _, item := range []string{"b5a2c786d9ef4658287ced5914b37a1b4aa32eee", "b9300670b4c5366e95b2699e8b18bc75e5f729c5"} {
+			data, _ := hex.DecodeString(item)
+			bf.Add(data)
+		}
+		if got := hex.EncodeToString(bf.Filter); got != test.filter || bf.HashFuncs != 5 {
+			t.Errorf("tweak %d: filter %s with %d hash functions, want %s with 5", test.tweak, got, bf.HashFuncs, test.filter)
+		}
+		if err := bf.Validate(); err != nil {
+			t.Errorf("tweak %d: %v", test.tweak, err)
+		}
+	}
+}
+
+func TestBloomFilterValidate(t *testing.T) {
+	tests := map[string]BloomFilter{
+		"empty":         {HashFuncs: 1},
+		"too large":     {Filter: make([]byte, MaxBloomFilterSize+1), HashFuncs: 1},
+		"no hashes":     {Filter: []byte{0}},
+		"too many":      {Filter: []byte{0}, HashFuncs: MaxBloomHashFuncs + 1},
+		"unknown flags": {Filter: []byte{0}, HashFuncs: 1, Flags: BloomUpdateAll + 1},
+	}
+	for name, bf := range tests {
+		if bf.Validate() == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+	if bf := NewBloomFilter(1000000, 0.0001, 0, BloomUpdateNone); bf.Validate() != nil {
+		t.Errorf("filter sized by NewBloomFilter rejected: %d bytes, %d hashes", len(bf.Filter), bf.HashFuncs)
+	}
+}
+
+// A payment matches by its output, and with BloomUpdateAll the spend of that output
+// matches by outpoint without the owner adding it
+func TestBloomFilterMatchTx(t *testing.T) {
+	pubKeyHash := bytes.Repeat([]byte{0xaa}, 20)
+	payment, _ := fundingTx(TxOutputs{Value: 10, PubKeyHash: pubKeyHash})
+	spend := spendTx(payment, TxInputs{}, 0)
+	unrelated, _ := fundingTx(TxOutputs{Value: 10, PubKeyHash: bytes.Repeat([]byte{0xbb}, 20)})
+
+	for _, flags := range []byte{BloomUpdateNone, BloomUpdateAll} {
+		bf := NewBloomFilter(10, 0.0001, 7, flags)
+		bf.Add(pubKeyHash)
+		if !bf.MatchTx(payment) {
+			t.Errorf("flags %d: payment to the filtered hash not matched", flags)
+		}
+		if bf.MatchTx(unrelated) {
+			t.Errorf("flags %d: unrelated transaction matched", flags)
+		}
+		if got := bf.MatchTx(spend); got != (flags == BloomUpdateAll) {
+			t.Errorf("flags %d: spend of the payment matched = %v", flags, got)
+		}
+	}
+
+	bf := NewBloomFilter(10, 0.0001, 7, BloomUpdateNone)
+	bf.Add(unrelated.ID)
+	if !bf.MatchTx(unrelated) {
+		t.Error("transaction not matched by its ID")
+	}
+	bf.Add(OutpointItem(payment.ID, 0))
+	if !bf.MatchTx(spend) {
+		t.Error("spend not matched by its outpoint")
+	}
+
+	data := &Transaction{Vin: spend.Vin, Vout: []TxOutputs{*NewDataOutput(pubKeyHash)}, Version: TxVersion}
+	bf = NewBloomFilter(10, 0.0001, 7, BloomUpdateNone)
+	bf.Add(pubKeyHash)
+	if bf.MatchTx(data) {
+		t.Error("data output matched as a payment")
+	}
+}
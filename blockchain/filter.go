@@ -0,0 +1,182 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+// filterPrefix keys the serialized compact filter of a block, filterHeaderPrefix its filter header
+var (
+	filterPrefix       = []byte("cf-")
+	filterHeaderPrefix = []byte("cfh-")
+)
+
+// FilterKey is the SipHash key of a block's filter: the first 16 bytes of the block hash
+func FilterKey(blockHash []byte) [16]byte {
+	var key [16]byte
+	copy(key[:], blockHash)
+	return key
+}
+
+// OutpointItem is the filter item of an outpoint: the transaction ID and the
+// output index as 4 bytes big endian
+func OutpointItem(txid []byte, vout int) []byte {
+	var index [4]byte
+	binary.BigEndian.PutUint32(index[:], uint32(vout))
+	return append(append([]byte{}, txid...), index[:]...)
+}
+
+// FilterItems lists what a block's filter holds: the PubKeyHash of every output that is not
+// data, and the outpoint spent by every input that is not a coinbase
+func (block *Block) FilterItems() [][]byte {
+	var items [][]byte
+	for _, tx := range block.Transactions {
+		for _, out := range tx.Vout {
+			if !out.IsData() && len(out.PubKeyHash) > 0 {
+				items = append(items, out.PubKeyHash)
+			}
+		}
+		if tx.IsCoinbaseTxn() {
+			continue
+		}
+		for _, in := range tx.Vin {
+			items = append(items, OutpointItem(in.TXID, in.Vout))
+		}
+	}
+	return items
+}
+
+func (block *Block) Filter() *GCSFilter {
+	return NewGCSFilter(FilterKey(block.Hash), block.FilterItems())
+}
+
+// NextFilterHeader chains filter headers: sha256(sha256(filter) || previous header).
+// The previous header of the genesis block is 32 zero bytes
+func NextFilterHeader(filter []byte, prevHeader []byte) []byte {
+	filterHash := sha256.Sum256(filter)
+	return nextFilterHeaderFromHash(filterHash[:], prevHeader)
+}
+
+func nextFilterHeaderFromHash(filterHash []byte, prevHeader []byte) []byte {
+	if len(prevHeader) == 0 {
+		prevHeader = make([]byte, 32)
+	}
+	header := sha256.Sum256(append(append([]byte{}, filterHash...), prevHeader...))
+	return header[:]
+}
+
+func getValue(txn *badger.Txn, prefix, hash []byte) ([]byte, error) {
+	item, err := txn.Get(append(append([]byte{}, prefix...), hash...))
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+// putFilter stores the filter and filter header of block. Blocks stored before filters
+// existed get theirs first, walking back to the nearest block that has one
+func putFilter(txn *badger.Txn, block *Block) error {
+	pending := []*Block{block}
+	for prevHash := block.PrevHash; len(prevHash) > 0; {
+		if _, err := getValue(txn, filterHeaderPrefix, prevHash); err == nil {
+			break
+		}
+		item, err := txn.Get(prevHash)
+		if err != nil {
+			// the parent is not stored, its filter header cannot be known
+			return nil
+		}
+		data, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		parent, err := parseStoredBlock(data)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, parent)
+		prevHash = parent.PrevHash
+	}
+	for i := len(pending) - 1; i >= 0; i-- {
+		b := pending[i]
+		var prevHeader []byte
+		if len(b.PrevHash) > 0 {
+			header, err := getValue(txn, filterHeaderPrefix, b.PrevHash)
+			if err != nil {
+				return err
+			}
+			prevHeader = header
+		}
+		filter := b.Filter().Serialize()
+		if err := txn.Set(append(append([]byte{}, filterPrefix...), b.Hash...), filter); err != nil {
+			return err
+		}
+		header := NextFilterHeader(filter, prevHeader)
+		if err := txn.Set(append(append([]byte{}, filterHeaderPrefix...), b.Hash...), header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFilter(db *badger.DB, blockHash []byte) ([]byte, []byte, error) {
+	var filter, header []byte
+	err := db.View(func(txn *badger.Txn) error {
+		var err error
+		if filter, err = getValue(txn, filterPrefix, blockHash); err != nil {
+			return err
+		}
+		header, err = getValue(txn, filterHeaderPrefix, blockHash)
+		return err
+	})
+	return filter, header, err
+}
+
+// GetFilter returns the serialized filter and the filter header of the block with blockHash
+func (chain *BlockChain) GetFilter(blockHash []byte) ([]byte, []byte, error) {
+	filter, header, err := readFilter(chain.Database, blockHash)
+	if err != badger.ErrKeyNotFound {
+		return filter, header, err
+	}
+	// a block stored before filters existed
+	block, err := chain.GetBlock(blockHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = chain.Database.Update(func(txn *badger.Txn) error {
+		return putFilter(txn, &block)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return readFilter(chain.Database, blockHash)
+}
+
+// GetFilterHashes returns the filter header of the block with hash since (nil for an empty since)
+// and the filter hashes of up to max best chain blocks after it, lowest first
+func (chain *BlockChain) GetFilterHashes(since []byte, max int) ([]byte, [][]byte, error) {
+	var prevHeader []byte
+	if len(since) > 0 {
+		_, header, err := chain.GetFilter(since)
+		if err != nil {
+			return nil, nil, err
+		}
+		prevHeader = header
+	}
+	var hashes [][]byte
+	for _, header := range chain.GetHeaders(since, max) {
+		filter, _, err := chain.GetFilter(header.Hash())
+		if err != nil {
+			return nil, nil, err
+		}
+		hash := sha256.Sum256(filter)
+		hashes = append(hashes, hash[:])
+	}
+	if len(since) > 0 && len(hashes) == 0 && !chain.IsInBestChain(since) {
+		return nil, nil, errors.New("block is not in the best chain")
+	}
+	return prevHeader, hashes, nil
+}
@@ -0,0 +1,239 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"sort"
+
+	"main.go/codec"
+)
+
+// Golomb coded set parameters of BIP158 basic filters: false positive rate 1/M,
+// remainders of P bits
+const (
+	GCSP = 19
+	GCSM = 784931
+)
+
+// GCSFilter is a compact probabilistic set. Items are hashed with SipHash-2-4 into [0, N*M),
+// sorted, and the differences between neighbours written with Golomb-Rice coding
+type GCSFilter struct {
+	N    int
+	Data []byte
+	key  [16]byte
+}
+
+func sipRound(v0, v1, v2, v3 uint64) (uint64, uint64, uint64, uint64) {
+	v0 += v1
+	v1 = bits.RotateLeft64(v1, 13) ^ v0
+	v0 = bits.RotateLeft64(v0, 32)
+	v2 += v3
+	v3 = bits.RotateLeft64(v3, 16) ^ v2
+	v0 += v3
+	v3 = bits.RotateLeft64(v3, 21) ^ v0
+	v2 += v1
+	v1 = bits.RotateLeft64(v1, 17) ^ v2
+	v2 = bits.RotateLeft64(v2, 32)
+	return v0, v1, v2, v3
+}
+
+// sipHash is SipHash-2-4 of data under a 16 byte key
+func sipHash(key [16]byte, data []byte) uint64 {
+	k0 := binary.LittleEndian.Uint64(key[:8])
+	k1 := binary.LittleEndian.Uint64(key[8:])
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+
+	length := len(data)
+	for ; len(data) >= 8; data = data[8:] {
+		m := binary.LittleEndian.Uint64(data)
+		v3 ^= m
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0 ^= m
+	}
+	var last [8]byte
+	copy(last[:], data)
+	last[7] = byte(length)
+	m := binary.LittleEndian.Uint64(last[:])
+	v3 ^= m
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0 ^= m
+
+	v2 ^= 0xff
+	for i := 0; i < 4; i++ {
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	}
+	return v0 ^ v1 ^ v2 ^ v3
+}
+
+// hashedSet maps items into [0, n*M) and sorts them
+func hashedSet(key [16]byte, n int, items [][]byte) []uint64 {
+	f := uint64(n) * GCSM
+	var values []uint64
+	for _, item := range items {
+		hi, _ := bits.Mul64(sipHash(key, item), f)
+		values = append(values, hi)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values
+}
+
+type bitWriter struct {
+	data []byte
+	used uint
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.used%8 == 0 {
+		w.data = append(w.data, 0)
+	}
+	if bit {
+		w.data[len(w.data)-1] |= 0x80 >> (w.used % 8)
+	}
+	w.used++
+}
+
+type bitReader struct {
+	data []byte
+	used uint
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.used/8 >= uint(len(r.data)) {
+		return false, errors.New("filter ends early")
+	}
+	bit := r.data[r.used/8]&(0x80>>(r.used%8)) != 0
+	r.used++
+	return bit, nil
+}
+
+// NewGCSFilter builds the filter of the distinct items under key
+func NewGCSFilter(key [16]byte, items [][]byte) *GCSFilter {
+	seen := make(map[string]bool)
+	var distinct [][]byte
+	for _, item := range items {
+		if !seen[string(item)] {
+			seen[string(item)] = true
+			distinct = append(distinct, item)
+		}
+	}
+	filter := &GCSFilter{N: len(distinct), key: key}
+	var w bitWriter
+	var last uint64
+	for _, value := range hashedSet(key, filter.N, distinct) {
+		delta := value - last
+		last = value
+		for q := delta >> GCSP; q > 0; q-- {
+			w.writeBit(true)
+		}
+		w.writeBit(false)
+		for i := GCSP - 1; i >= 0; i-- {
+			w.writeBit(delta&(1<<uint(i)) != 0)
+		}
+	}
+	filter.Data = w.data
+	return filter
+}
+
+// values decodes the sorted hashed items
+func (f *GCSFilter) values() ([]uint64, error) {
+	values, _, err := f.decode()
+	return values, err
+}
+
+func (f *GCSFilter) bitsUsed() (uint, error) {
+	_, used, err := f.decode()
+	return used, err
+}
+
+func (f *GCSFilter) decode() ([]uint64, uint, error) {
+	r := bitReader{data: f.Data}
+	var values []uint64
+	var last uint64
+	for i := 0; i < f.N; i++ {
+		var q uint64
+		for {
+			bit, err := r.readBit()
+			if err != nil {
+				return nil, 0, err
+			}
+			if !bit {
+				break
+			}
+			q++
+		}
+		delta := q << GCSP
+		for j := GCSP - 1; j >= 0; j-- {
+			bit, err := r.readBit()
+			if err != nil {
+				return nil, 0, err
+			}
+			if bit {
+				delta |= 1 << uint(j)
+			}
+		}
+		last += delta
+		values = append(values, last)
+	}
+	return values, r.used, nil
+}
+
+// MatchAny reports whether any of items may be in the filter. False positives happen
+// about once in M items, false negatives never
+func (f *GCSFilter) MatchAny(items [][]byte) (bool, error) {
+	if f.N == 0 || len(items) == 0 {
+		return false, nil
+	}
+	values, err := f.values()
+	if err != nil {
+		return false, err
+	}
+	wanted := hashedSet(f.key, f.N, items)
+	for i, j := 0, 0; i < len(values) && j < len(wanted); {
+		switch {
+		case values[i] == wanted[j]:
+			return true, nil
+		case values[i] < wanted[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return false, nil
+}
+
+// Serialize writes N as a varint followed by the Golomb-Rice bits, padded to a byte
+func (f *GCSFilter) Serialize() []byte {
+	w := codec.NewRawWriter()
+	w.Uvarint(uint64(f.N))
+	return append(w.Data(), f.Data...)
+}
+
+// DeserializeGCSFilter reads a filter built under key. The bits must decode to exactly N items
+func DeserializeGCSFilter(key [16]byte, data []byte) (*GCSFilter, error) {
+	n, size := binary.Uvarint(data)
+	if size <= 0 {
+		return nil, codec.ErrShortRead
+	}
+	if n > uint64(len(data))*8 {
+		return nil, errors.New("filter holds more items than bits")
+	}
+	filter := &GCSFilter{N: int(n), Data: data[size:], key: key}
+	if !bytes.Equal(filter.Serialize(), data) {
+		return nil, codec.ErrNonCanonical
+	}
+	used, err := filter.bitsUsed()
+	if err != nil {
+		return nil, err
+	}
+	if (used+7)/8 != uint(len(filter.Data)) {
+		return nil, codec.ErrTrailingData
+	}
+	return filter, nil
+}
@@ -0,0 +1,99 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"main.go/codec"
+)
+
+// The SipHash-2-4 vectors of the SipHash paper, key 000102..0f
+func TestSipHashVectors(t *testing.T) {
+	var key [16]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	message := make([]byte, 15)
+	for i := range message {
+		message[i] = byte(i)
+	}
+	if got := sipHash(key, nil); got != 0x726fdb47dd0e0e31 {
+		t.Errorf("empty message: %#x", got)
+	}
+	if got := sipHash(key, message); got != 0xa129ca6149be45e5 {
+		t.Errorf("message 00..0e: %#x", got)
+	}
+}
+
+func TestGCSVectors(t *testing.T) {
+	// testnet genesis block, whose basic filter holds its coinbase output script
+	genesisHash, _ := hex.DecodeString("43497fd7f826957108f4a30fd9cec3aeba79972084e90ead01ea330900000000")
+	genesisScript, _ := hex.DecodeString("4104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac")
+
+	var key [16]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	var tenItems [][]byte
+	for i := 1; i <= 10; i++ {
+		tenItems = append(tenItems, bytes.Repeat([]byte{byte(i)}, 20))
+	}
+	repeated := bytes.Repeat([]byte{'x'}, 20)
+
+	tests := []struct {
+		name  string
+		key   [16]byte
+		items [][]byte
+		want  string
+	}{
+		{"BIP158 testnet genesis", FilterKey(genesisHash), [][]byte{genesisScript}, "019dfca8"},
+		{"no items", key, nil, "00"},
+		{"ten items", key, tenItems, "0af11af5d38eb4b7098c15b9f1d2451f415b8fd7ca6f1f9501603b"},
+		{"repeated item", key, [][]byte{repeated, repeated, repeated}, "0100f960"},
+	}
+	for _, test := range tests {
+		filter := NewGCSFilter(test.key, test.items)
+		data := filter.Serialize()
+		if got := hex.EncodeToString(data); got != test.want {
+			t.Errorf("%s: filter %s, want %s", test.name, got, test.want)
+			continue
+		}
+		parsed, err := DeserializeGCSFilter(test.key, data)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		for _, item := range test.items {
+			if match, err := parsed.MatchAny([][]byte{item}); err != nil || !match {
+				t.Errorf("%s: item %x not matched: %v", test.name, item, err)
+			}
+		}
+		if match, _ := parsed.MatchAny([][]byte{[]byte("not an item")}); match {
+			t.Errorf("%s: matched an item it does not hold", test.name)
+		}
+	}
+}
+
+func TestDeserializeGCSFilterRejects(t *testing.T) {
+	var key [16]byte
+	valid, _ := hex.DecodeString("0af11af5d38eb4b7098c15b9f1d2451f415b8fd7ca6f1f9501603b")
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"empty", nil, codec.ErrShortRead},
+		{"trailing byte", append(append([]byte{}, valid...), 0), codec.ErrTrailingData},
+		{"non-minimal count", append([]byte{0x8a, 0x00}, valid[1:]...), codec.ErrNonCanonical},
+		{"missing bits", valid[:len(valid)-2], nil},
+		{"more items than bits", []byte{0x7f, 0x00}, nil},
+	}
+	for _, test := range tests {
+		_, err := DeserializeGCSFilter(key, test.data)
+		if err == nil || (test.wantErr != nil && !errors.Is(err, test.wantErr)) {
+			t.Errorf("%s: %v, want %v", test.name, err, test.wantErr)
+		}
+	}
+}
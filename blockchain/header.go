@@ -0,0 +1,220 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/dgraph-io/badger/v3"
+	"main.go/codec"
+)
+
+// BlockVersion is the version of new blocks. Version 0 blocks were mined before headers
+// existed: their proof of work covers only PrevHash, MerkleRoot, Nonce and Bits.
+// Blocks before version 2 build their merkle tree with MerkleDuplicate, see MerkleVersion
+const BlockVersion = 2
+
+// MaxHeadersPerMessage caps how many headers are served at once
+const MaxHeadersPerMessage = 2000
+
+// headerPrefix keys a block's header and height, stored apart from the full block
+// so header only clients can be served without reading bodies
+var headerPrefix = []byte("hdr-")
+
+// BlockHeader is everything the proof of work commits to
+type BlockHeader struct {
+	Version    int
+	PrevHash   []byte
+	MerkleRoot []byte
+	Timestamp  int64
+	Bits       int
+	Nonce      int
+}
+
+// POWData returns the bytes hashed for the proof of work:
+// version, prev hash, merkle root, timestamp, bits and nonce, integers as 8 byte big endian
+func (h *BlockHeader) POWData() []byte {
+	if h.Version == 0 {
+		return bytes.Join([][]byte{
+			h.PrevHash,
+			h.MerkleRoot,
+			UtilConvertIntToByteRep(int64(h.Nonce)),
+			UtilConvertIntToByteRep(int64(h.Bits)),
+		}, []byte{})
+	}
+	return bytes.Join([][]byte{
+		UtilConvertIntToByteRep(int64(h.Version)),
+		h.PrevHash,
+		h.MerkleRoot,
+		UtilConvertIntToByteRep(h.Timestamp),
+		UtilConvertIntToByteRep(int64(h.Bits)),
+		UtilConvertIntToByteRep(int64(h.Nonce)),
+	}, []byte{})
+}
+
+// Hash is the block hash: the sha256 of POWData
+func (h *BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(h.POWData())
+	return hash[:]
+}
+
+func (h *BlockHeader) encode(w *codec.Writer) {
+	w.Uvarint(uint64(h.Version))
+	w.Bytes(h.PrevHash)
+	w.Bytes(h.MerkleRoot)
+	w.Varint(h.Timestamp)
+	w.Varint(int64(h.Bits))
+	w.Varint(int64(h.Nonce))
+}
+
+func decodeHeader(r *codec.Reader) BlockHeader {
+	var h BlockHeader
+	h.Version = int(r.Uvarint())
+	h.PrevHash = r.Bytes()
+	h.MerkleRoot = r.Bytes()
+	h.Timestamp = r.Varint()
+	h.Bits = r.Int()
+	h.Nonce = r.Int()
+	return h
+}
+
+func (h BlockHeader) Serialize() []byte {
+	w := codec.NewWriter()
+	h.encode(w)
+	return w.Data()
+}
+
+func DeserializeHeader(data []byte) (*BlockHeader, error) {
+	r, err := codec.NewReader(data)
+	if err != nil {
+		return nil, err
+	}
+	h := decodeHeader(r)
+	return &h, r.Done()
+}
+
+// ValidateHeader checks the proof of work of a header without its transactions
+func ValidateHeader(h *BlockHeader) bool {
+	pow := ComputeTargetForBlock(&Block{BlockHeader: *h, Hash: h.Hash()})
+	return pow.ValidatePOW()
+}
+
+func encodeHeaderEntry(h *BlockHeader, height int) []byte {
+	w := codec.NewWriter()
+	h.encode(w)
+	w.Varint(int64(height))
+	return w.Data()
+}
+
+func putHeader(txn *badger.Txn, hash []byte, h *BlockHeader, height int) error {
+	key := append(append([]byte{}, headerPrefix...), hash...)
+	return txn.Set(key, encodeHeaderEntry(h, height))
+}
+
+// putBlock stores the full block under its hash, its header under headerPrefix
+// and its compact filter under filterPrefix
+func putBlock(txn *badger.Txn, block *Block) error {
+	if err := txn.Set(block.Hash, block.Serialize()); err != nil {
+		return err
+	}
+	if err := putHeader(txn, block.Hash, &block.BlockHeader, block.Height); err != nil {
+		return err
+	}
+	return putFilter(txn, block)
+}
+
+// GetHeader returns the header and height of the block with blockHash.
+// Databases written before headers were stored separately fall back to the full block
+func (chain *BlockChain) GetHeader(blockHash []byte) (*BlockHeader, int, error) {
+	return readHeader(chain.Database, blockHash)
+}
+
+// GetHeaders returns up to max headers of the best chain following the block with hash since,
+// lowest first. An empty since starts at the genesis block
+func (chain *BlockChain) GetHeaders(since []byte, max int) []*BlockHeader {
+	return headersSince(chain.Database, chain.LastHash, since, max)
+}
+
+// IsInBestChain reports whether the block with blockHash is an ancestor of the tip, or the tip
+func (chain *BlockChain) IsInBestChain(blockHash []byte) bool {
+	return inBestChain(chain.Database, chain.LastHash, blockHash)
+}
+
+func readHeader(db *badger.DB, blockHash []byte) (*BlockHeader, int, error) {
+	var header BlockHeader
+	var height int
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(append(append([]byte{}, headerPrefix...), blockHash...))
+		if err == badger.ErrKeyNotFound {
+			item, err = txn.Get(blockHash)
+			if err != nil {
+				return errors.New("no header found")
+			}
+			return item.Value(func(val []byte) error {
+				block, err := parseStoredBlock(val)
+				if err != nil {
+					return err
+				}
+				header, height = block.BlockHeader, block.Height
+				return nil
+			})
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			r, err := codec.NewReader(val)
+			if err != nil {
+				return err
+			}
+			header = decodeHeader(r)
+			height = r.Int()
+			return r.Done()
+		})
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return &header, height, nil
+}
+
+func headersSince(db *badger.DB, tip, since []byte, max int) []*BlockHeader {
+	var headers []*BlockHeader
+	hash := tip
+	for len(hash) > 0 && !bytes.Equal(hash, since) {
+		header, _, err := readHeader(db, hash)
+		HandleErr(err)
+		headers = append(headers, header)
+		hash = header.PrevHash
+	}
+	if len(since) > 0 && len(hash) == 0 {
+		// since is not on the best chain
+		return nil
+	}
+	for i, j := 0, len(headers)-1; i < j; i, j = i+1, j-1 {
+		headers[i], headers[j] = headers[j], headers[i]
+	}
+	if len(headers) > max {
+		headers = headers[:max]
+	}
+	return headers
+}
+
+func inBestChain(db *badger.DB, tip, blockHash []byte) bool {
+	_, height, err := readHeader(db, blockHash)
+	if err != nil {
+		return false
+	}
+	hash := tip
+	for len(hash) > 0 {
+		header, h, err := readHeader(db, hash)
+		if err != nil || h < height {
+			return false
+		}
+		if h == height {
+			return bytes.Equal(hash, blockHash)
+		}
+		hash = header.PrevHash
+	}
+	return false
+}
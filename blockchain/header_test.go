@@ -0,0 +1,110 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"main.go/wallet"
+)
+
+func testHeader(version int) BlockHeader {
+	return BlockHeader{
+		Version:    version,
+		PrevHash:   bytes.Repeat([]byte{0x11}, 32),
+		MerkleRoot: bytes.Repeat([]byte{0x22}, 32),
+		Timestamp:  0x5f5e1000,
+		Bits:       12,
+		Nonce:      0x1234,
+	}
+}
+
+// Version 0 proof of work covers prev hash, merkle root, nonce and bits, later versions
+// cover version, prev hash, merkle root, timestamp, bits and nonce
+func TestPOWData(t *testing.T) {
+	prev, root := strings.Repeat("11", 32), strings.Repeat("22", 32)
+	tests := []struct {
+		version int
+		want    string
+	}{
+		{0, prev + root + "0000000000001234" + "000000000000000c"},
+		{2, "0000000000000002" + prev + root + "000000005f5e1000" + "000000000000000c" + "0000000000001234"},
+	}
+	for _, test := range tests {
+		header := testHeader(test.version)
+		if got := hex.EncodeToString(header.POWData()); got != test.want {
+			t.Errorf("version %d POWData:\n got %s\nwant %s", test.version, got, test.want)
+		}
+		want, _ := hex.DecodeString(test.want)
+		hash := sha256.Sum256(want)
+		if !bytes.Equal(header.Hash(), hash[:]) {
+			t.Errorf("version %d: Hash is not the sha256 of POWData", test.version)
+		}
+	}
+
+	v0, other := testHeader(0), testHeader(0)
+	other.Timestamp++
+	if !bytes.Equal(v0.Hash(), other.Hash()) {
+		t.Error("timestamp changes the hash of a version 0 header")
+	}
+	v2 := testHeader(2)
+	for name, change := range map[string]func(h *BlockHeader){
+		"timestamp": func(h *BlockHeader) { h.Timestamp++ },
+		"version":   func(h *BlockHeader) { h.Version = 3 },
+		"bits":      func(h *BlockHeader) { h.Bits++ },
+	} {
+		changed := testHeader(2)
+		change(&changed)
+		if bytes.Equal(v2.Hash(), changed.Hash()) {
+			t.Errorf("%s does not change the hash of a version 2 header", name)
+		}
+	}
+}
+
+// remine recomputes the merkle root and proof of work of block
+func remine(block *Block) {
+	block.MerkleRoot = block.HashTransactions()
+	block.Nonce, block.Hash = ComputeTargetForBlock(block).RunPOW()
+}
+
+func TestCheckBlockTxVersions(t *testing.T) {
+	chain := &BlockChain{}
+	address := string(wallet.MakeWallet().Address())
+	block := CreateGenesisBlock(CoinbaseTx(address, ""))
+	if err := chain.CheckBlock(block); err != nil {
+		t.Fatalf("version %d block: %v", block.Version, err)
+	}
+	for _, version := range []int{0, TxVersion + 1} {
+		coinbase := CoinbaseTx(address, "")
+		coinbase.Version = version
+		coinbase.ID = coinbase.IDHash()
+		block := CreateGenesisBlock(coinbase)
+		err := chain.CheckBlock(block)
+		if err == nil || !strings.Contains(err.Error(), "version") {
+			t.Errorf("version %d transaction in a version %d block: %v", version, block.Version, err)
+		}
+	}
+
+	blocks := baselineBlocks(t)
+	baseline := openBaselineChain(t)
+	var tip *Block
+	for _, block := range blocks {
+		if tip == nil || block.Height > tip.Height {
+			tip = block
+		}
+	}
+	if err := baseline.CheckBlock(tip); err != nil {
+		t.Fatalf("baseline block: %v", err)
+	}
+	coinbase := *tip.Transactions[0]
+	coinbase.Version = TxVersion
+	coinbase.ID = coinbase.IDHash()
+	tip.Transactions = []*Transaction{&coinbase}
+	remine(tip)
+	err := baseline.CheckBlock(tip)
+	if err == nil || !strings.Contains(err.Error(), "version 1 transaction in a version 0 block") {
+		t.Errorf("version %d transaction in a version 0 block: %v", TxVersion, err)
+	}
+}
@@ -0,0 +1,412 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	badger "github.com/dgraph-io/badger/v3"
+	"main.go/codec"
+)
+
+const headerDBPath = "./tmp/headers_%s"
+
+// proofPrefix keys a MerkleBlock proving a single wallet transaction, by its IDHash
+var proofPrefix = []byte("ptx-")
+
+// HeaderChain is the store of a node that follows only block headers (SPV).
+// It keeps every valid header it was sent, the tip of the chain with the most headers,
+// and the wallet transactions full peers proved to be mined
+type HeaderChain struct {
+	LastHash []byte
+	Database *badger.DB
+
+	// scanned holds blocks above the proof height the wallet was matched against,
+	// waiting for the blocks before them
+	scanned     map[string]bool
+	scannedLock sync.Mutex
+}
+
+// ProvenOutput is an output paying to the wallet whose transaction has a merkle proof
+type ProvenOutput struct {
+	TxID      []byte
+	Vout      int
+	Output    TxOutputs
+	BlockHash []byte
+	Height    int
+}
+
+func HeaderChainExists(nodeId string) bool {
+	return DBexist(fmt.Sprintf(headerDBPath, nodeId))
+}
+
+// OpenHeaderChain opens the header store of nodeId, creating an empty one if needed
+func OpenHeaderChain(nodeId string) *HeaderChain {
+	var lastHash []byte
+	path := fmt.Sprintf(headerDBPath, nodeId)
+	opts := badger.DefaultOptions(path)
+	db, err := openDB(path, opts)
+	HandleErr(err)
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("lh"))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		lastHash, err = item.ValueCopy(nil)
+		return err
+	})
+	HandleErr(err)
+	return &HeaderChain{LastHash: lastHash, Database: db, scanned: make(map[string]bool)}
+}
+
+// BestHeight is the height of the tip, -1 before any header is stored
+func (hc *HeaderChain) BestHeight() int {
+	if len(hc.LastHash) == 0 {
+		return -1
+	}
+	_, height, err := hc.GetHeader(hc.LastHash)
+	HandleErr(err)
+	return height
+}
+
+func (hc *HeaderChain) GetHeader(blockHash []byte) (*BlockHeader, int, error) {
+	return readHeader(hc.Database, blockHash)
+}
+
+func (hc *HeaderChain) IsInBestChain(blockHash []byte) bool {
+	return inBestChain(hc.Database, hc.LastHash, blockHash)
+}
+
+// Confirmations counts the block with blockHash and the blocks on top of it,
+// 0 if it is not in the best chain
+func (hc *HeaderChain) Confirmations(blockHash []byte) int {
+	if !hc.IsInBestChain(blockHash) {
+		return 0
+	}
+	_, height, err := hc.GetHeader(blockHash)
+	HandleErr(err)
+	return hc.BestHeight() - height + 1
+}
+
+// AddHeaders stores a run of linked headers, lowest first. The first one must follow a
+// stored header, or be the genesis header of an empty store. The tip moves when the run
+// ends higher than the current tip. It returns the height of the first header that was
+// not stored before, or -1 if all of them were
+func (hc *HeaderChain) AddHeaders(headers []*BlockHeader) (int, error) {
+	firstNew := -1
+	err := hc.Database.Update(func(txn *badger.Txn) error {
+		var prevHash []byte
+		prevVersion := 0
+		height := -1
+		for i, header := range headers {
+			if !ValidateHeader(header) {
+				return errors.New("invalid proof of work")
+			}
+			if i == 0 && len(header.PrevHash) > 0 {
+				prev, prevHeight, err := readHeader(hc.Database, header.PrevHash)
+				if err != nil {
+					return errors.New("headers do not connect to a known block")
+				}
+				height = prevHeight
+				prevVersion = prev.Version
+			} else if i > 0 && !bytes.Equal(header.PrevHash, prevHash) {
+				return errors.New("headers do not link up")
+			}
+			// see BlockChain.checkLegacyVersion
+			if header.Version == 0 && prevVersion != 0 {
+				return fmt.Errorf("version 0 header on top of a version %d header", prevVersion)
+			}
+			prevVersion = header.Version
+			height++
+			prevHash = header.Hash()
+
+			key := append(append([]byte{}, headerPrefix...), prevHash...)
+			if _, err := txn.Get(key); err == nil {
+				continue
+			}
+			if height == 0 && len(hc.LastHash) > 0 {
+				return errors.New("different genesis block")
+			}
+			if firstNew < 0 {
+				firstNew = height
+			}
+			if err := putHeader(txn, prevHash, header, height); err != nil {
+				return err
+			}
+		}
+		if firstNew < 0 || height <= hc.BestHeight() {
+			return nil
+		}
+		if err := txn.Set([]byte("lh"), prevHash); err != nil {
+			return err
+		}
+		hc.LastHash = prevHash
+		return nil
+	})
+	return firstNew, err
+}
+
+// ProofHeight is the height up to which every best chain block was matched against
+// the wallet and its proofs stored, -1 if none was
+func (hc *HeaderChain) ProofHeight() int {
+	height := -1
+	err := hc.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("ph"))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			r := codec.NewRawReader(val)
+			height = r.Int()
+			return r.Done()
+		})
+	})
+	HandleErr(err)
+	return height
+}
+
+func (hc *HeaderChain) SetProofHeight(height int) {
+	w := codec.NewRawWriter()
+	w.Varint(int64(height))
+	err := hc.Database.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("ph"), w.Data())
+	})
+	HandleErr(err)
+}
+
+// MarkScanned records that the wallet was matched against the block with blockHash, its
+// proofs stored if it had any, and moves the proof height over the best chain blocks
+// scanned without a gap. Blocks arrive in any order
+func (hc *HeaderChain) MarkScanned(blockHash []byte) {
+	hc.scannedLock.Lock()
+	defer hc.scannedLock.Unlock()
+	_, height, err := hc.GetHeader(blockHash)
+	proofHeight := hc.ProofHeight()
+	if err != nil || height <= proofHeight {
+		return
+	}
+	hc.scanned[string(blockHash)] = true
+	if height != proofHeight+1 {
+		return
+	}
+	var since []byte
+	if proofHeight >= 0 {
+		since, err = hc.HashAtHeight(proofHeight)
+		HandleErr(err)
+	}
+	for {
+		hashes := hc.BlocksAfter(since, MaxHeadersPerMessage)
+		n := 0
+		for n < len(hashes) && hc.scanned[string(hashes[n])] {
+			delete(hc.scanned, string(hashes[n]))
+			n++
+		}
+		proofHeight += n
+		if n == 0 || n < len(hashes) {
+			break
+		}
+		since = hashes[n-1]
+	}
+	hc.SetProofHeight(proofHeight)
+}
+
+// AddProof verifies mb and stores a proof for each of its transactions under its IDHash,
+// which Verify checked to be its ID. The block's header must already be stored
+func (hc *HeaderChain) AddProof(mb *MerkleBlock) error {
+	if err := mb.Verify(); err != nil {
+		return err
+	}
+	blockHash := mb.Header.Hash()
+	if _, height, err := hc.GetHeader(blockHash); err != nil {
+		return fmt.Errorf("unknown block %x", blockHash)
+	} else if height != mb.Height {
+		return fmt.Errorf("block %x is at height %d, not %d", blockHash, height, mb.Height)
+	}
+	return hc.Database.Update(func(txn *badger.Txn) error {
+		for i := range mb.Txs {
+			single := MerkleBlock{mb.Header, mb.Height, mb.Txs[i : i+1], mb.Proofs[i : i+1]}
+			key := append(append([]byte{}, proofPrefix...), mb.Txs[i].IDHash()...)
+			if err := txn.Set(key, single.Serialize()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Proofs returns the stored proofs whose block is in the best chain
+func (hc *HeaderChain) Proofs() []*MerkleBlock {
+	var proofs []*MerkleBlock
+	err := hc.Database.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+		for iter.Seek(proofPrefix); iter.ValidForPrefix(proofPrefix); iter.Next() {
+			value, err := iter.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			mb, err := DeserializeMerkleBlock(value)
+			if err != nil {
+				return err
+			}
+			proofs = append(proofs, mb)
+		}
+		return nil
+	})
+	HandleErr(err)
+
+	var best []*MerkleBlock
+	for _, mb := range proofs {
+		if hc.IsInBestChain(mb.Header.Hash()) {
+			best = append(best, mb)
+		}
+	}
+	return best
+}
+
+// UnspentOutputs returns the outputs locked to pubKeyHash that no proven transaction spends.
+// Outputs are named by the IDHash of their transaction, never by the ID it carries
+func (hc *HeaderChain) UnspentOutputs(pubKeyHash []byte) []ProvenOutput {
+	proofs := hc.Proofs()
+	spent := make(map[string]bool)
+	for _, mb := range proofs {
+		for _, in := range mb.Txs[0].Vin {
+			spent[fmt.Sprintf("%x:%d", in.TXID, in.Vout)] = true
+		}
+	}
+	var unspent []ProvenOutput
+	for _, mb := range proofs {
+		tx := mb.Txs[0]
+		id := tx.IDHash()
+		for vout, out := range tx.Vout {
+			if out.IsData() || !out.IsLockedWithKey(pubKeyHash) || spent[fmt.Sprintf("%x:%d", id, vout)] {
+				continue
+			}
+			unspent = append(unspent, ProvenOutput{id, vout, out, mb.Header.Hash(), mb.Height})
+		}
+	}
+	return unspent
+}
+
+// FilterHeader returns the stored filter header of the block with blockHash
+func (hc *HeaderChain) FilterHeader(blockHash []byte) ([]byte, error) {
+	var header []byte
+	err := hc.Database.View(func(txn *badger.Txn) error {
+		var err error
+		header, err = getValue(txn, filterHeaderPrefix, blockHash)
+		return err
+	})
+	return header, err
+}
+
+// AddFilterHashes extends the filter header chain from the block with hash since, whose
+// filter header must be prevHeader, over the best chain blocks after it.
+// It returns the hashes of the blocks that got a filter header
+func (hc *HeaderChain) AddFilterHashes(since, prevHeader []byte, filterHashes [][]byte) ([][]byte, error) {
+	if len(since) > 0 {
+		stored, err := hc.FilterHeader(since)
+		if err != nil {
+			return nil, fmt.Errorf("no filter header for block %x", since)
+		}
+		if !bytes.Equal(stored, prevHeader) {
+			return nil, errors.New("filter headers do not connect")
+		}
+	} else if len(prevHeader) > 0 {
+		return nil, errors.New("filter headers do not start at genesis")
+	}
+	for _, hash := range filterHashes {
+		if len(hash) != 32 {
+			return nil, errors.New("filter hash is not 32 bytes")
+		}
+	}
+	headers := headersSince(hc.Database, hc.LastHash, since, len(filterHashes))
+	var blockHashes [][]byte
+	err := hc.Database.Update(func(txn *badger.Txn) error {
+		for i, header := range headers {
+			prevHeader = nextFilterHeaderFromHash(filterHashes[i], prevHeader)
+			blockHash := header.Hash()
+			key := append(append([]byte{}, filterHeaderPrefix...), blockHash...)
+			if err := txn.Set(key, prevHeader); err != nil {
+				return err
+			}
+			blockHashes = append(blockHashes, blockHash)
+		}
+		return nil
+	})
+	return blockHashes, err
+}
+
+// CheckFilter checks a serialized filter against the filter headers of its block and the block's parent
+func (hc *HeaderChain) CheckFilter(blockHash, filter []byte) error {
+	header, _, err := hc.GetHeader(blockHash)
+	if err != nil {
+		return fmt.Errorf("unknown block %x", blockHash)
+	}
+	stored, err := hc.FilterHeader(blockHash)
+	if err != nil {
+		return fmt.Errorf("no filter header for block %x", blockHash)
+	}
+	var prevHeader []byte
+	if len(header.PrevHash) > 0 {
+		if prevHeader, err = hc.FilterHeader(header.PrevHash); err != nil {
+			return fmt.Errorf("no filter header for block %x", header.PrevHash)
+		}
+	}
+	if !bytes.Equal(NextFilterHeader(filter, prevHeader), stored) {
+		return errors.New("filter does not match its filter header")
+	}
+	return nil
+}
+
+// BlocksAfter returns the hashes of up to max best chain blocks after the one with hash since
+func (hc *HeaderChain) BlocksAfter(since []byte, max int) [][]byte {
+	var hashes [][]byte
+	for _, header := range headersSince(hc.Database, hc.LastHash, since, max) {
+		hashes = append(hashes, header.Hash())
+	}
+	return hashes
+}
+
+// HashAtHeight returns the hash of the best chain block at height
+func (hc *HeaderChain) HashAtHeight(height int) ([]byte, error) {
+	hash := hc.LastHash
+	for len(hash) > 0 {
+		header, h, err := hc.GetHeader(hash)
+		if err != nil {
+			return nil, err
+		}
+		if h == height {
+			return hash, nil
+		}
+		hash = header.PrevHash
+	}
+	return nil, fmt.Errorf("no block at height %d", height)
+}
+
+// WalletItems lists the filter items a wallet watches: its pubkey hashes and the outpoints
+// of proven outputs paying to them, whose spends carry no pubkey hash
+func (hc *HeaderChain) WalletItems(pubKeyHashes [][]byte) [][]byte {
+	items := append([][]byte{}, pubKeyHashes...)
+	for _, hash := range pubKeyHashes {
+		for _, out := range hc.UnspentOutputs(hash) {
+			items = append(items, OutpointItem(out.TxID, out.Vout))
+		}
+	}
+	return items
+}
+
+// HasProof reports whether a proof of the transaction with ID is stored
+func (hc *HeaderChain) HasProof(ID []byte) bool {
+	err := hc.Database.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(append(append([]byte{}, proofPrefix...), ID...))
+		return err
+	})
+	return err == nil
+}
@@ -0,0 +1,120 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+// HeightIndexName names the index of best chain block hashes by height. Unlike the
+// transaction index it is always kept
+const HeightIndexName = "heightindex"
+
+// heightIndexPrefix keys the hash of the best chain block at a height, by the height
+// as 8 bytes big endian
+var heightIndexPrefix = []byte("hi-")
+
+func heightKey(height int) []byte {
+	var h [8]byte
+	binary.BigEndian.PutUint64(h[:], uint64(height))
+	return append(append([]byte{}, heightIndexPrefix...), h[:]...)
+}
+
+var heightIndex = &chainIndex{
+	name:     HeightIndexName,
+	prefixes: [][]byte{heightIndexPrefix},
+	always:   true,
+	connect: func(txn *badger.Txn, block *Block) error {
+		return txn.Set(heightKey(block.Height), block.Hash)
+	},
+	disconnect: func(txn *badger.Txn, block *Block) error {
+		item, err := txn.Get(heightKey(block.Height))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		hash, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(hash, block.Hash) {
+			return nil
+		}
+		return txn.Delete(heightKey(block.Height))
+	},
+}
+
+// heightIndexReady rebuilds the height index when it does not match the best chain,
+// as for chains created before it existed
+func (chain *BlockChain) heightIndexReady() {
+	if !chain.IndexInSync(HeightIndexName) {
+		HandleErr(chain.RebuildIndex(HeightIndexName))
+	}
+}
+
+// GetBlockHash returns the hash of the best chain block at height
+func (chain *BlockChain) GetBlockHash(height int) ([]byte, error) {
+	if height < 0 {
+		return nil, errors.New("negative height")
+	}
+	chain.heightIndexReady()
+	var hash []byte
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(heightKey(height))
+		if err == badger.ErrKeyNotFound {
+			return fmt.Errorf("no block at height %d", height)
+		}
+		if err != nil {
+			return err
+		}
+		hash, err = item.ValueCopy(nil)
+		return err
+	})
+	return hash, err
+}
+
+// GetBlockByHeight returns the best chain block at height
+func (chain *BlockChain) GetBlockByHeight(height int) (Block, error) {
+	hash, err := chain.GetBlockHash(height)
+	if err != nil {
+		return Block{}, err
+	}
+	return chain.GetBlock(hash)
+}
+
+// GetBlockRange returns the best chain blocks from height from to height to, both
+// included, lowest first
+func (chain *BlockChain) GetBlockRange(from, to int) ([]Block, error) {
+	if from < 0 || from > to {
+		return nil, fmt.Errorf("invalid height range %d to %d", from, to)
+	}
+	if best := chain.GetBestHeight(); to > best {
+		return nil, fmt.Errorf("height %d is above the best height %d", to, best)
+	}
+	chain.heightIndexReady()
+	var blocks []Block
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		for height := from; height <= to; height++ {
+			item, err := txn.Get(heightKey(height))
+			if err != nil {
+				return fmt.Errorf("no block at height %d", height)
+			}
+			hash, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			block, err := readBlock(txn, hash)
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, *block)
+		}
+		return nil
+	})
+	return blocks, err
+}
@@ -0,0 +1,83 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func checkHeights(t *testing.T, chain *BlockChain, want ...*Block) {
+	t.Helper()
+	for height, block := range want {
+		hash, err := chain.GetBlockHash(height)
+		if err != nil || !bytes.Equal(hash, block.Hash) {
+			t.Errorf("height %d: %x, %v, want %x", height, hash, err, block.Hash)
+		}
+	}
+	if hash, err := chain.GetBlockHash(len(want)); err == nil {
+		t.Errorf("height %d above the tip has %x", len(want), hash)
+	}
+	blocks, err := chain.GetBlockRange(0, len(want)-1)
+	if err != nil || len(blocks) != len(want) {
+		t.Fatalf("GetBlockRange gave %d blocks, %v, want %d", len(blocks), err, len(want))
+	}
+	for i, block := range blocks {
+		if !bytes.Equal(block.Hash, want[i].Hash) || block.Height != i {
+			t.Errorf("GetBlockRange: block %d is %x at height %d", i, block.Hash, block.Height)
+		}
+	}
+}
+
+// Heights follow the best chain onto a longer branch and back to the first one once it
+// grows longer again
+func TestHeightIndexReorg(t *testing.T) {
+	f := newReorg(t)
+	genesis, err := f.chain.GetBlock(f.genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkHeights(t, f.chain, &genesis, f.a1)
+
+	f.reorg()
+	checkHeights(t, f.chain, &genesis, f.b1, f.b2)
+	block, err := f.chain.GetBlockByHeight(1)
+	if err != nil || !bytes.Equal(block.Hash, f.b1.Hash) {
+		t.Errorf("GetBlockByHeight(1) = %x, %v, want b1", block.Hash, err)
+	}
+
+	a2 := CreateBlock([]*Transaction{CoinbaseTx(f.miner, "")}, f.a1.Hash, 2)
+	a3 := CreateBlock([]*Transaction{CoinbaseTx(f.miner, "")}, a2.Hash, 3)
+	f.chain.AddBlock(a2)
+	checkHeights(t, f.chain, &genesis, f.b1, f.b2)
+	f.chain.AddBlock(a3)
+	checkHeights(t, f.chain, &genesis, f.a1, a2, a3)
+	checkRebuilt(t, f.chain, HeightIndexName, heightIndexPrefix)
+}
+
+// A stale height index is rebuilt on the next read, without waiting for SyncIndexes
+func TestHeightIndexStale(t *testing.T) {
+	f := newReorg(t)
+	f.chain.AddBlock(f.b2)
+	f.chain.AddBlock(f.b1)
+	if f.chain.IndexInSync(HeightIndexName) {
+		t.Fatal("height index in sync after a tip whose parent was missing")
+	}
+	hash, err := f.chain.GetBlockHash(1)
+	if err != nil || !bytes.Equal(hash, f.b1.Hash) {
+		t.Errorf("height 1: %x, %v, want b1", hash, err)
+	}
+	if !f.chain.IndexInSync(HeightIndexName) {
+		t.Error("height index still stale once read")
+	}
+}
+
+func TestGetBlockRangeRejects(t *testing.T) {
+	f := newReorg(t)
+	for _, r := range [][2]int{{-1, 0}, {1, 0}, {0, 2}, {2, 2}} {
+		if blocks, err := f.chain.GetBlockRange(r[0], r[1]); err == nil {
+			t.Errorf("range %d to %d gave %d blocks", r[0], r[1], len(blocks))
+		}
+	}
+	if _, err := f.chain.GetBlockHash(-1); err == nil {
+		t.Error("negative height accepted")
+	}
+}
@@ -0,0 +1,272 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+// indexFlagPrefix keys the state of an optional index, by index name
+var indexFlagPrefix = []byte("idx-")
+
+// States of an index. A missing flag means the index is disabled
+const (
+	indexInSync = byte(1)
+	// indexStale marks an index that missed a change of the best chain,
+	// because blocks between the old and the new tip were not stored yet
+	indexStale = byte(2)
+)
+
+var errMissingBlock = errors.New("block not stored")
+
+// chainIndex is data derived from the best chain, updated as blocks are connected to
+// and disconnected from it
+type chainIndex struct {
+	name string
+	// prefixes are the keys of the index's entries
+	prefixes [][]byte
+	// always indexes are kept without being enabled and cannot be disabled
+	always     bool
+	connect    func(txn *badger.Txn, block *Block) error
+	disconnect func(txn *badger.Txn, block *Block) error
+}
+
+// chainIndexes lists the indexes setTip keeps in sync
+var chainIndexes = []*chainIndex{heightIndex, txIndex, addrIndex, walletIndex}
+
+func findIndex(name string) (*chainIndex, error) {
+	for _, idx := range chainIndexes {
+		if idx.name == name {
+			return idx, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown index %s", name)
+}
+
+func indexState(txn *badger.Txn, name string) byte {
+	value, err := getValue(txn, indexFlagPrefix, []byte(name))
+	if err != nil || len(value) != 1 {
+		return 0
+	}
+	return value[0]
+}
+
+func setIndexState(txn *badger.Txn, name string, state byte) error {
+	return txn.Set(append(append([]byte{}, indexFlagPrefix...), name...), []byte{state})
+}
+
+func readBlock(txn *badger.Txn, hash []byte) (*Block, error) {
+	item, err := txn.Get(hash)
+	if err == badger.ErrKeyNotFound {
+		return nil, errMissingBlock
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseStoredBlock(data)
+}
+
+// branches returns the blocks only on the chain of oldTip, tip first, and the blocks
+// only on the chain of newTip, lowest first. An empty oldTip is an empty chain
+func branches(txn *badger.Txn, oldTip, newTip []byte) ([]*Block, []*Block, error) {
+	var oldBranch, newBranch []*Block
+	var oldBlock, newBlock *Block
+	var err error
+	if len(oldTip) > 0 {
+		if oldBlock, err = readBlock(txn, oldTip); err != nil {
+			return nil, nil, err
+		}
+	}
+	if newBlock, err = readBlock(txn, newTip); err != nil {
+		return nil, nil, err
+	}
+	for oldBlock != nil || newBlock != nil {
+		if oldBlock != nil && newBlock != nil && bytes.Equal(oldBlock.Hash, newBlock.Hash) {
+			break
+		}
+		if newBlock == nil || (oldBlock != nil && oldBlock.Height >= newBlock.Height) {
+			oldBranch = append(oldBranch, oldBlock)
+			oldBlock, err = parentOf(txn, oldBlock)
+		} else {
+			newBranch = append([]*Block{newBlock}, newBranch...)
+			newBlock, err = parentOf(txn, newBlock)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return oldBranch, newBranch, nil
+}
+
+func parentOf(txn *badger.Txn, block *Block) (*Block, error) {
+	if len(block.PrevHash) == 0 {
+		return nil, nil
+	}
+	return readBlock(txn, block.PrevHash)
+}
+
+// setTip updates the indexes for a move of the best chain from oldTip to newTip: blocks
+// only on the old chain are disconnected, tip first, then blocks only on the new chain
+// connected, lowest first. When a block in between is not stored yet the enabled indexes
+// are marked stale, see SyncIndexes
+func setTip(txn *badger.Txn, oldTip, newTip []byte) error {
+	var enabled []*chainIndex
+	for _, idx := range chainIndexes {
+		state := indexState(txn, idx.name)
+		if state == indexInSync {
+			enabled = append(enabled, idx)
+		} else if state == 0 && idx.always {
+			// a chain stored before the index existed, SyncIndexes builds it
+			if err := setIndexState(txn, idx.name, indexStale); err != nil {
+				return err
+			}
+		}
+	}
+	if len(enabled) == 0 {
+		return nil
+	}
+	oldBranch, newBranch, err := branches(txn, oldTip, newTip)
+	if err == errMissingBlock {
+		for _, idx := range enabled {
+			if err := setIndexState(txn, idx.name, indexStale); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, idx := range enabled {
+		for _, block := range oldBranch {
+			if err := idx.disconnect(txn, block); err != nil {
+				return err
+			}
+		}
+		for _, block := range newBranch {
+			if err := idx.connect(txn, block); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// IndexEnabled reports whether the index called name is kept, in sync or not
+func (chain *BlockChain) IndexEnabled(name string) bool {
+	var state byte
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		state = indexState(txn, name)
+		return nil
+	})
+	HandleErr(err)
+	return state != 0
+}
+
+// IndexInSync reports whether the index called name is enabled and matches the best chain
+func (chain *BlockChain) IndexInSync(name string) bool {
+	var state byte
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		state = indexState(txn, name)
+		return nil
+	})
+	HandleErr(err)
+	return state == indexInSync
+}
+
+// EnableIndex builds the index called name from the best chain and keeps it from then on
+func (chain *BlockChain) EnableIndex(name string) error {
+	if _, err := findIndex(name); err != nil {
+		return err
+	}
+	err := chain.Database.Update(func(txn *badger.Txn) error {
+		return setIndexState(txn, name, indexStale)
+	})
+	HandleErr(err)
+	return chain.RebuildIndex(name)
+}
+
+// DisableIndex deletes the index called name
+func (chain *BlockChain) DisableIndex(name string) error {
+	idx, err := findIndex(name)
+	if err != nil {
+		return err
+	}
+	if idx.always {
+		return fmt.Errorf("index %s cannot be disabled", name)
+	}
+	UTXOSet := UTXOset{chain}
+	for _, prefix := range idx.prefixes {
+		UTXOSet.DeleteByPrefix(prefix)
+	}
+	return chain.Database.Update(func(txn *badger.Txn) error {
+		return txn.Delete(append(append([]byte{}, indexFlagPrefix...), name...))
+	})
+}
+
+// RebuildIndex deletes the index called name and connects every best chain block to it again
+func (chain *BlockChain) RebuildIndex(name string) error {
+	idx, err := findIndex(name)
+	if err != nil {
+		return err
+	}
+	UTXOSet := UTXOset{chain}
+	for _, prefix := range idx.prefixes {
+		UTXOSet.DeleteByPrefix(prefix)
+	}
+	var hashes [][]byte
+	iter := chain.Iterator()
+	for len(iter.CurrentHash) > 0 {
+		hashes = append(hashes, iter.Next().Hash)
+	}
+	for i := len(hashes) - 1; i >= 0; i-- {
+		err := chain.Database.Update(func(txn *badger.Txn) error {
+			block, err := readBlock(txn, hashes[i])
+			if err != nil {
+				return err
+			}
+			return idx.connect(txn, block)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return chain.Database.Update(func(txn *badger.Txn) error {
+		return setIndexState(txn, name, indexInSync)
+	})
+}
+
+// initIndexes marks the always kept indexes in sync for a new chain, before its
+// genesis block is connected
+func initIndexes(txn *badger.Txn) error {
+	for _, idx := range chainIndexes {
+		if idx.always {
+			if err := setIndexState(txn, idx.name, indexInSync); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SyncIndexes rebuilds the indexes marked stale and the always kept ones never built.
+// Nodes call it once a sync is done
+func (chain *BlockChain) SyncIndexes() {
+	for _, idx := range chainIndexes {
+		var state byte
+		err := chain.Database.View(func(txn *badger.Txn) error {
+			state = indexState(txn, idx.name)
+			return nil
+		})
+		HandleErr(err)
+		if state == indexStale || (state == 0 && idx.always) {
+			HandleErr(chain.RebuildIndex(idx.name))
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Package blockchain (imported as legacy) freezes the shape transactions had while they were
+// stored with encoding/gob. Transactions with Version 0 are hashed by gob encoding these types,
+// so their IDs, merkle roots and proofs of work stay valid.
+//
+// gob writes every field name into the type descriptor it hashes, so these are exactly the
+// fields the baseline types had, in the same order. It also writes slice type names with
+// their package name ("[]blockchain.TxInputs"), which is why this package must be called
+// blockchain. Never change these types
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+type TxInputs struct {
+	TXID   []byte
+	Vout   int
+	Sig    []byte
+	PubKey []byte
+}
+
+type TxOutputs struct {
+	Value      int
+	PubKeyHash []byte
+}
+
+type Transaction struct {
+	ID   []byte
+	Vin  []TxInputs
+	Vout []TxOutputs
+}
+
+// Encode returns the gob encoding of tx as the legacy format wrote it
+func (tx Transaction) Encode() []byte {
+	buff := new(bytes.Buffer)
+	encoder := gob.NewEncoder(buff)
+	if err := encoder.Encode(tx); err != nil {
+		panic(err)
+	}
+	return buff.Bytes()
+}
@@ -0,0 +1,98 @@
+package blockchain
+
+import (
+	"fmt"
+)
+
+const (
+	// LockTimeThreshold splits Transaction.LockTime into block heights (below) and unix timestamps (at or above)
+	LockTimeThreshold = 500000000
+
+	// SequenceLockTimeTypeFlag makes a relative lock count time instead of blocks
+	SequenceLockTimeTypeFlag = 1 << 22
+	// SequenceLockTimeMask holds the relative lock value, in blocks or SequenceLockTimeGranularity seconds
+	SequenceLockTimeMask = 0x0000ffff
+	// SequenceLockTimeGranularity is how many seconds one unit of a time based relative lock is
+	SequenceLockTimeGranularity = 512
+)
+
+// RelativeLockBlocks builds a Sequence that locks an input until the output it spends has that many confirmations
+func RelativeLockBlocks(blocks int) uint32 {
+	return uint32(blocks) & SequenceLockTimeMask
+}
+
+// RelativeLockSeconds builds a Sequence that locks an input until the output it spends is that old,
+// rounded up to SequenceLockTimeGranularity
+func RelativeLockSeconds(seconds int64) uint32 {
+	units := (seconds + SequenceLockTimeGranularity - 1) / SequenceLockTimeGranularity
+	return SequenceLockTimeTypeFlag | uint32(units)&SequenceLockTimeMask
+}
+
+// IsFinal reports whether tx may be included in a block with the given height and timestamp
+func (tx *Transaction) IsFinal(height int, timestamp int64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+	if tx.LockTime < LockTimeThreshold {
+		return int64(height) >= tx.LockTime
+	}
+	return timestamp >= tx.LockTime
+}
+
+// CheckTxLocks checks the absolute lock time of tx and the relative lock time of each input
+// against a block at the given height and timestamp
+func (chain *BlockChain) CheckTxLocks(tx *Transaction, height int, timestamp int64) error {
+	return chain.checkTxLocks(tx, height, timestamp, nil)
+}
+
+// checkTxLocks is CheckTxLocks for a transaction of a block whose transactions are in
+// inBlock, by ID. An output of the block itself is confirmed at the block's height and
+// timestamp, so any nonzero relative lock on it fails
+func (chain *BlockChain) checkTxLocks(tx *Transaction, height int, timestamp int64, inBlock map[string]bool) error {
+	if !tx.IsFinal(height, timestamp) {
+		return fmt.Errorf("transaction %x is locked until %d", tx.ID, tx.LockTime)
+	}
+	if tx.IsCoinbaseTxn() {
+		return nil
+	}
+	for _, in := range tx.Vin {
+		if in.Sequence&SequenceLockTimeMask == 0 {
+			continue
+		}
+		prevHeight, prevTimestamp := height, timestamp
+		if !inBlock[string(in.TXID)] {
+			_, prevBlock, err := chain.FindTrxBlock(in.TXID)
+			if err != nil {
+				return err
+			}
+			prevHeight, prevTimestamp = prevBlock.Height, prevBlock.Timestamp
+		}
+		value := int64(in.Sequence & SequenceLockTimeMask)
+		if in.Sequence&SequenceLockTimeTypeFlag != 0 {
+			unlockTime := prevTimestamp + value*SequenceLockTimeGranularity
+			if timestamp < unlockTime {
+				return fmt.Errorf("input %x:%d is locked until %d", in.TXID, in.Vout, unlockTime)
+			}
+		} else {
+			unlockHeight := int64(prevHeight) + value
+			if int64(height) < unlockHeight {
+				return fmt.Errorf("input %x:%d is locked until height %d", in.TXID, in.Vout, unlockHeight)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckBlockLocks rejects a block holding a transaction that is not final at the block's height and timestamp
+func (chain *BlockChain) CheckBlockLocks(block *Block) error {
+	inBlock := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		inBlock[string(tx.ID)] = true
+	}
+	for _, tx := range block.Transactions {
+		if err := chain.checkTxLocks(tx, block.Height, block.Timestamp, inBlock); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package blockchain
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// inBlockSpend returns a block at height 10 holding a transaction and a child spending it
+// with sequence
+func inBlockSpend(sequence uint32) *Block {
+	parent := &Transaction{
+		Vin:     []TxInputs{{TXID: bytes.Repeat([]byte{0x11}, 32), Vout: 0}},
+		Vout:    []TxOutputs{{Value: 10, PubKeyHash: bytes.Repeat([]byte{0xaa}, 20)}},
+		Version: TxVersion,
+	}
+	parent.ID = parent.IDHash()
+	child := &Transaction{
+		Vin:     []TxInputs{{TXID: parent.ID, Vout: 0, Sequence: sequence}},
+		Vout:    []TxOutputs{{Value: 10, PubKeyHash: bytes.Repeat([]byte{0xbb}, 20)}},
+		Version: TxVersion,
+	}
+	child.ID = child.IDHash()
+	block := &Block{Transactions: []*Transaction{parent, child}, Height: 10}
+	block.Timestamp = 1700000000
+	return block
+}
+
+// The parent of a transaction in the same block is resolved from the block, the chain
+// (which has no database here) is never asked for it
+func TestCheckBlockLocksInBlockParent(t *testing.T) {
+	chain := &BlockChain{}
+	if err := chain.CheckBlockLocks(inBlockSpend(0)); err != nil {
+		t.Errorf("unlocked spend of an output of the same block rejected: %v", err)
+	}
+
+	err := chain.CheckBlockLocks(inBlockSpend(RelativeLockBlocks(1)))
+	if err == nil || !strings.Contains(err.Error(), "locked until height 11") {
+		t.Errorf("spend locked for 1 block of an output of the same block: %v", err)
+	}
+	err = chain.CheckBlockLocks(inBlockSpend(RelativeLockSeconds(512)))
+	if err == nil || !strings.Contains(err.Error(), "locked until") {
+		t.Errorf("spend locked for 512 seconds of an output of the same block: %v", err)
+	}
+}
@@ -1,12 +1,32 @@
 package blockchain
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"errors"
+)
+
+// Merkle tree rules. Blocks before version 2 use MerkleDuplicate, later blocks MerkleTagged
+const (
+	// MerkleDuplicate hashes leaves as sha256(data) and nodes as sha256(left || right),
+	// pairing an odd last node with a copy of itself. A transaction list ending in a repeated
+	// transaction has the same root as the list without it, so blocks with duplicate
+	// transactions are rejected (CVE-2012-2459)
+	MerkleDuplicate = iota
+	// MerkleTagged hashes leaves as sha256(0x00 || data) and nodes as sha256(0x01 || left || right)
+	// and carries an odd last node up a level unchanged, so no two transaction lists share a root
+	// and a node can never pass for a leaf
+	MerkleTagged
+)
 
+const (
+	merkleLeafTag = byte(0x00)
+	merkleNodeTag = byte(0x01)
 )
 
 type MerkleTree struct{
 	RootNode *MerkleNode
+	Version  int
 }
 
 type MerkleNode struct{
@@ -15,15 +35,24 @@ type MerkleNode struct{
 	Data []byte
 }
 
+// MerkleVersion returns the merkle tree rule of blocks with the given version
+func MerkleVersion(blockVersion int) int{
+	if blockVersion < 2{
+		return MerkleDuplicate
+	}
+	return MerkleTagged
+}
+
 func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode{
+	return newMerkleNode(left, right, data, MerkleDuplicate)
+}
+
+func newMerkleNode(left, right *MerkleNode, data []byte, version int) *MerkleNode{
 	node  := MerkleNode{}
 	if left == nil && right == nil{
-		hash := sha256.Sum256(data)
-		node.Data = hash[:]
+		node.Data = merkleLeaf(data, version)
 	}else{
-		prevHashes := append(left.Data, right.Data...)
-		hash := sha256.Sum256(prevHashes)
-		node.Data = hash[:]
+		node.Data = merkleParent(left.Data, right.Data, version)
 	}
 	node.Right = right
 	node.Left = left
@@ -31,25 +60,111 @@ func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode{
 	return &node
 }
 
-func NewMerkleTree(data [][]byte) *MerkleTree{
-	var nodes []MerkleNode
-	// Checking if the nodes on the merkle tree are even, if not duplicated the last node
-	if len(data) % 2 != 0{
-		data = append(data, data[len(data) - 1])
+func merkleLeaf(data []byte, version int) []byte{
+	var hash [32]byte
+	if version == MerkleTagged{
+		hash = sha256.Sum256(append([]byte{merkleLeafTag}, data...))
+	}else{
+		hash = sha256.Sum256(data)
 	}
+	return hash[:]
+}
+
+func merkleParent(left, right []byte, version int) []byte{
+	var prevHashes []byte
+	if version == MerkleTagged{
+		prevHashes = append(prevHashes, merkleNodeTag)
+	}
+	prevHashes = append(prevHashes, left...)
+	prevHashes = append(prevHashes, right...)
+	hash := sha256.Sum256(prevHashes)
+	return hash[:]
+}
+
+// NewMerkleTree builds a MerkleDuplicate tree, the rule of blocks before version 2
+func NewMerkleTree(data [][]byte) *MerkleTree{
+	return NewMerkleTreeVersion(data, MerkleDuplicate)
+}
+
+// NewMerkleTreeVersion builds a tree over data, which must not be empty, under the given rule
+func NewMerkleTreeVersion(data [][]byte, version int) *MerkleTree{
+	var nodes []*MerkleNode
 	for _, datum := range data{
-		node := NewMerkleNode(nil, nil, datum)
-		nodes = append(nodes, *node)
+		nodes = append(nodes, newMerkleNode(nil, nil, datum, version))
 	}
-	for i := 0; i < len(data)/2; i++{
-		var level []MerkleNode
+	// A lone leaf is still paired with itself under the duplicate rule
+	if version == MerkleDuplicate && len(nodes) == 1{
+		nodes = append(nodes, nodes[0])
+	}
+	for len(nodes) > 1{
+		var level []*MerkleNode
 
 		for j := 0; j < len(nodes); j+=2{
-			node := NewMerkleNode(&nodes[j], &nodes[j+1], nil)
-			level = append(level, *node)
+			if j+1 == len(nodes){
+				if version == MerkleTagged{
+					level = append(level, nodes[j])
+					continue
+				}
+				// Checking if the nodes on the level are even, if not duplicated the last node
+				nodes = append(nodes, nodes[j])
+			}
+			level = append(level, newMerkleNode(nodes[j], nodes[j+1], nil, version))
 		}
 		nodes = level
 	}
-	tree := &MerkleTree{&nodes[0]}
+	tree := &MerkleTree{nodes[0], version}
 	return tree
-}
\ No newline at end of file
+}
+
+// MerkleProof is the path from a leaf to the root: the sibling hash at every level, lowest first
+type MerkleProof struct{
+	Hashes [][]byte
+	// Left[i] is true when Hashes[i] is the left sibling
+	Left []bool
+	// The tree rule, it follows from the version of the block and is not serialized
+	Version int
+}
+
+// Proof returns the inclusion proof of the leaf built from txid, the transaction hash
+// passed to NewMerkleTree
+func (tree *MerkleTree) Proof(txid []byte) (*MerkleProof, error){
+	proof := &MerkleProof{Version: tree.Version}
+	if !findLeaf(tree.RootNode, merkleLeaf(txid, tree.Version), proof){
+		return nil, errors.New("transaction is not in the tree")
+	}
+	return proof, nil
+}
+
+// findLeaf walks down to the leaf holding data, filling proof with the siblings on the way back up
+func findLeaf(node *MerkleNode, data []byte, proof *MerkleProof) bool{
+	if node.Left == nil && node.Right == nil{
+		return bytes.Equal(node.Data, data)
+	}
+	if findLeaf(node.Left, data, proof){
+		proof.Hashes = append(proof.Hashes, node.Right.Data)
+		proof.Left = append(proof.Left, false)
+		return true
+	}
+	if findLeaf(node.Right, data, proof){
+		proof.Hashes = append(proof.Hashes, node.Left.Data)
+		proof.Left = append(proof.Left, true)
+		return true
+	}
+	return false
+}
+
+// VerifyMerkleProof reports whether proof links txid to root
+func VerifyMerkleProof(root, txid []byte, proof *MerkleProof) bool{
+	if len(proof.Hashes) != len(proof.Left){
+		return false
+	}
+	hash := merkleLeaf(txid, proof.Version)
+	for i, sibling := range proof.Hashes{
+		if proof.Left[i]{
+			hash = merkleParent(sibling, hash, proof.Version)
+		}else{
+			hash = merkleParent(hash, sibling, proof.Version)
+		}
+	}
+	return bytes.Equal(hash, root)
+}
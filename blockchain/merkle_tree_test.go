@@ -0,0 +1,99 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// merkleLeaves returns the first n leaves of the vectors in docs/merkle.md:
+// leaf i is 32 bytes all equal to i
+func merkleLeaves(n int) [][]byte {
+	var leaves [][]byte
+	for i := 0; i < n; i++ {
+		leaves = append(leaves, bytes.Repeat([]byte{byte(i)}, 32))
+	}
+	return leaves
+}
+
+func TestMerkleRootVectors(t *testing.T) {
+	tests := []struct {
+		n         int
+		duplicate string
+		tagged    string
+	}{
+		{1, "2eeb74a6177f588d80c0c752b99556902ddf9682d0b906f5aa2adbaf8466a4e9", "7f9c9e31ac8256ca2f258583df262dbc7d6f68f2a03043d5c99a4ae5a7396ce9"},
+		{2, "348bd8bf69ec69c65ae43a22009053719bf76d9998faf5be36676634bc9b822f", "28fb81e496897e0ce886f08602392e9239b65c659041e5202163e58ad898f444"},
+		{3, "57c18f197eec50ca58d6a40b85c7833da638f394689ad4fd8e86319f8aa507a8", "ba8d94b7fbcecae7b81c4c80574fe24734a6917bf9c1ecd66ff3e0c34ead4620"},
+		{4, "4fc5f858a182a0445d5ec5bf71477fd9e076bf383f1ba8090e1809eeaacce894", "fdea52008cdae79fa8bf806261959e23f5e11681646a2fa2bc9b5e56b32030a2"},
+		{5, "175b403894e54746933bf874976579abb11d4817bcc7e20e7cf3355f345a64ad", "85e20cac1f02fda7bcdb2fc3f908568c57018c77815f1fa361acad13994f08bf"},
+		{6, "558a683611f4cabe7165d57df3af3bb0b9e8bba0361831c8c25d0d63b1f073a6", "380272ed524daf3398067faf4717782ba90805d4823ea6e1e594668c9fd40bba"},
+		{7, "c3f78e20139bf78892b49027f6d09838e58f23a62c11647a88d6a676ef64e7b9", "7318881c41fce3c1de3640df8e8c110c93f43f686b74204a9d1ad5b8c71c2047"},
+		{8, "092ba268976d1fe77293911061427ac76bacf774d5cfd6a58bad9938538ed341", "f907f23f76aa01b755a614d31ef9832909f44638b4590073301e61e6d01f9a1d"},
+		{9, "32611fb1e1690bd542fbe1194ce7e5353070e41d00f800ecd354713d4e43b436", "57a92667ebb7ab5e021d0d10dce29b3111769aff9ef206339797bea4494d09f3"},
+	}
+	for _, test := range tests {
+		leaves := merkleLeaves(test.n)
+		for _, rule := range []struct {
+			version int
+			root    string
+		}{{MerkleDuplicate, test.duplicate}, {MerkleTagged, test.tagged}} {
+			tree := NewMerkleTreeVersion(leaves, rule.version)
+			if got := hex.EncodeToString(tree.RootNode.Data); got != rule.root {
+				t.Errorf("rule %d, %d leaves: root %s, want %s", rule.version, test.n, got, rule.root)
+			}
+			for i, leaf := range leaves {
+				proof, err := tree.Proof(leaf)
+				if err != nil {
+					t.Errorf("rule %d, %d leaves: no proof of leaf %d: %v", rule.version, test.n, i, err)
+					continue
+				}
+				if !VerifyMerkleProof(tree.RootNode.Data, leaf, proof) {
+					t.Errorf("rule %d, %d leaves: proof of leaf %d does not verify", rule.version, test.n, i)
+				}
+			}
+		}
+	}
+}
+
+// A repeated last transaction keeps the root under the duplicate rule, not under the tagged rule
+func TestMerkleDuplicatedLeaf(t *testing.T) {
+	mutated := append(merkleLeaves(3), merkleLeaves(3)[2])
+	duplicate := NewMerkleTreeVersion(mutated, MerkleDuplicate).RootNode.Data
+	if want := NewMerkleTreeVersion(merkleLeaves(3), MerkleDuplicate).RootNode.Data; !bytes.Equal(duplicate, want) {
+		t.Errorf("duplicate rule root of 0, 1, 2, 2 is %x, want the root of 0, 1, 2", duplicate)
+	}
+	tagged := NewMerkleTreeVersion(mutated, MerkleTagged).RootNode.Data
+	if got, want := hex.EncodeToString(tagged), "9aa08d413285ecda667944ba9446d77c1f1712ecf946bfcf74453c731a38e7b7"; got != want {
+		t.Errorf("tagged rule root of 0, 1, 2, 2 is %s, want %s", got, want)
+	}
+	if bytes.Equal(tagged, NewMerkleTreeVersion(merkleLeaves(3), MerkleTagged).RootNode.Data) {
+		t.Error("tagged rule gives 0, 1, 2, 2 the root of 0, 1, 2")
+	}
+}
+
+func TestMerkleProofRejects(t *testing.T) {
+	leaves := merkleLeaves(5)
+	for _, version := range []int{MerkleDuplicate, MerkleTagged} {
+		tree := NewMerkleTreeVersion(leaves, version)
+		if _, err := tree.Proof(bytes.Repeat([]byte{0xff}, 32)); err == nil {
+			t.Errorf("rule %d: proof of a leaf not in the tree", version)
+		}
+		proof, err := tree.Proof(leaves[4])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if VerifyMerkleProof(tree.RootNode.Data, leaves[3], proof) {
+			t.Errorf("rule %d: proof of leaf 4 verifies leaf 3", version)
+		}
+		proof.Version = 1 - version
+		if VerifyMerkleProof(tree.RootNode.Data, leaves[4], proof) {
+			t.Errorf("rule %d: proof verifies under the other rule", version)
+		}
+	}
+	// under the tagged rule the odd leaf 4 is carried up two levels, so its proof is short
+	proof, _ := NewMerkleTreeVersion(leaves, MerkleTagged).Proof(leaves[4])
+	if len(proof.Hashes) != 1 {
+		t.Errorf("tagged proof of the carried leaf has %d hashes, want 1", len(proof.Hashes))
+	}
+}
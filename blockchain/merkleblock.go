@@ -0,0 +1,169 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"main.go/codec"
+	"main.go/wallet"
+)
+
+// MerkleBlock is a block header with some of its transactions and their merkle proofs.
+// It lets a client that only follows headers check that the transactions were mined
+type MerkleBlock struct {
+	Header BlockHeader
+	Height int
+	Txs    []Transaction
+	Proofs []MerkleProof
+}
+
+// NewMerkleBlock builds a MerkleBlock of block holding the transactions whose ID is in ids
+func NewMerkleBlock(block *Block, ids [][]byte) (*MerkleBlock, error) {
+	var txHashes [][]byte
+	for _, tx := range block.Transactions {
+		txHashes = append(txHashes, tx.HashTx())
+	}
+	tree := NewMerkleTreeVersion(txHashes, MerkleVersion(block.Version))
+
+	mb := &MerkleBlock{Header: block.BlockHeader, Height: block.Height}
+	for _, id := range ids {
+		idx := -1
+		for i, tx := range block.Transactions {
+			if bytes.Equal(tx.ID, id) {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, fmt.Errorf("transaction %x is not in block %x", id, block.Hash)
+		}
+		if err := block.Transactions[idx].CheckID(); err != nil {
+			return nil, err
+		}
+		proof, err := tree.Proof(txHashes[idx])
+		if err != nil {
+			return nil, err
+		}
+		mb.Txs = append(mb.Txs, *block.Transactions[idx])
+		mb.Proofs = append(mb.Proofs, *proof)
+	}
+	return mb, nil
+}
+
+// GetTxProof returns a MerkleBlock proving the transaction with ID was mined
+func (chain *BlockChain) GetTxProof(ID []byte) (*MerkleBlock, error) {
+	_, block, err := chain.FindTrxBlock(ID)
+	if err != nil {
+		return nil, err
+	}
+	return NewMerkleBlock(block, [][]byte{ID})
+}
+
+// Verify checks the header's proof of work and that every transaction hashes to its ID
+// and is under the merkle root
+func (mb *MerkleBlock) Verify() error {
+	if !ValidateHeader(&mb.Header) {
+		return errors.New("invalid proof of work")
+	}
+	if len(mb.Txs) != len(mb.Proofs) {
+		return errors.New("every transaction needs a proof")
+	}
+	for i := range mb.Txs {
+		if mb.Proofs[i].Version != MerkleVersion(mb.Header.Version) {
+			return errors.New("proof does not use the block's merkle tree rule")
+		}
+		if err := mb.Txs[i].CheckID(); err != nil {
+			return err
+		}
+		if !VerifyMerkleProof(mb.Header.MerkleRoot, mb.Txs[i].HashTx(), &mb.Proofs[i]) {
+			return fmt.Errorf("transaction %x is not under the merkle root", mb.Txs[i].ID)
+		}
+	}
+	return nil
+}
+
+func (mb *MerkleBlock) Serialize() []byte {
+	w := codec.NewWriter()
+	mb.Header.encode(w)
+	w.Varint(int64(mb.Height))
+	w.Uvarint(uint64(len(mb.Txs)))
+	for i := range mb.Txs {
+		mb.Txs[i].encode(w)
+		proof := mb.Proofs[i]
+		w.BytesList(proof.Hashes)
+		for _, left := range proof.Left {
+			w.Bool(left)
+		}
+	}
+	return w.Data()
+}
+
+func DeserializeMerkleBlock(data []byte) (*MerkleBlock, error) {
+	r, err := codec.NewReader(data)
+	if err != nil {
+		return nil, err
+	}
+	mb := &MerkleBlock{Header: decodeHeader(r), Height: r.Int()}
+	count := r.Count()
+	for i := 0; i < count && r.Err() == nil; i++ {
+		mb.Txs = append(mb.Txs, decodeTx(r))
+		proof := MerkleProof{Hashes: r.BytesList(), Version: MerkleVersion(mb.Header.Version)}
+		for range proof.Hashes {
+			proof.Left = append(proof.Left, r.Bool())
+		}
+		mb.Proofs = append(mb.Proofs, proof)
+	}
+	return mb, r.Done()
+}
+
+// Touches reports whether tx pays to or spends from one of pubKeyHashes.
+// An input spends from a hash through the public key or redeem script it reveals
+func (tx *Transaction) Touches(pubKeyHashes [][]byte) bool {
+	for _, hash := range pubKeyHashes {
+		for _, out := range tx.Vout {
+			if !out.IsData() && out.IsLockedWithKey(hash) {
+				return true
+			}
+		}
+		if tx.IsCoinbaseTxn() {
+			continue
+		}
+		for _, in := range tx.Vin {
+			if len(in.Redeem) > 0 {
+				if bytes.Equal(wallet.PubKeyHash(in.Redeem), hash) {
+					return true
+				}
+			} else if in.UsesKey(hash) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FindMerkleBlocks returns a MerkleBlock for every best chain block from height on that holds
+// transactions touching pubKeyHashes, lowest first
+func (chain *BlockChain) FindMerkleBlocks(pubKeyHashes [][]byte, height int) []*MerkleBlock {
+	var mbs []*MerkleBlock
+	iter := chain.Iterator()
+	for len(iter.CurrentHash) > 0 {
+		block := iter.Next()
+		if block.Height < height {
+			break
+		}
+		var ids [][]byte
+		for _, tx := range block.Transactions {
+			if tx.Touches(pubKeyHashes) {
+				ids = append(ids, tx.ID)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		mb, err := NewMerkleBlock(block, ids)
+		HandleErr(err)
+		mbs = append([]*MerkleBlock{mb}, mbs...)
+	}
+	return mbs
+}
@@ -0,0 +1,98 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+// merkleTestBlock mines a block of n transactions paying distinct hashes
+func merkleTestBlock(n int) *Block {
+	var txs []*Transaction
+	for i := 0; i < n; i++ {
+		tx, _ := fundingTx(TxOutputs{Value: 10 + i, PubKeyHash: bytes.Repeat([]byte{byte(i)}, 20)})
+		txs = append(txs, tx)
+	}
+	return CreateBlock(txs, bytes.Repeat([]byte{0x01}, 32), 1)
+}
+
+// A merkle block survives serialization and proves each of its transactions, for every
+// subset of a block with an odd number of transactions
+func TestMerkleBlockRoundTrip(t *testing.T) {
+	block := merkleTestBlock(5)
+	for _, picked := range [][]int{{0}, {4}, {1, 3}, {0, 1, 2, 3, 4}, {}} {
+		var ids [][]byte
+		for _, i := range picked {
+			ids = append(ids, block.Transactions[i].ID)
+		}
+		mb, err := NewMerkleBlock(block, ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := DeserializeMerkleBlock(mb.Serialize())
+		if err != nil {
+			t.Fatalf("%v: %v", picked, err)
+		}
+		if !bytes.Equal(parsed.Serialize(), mb.Serialize()) || parsed.Height != 1 || len(parsed.Txs) != len(picked) {
+			t.Errorf("%v: merkle block changed in a round trip", picked)
+		}
+		if err := parsed.Verify(); err != nil {
+			t.Errorf("%v: %v", picked, err)
+		}
+		for i, id := range ids {
+			if !bytes.Equal(parsed.Txs[i].ID, id) {
+				t.Errorf("%v: transaction %d is %x, want %x", picked, i, parsed.Txs[i].ID, id)
+			}
+		}
+	}
+
+	if _, err := NewMerkleBlock(block, [][]byte{bytes.Repeat([]byte{0xee}, 32)}); err == nil {
+		t.Error("merkle block built for a transaction missing from the block")
+	}
+	mb, err := NewMerkleBlock(block, [][]byte{block.Transactions[2].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeserializeMerkleBlock(append(mb.Serialize(), 0)); err == nil {
+		t.Error("merkle block with a trailing byte accepted")
+	}
+}
+
+func TestMerkleBlockTampered(t *testing.T) {
+	block := merkleTestBlock(5)
+	other := merkleTestBlock(3)
+	tests := []struct {
+		name   string
+		tamper func(mb *MerkleBlock)
+	}{
+		{"proof hash", func(mb *MerkleBlock) { mb.Proofs[0].Hashes[0][0] ^= 1 }},
+		{"proof side", func(mb *MerkleBlock) { mb.Proofs[0].Left[0] = !mb.Proofs[0].Left[0] }},
+		{"proof shortened", func(mb *MerkleBlock) {
+			mb.Proofs[0].Hashes = mb.Proofs[0].Hashes[1:]
+			mb.Proofs[0].Left = mb.Proofs[0].Left[1:]
+		}},
+		{"proof of another transaction", func(mb *MerkleBlock) { mb.Proofs[0], mb.Proofs[1] = mb.Proofs[1], mb.Proofs[0] }},
+		{"proof missing", func(mb *MerkleBlock) { mb.Proofs = mb.Proofs[:1] }},
+		{"output value", func(mb *MerkleBlock) { mb.Txs[0].Vout[0].Value++ }},
+		{"output value with its ID", func(mb *MerkleBlock) {
+			mb.Txs[0].Vout[0].Value++
+			mb.Txs[0].ID = mb.Txs[0].IDHash()
+		}},
+		{"transaction from another block", func(mb *MerkleBlock) { mb.Txs[0] = *other.Transactions[0] }},
+		{"merkle root", func(mb *MerkleBlock) { mb.Header.MerkleRoot = other.MerkleRoot }},
+		{"tree rule", func(mb *MerkleBlock) { mb.Proofs[0].Version = MerkleVersion(0) }},
+	}
+	for _, test := range tests {
+		mb, err := NewMerkleBlock(block, [][]byte{block.Transactions[1].ID, block.Transactions[4].ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := DeserializeMerkleBlock(mb.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.tamper(parsed)
+		if err := parsed.Verify(); err == nil {
+			t.Errorf("%s: tampered merkle block verifies", test.name)
+		}
+	}
+}
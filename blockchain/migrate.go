@@ -0,0 +1,77 @@
+package blockchain
+
+import (
+	"bytes"
+
+	"github.com/dgraph-io/badger/v3"
+	"main.go/codec"
+)
+
+// indexPrefixes key entries derived from blocks and the wallet index state, which migration leaves alone
+var indexPrefixes = [][]byte{headerPrefix, filterPrefix, filterHeaderPrefix, indexFlagPrefix, txIndexPrefix, heightIndexPrefix, addrIndexPrefix, addrOutPrefix,
+	walletKeyPrefix, walletTxPrefix, walletOutPrefix, walletPendingPrefix}
+
+func isIndexKey(key []byte) bool {
+	for _, prefix := range indexPrefixes {
+		if bytes.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateStorage rewrites blocks and UTXO set entries stored with encoding/gob or an older
+// format version in the current format, and stores the headers of blocks written before
+// headers were kept separately. Transactions and blocks keep their versions, so their hashes
+// and proofs of work do not change. It returns how many values were written and is safe to run again
+func (chain *BlockChain) MigrateStorage() int {
+	rewritten := make(map[string][]byte)
+
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			item := iter.Item()
+			key := item.KeyCopy(nil)
+			if bytes.Equal(key, []byte("lh")) || isIndexKey(key) {
+				continue
+			}
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if bytes.HasPrefix(key, utxoPrefix) {
+				if codec.IsCurrent(value) {
+					continue
+				}
+				outs, err := parseStoredOutputs(value)
+				if err != nil {
+					return err
+				}
+				rewritten[string(key)] = outs.SerializeOutputs()
+				continue
+			}
+			headerKey := append(append([]byte{}, headerPrefix...), key...)
+			_, err = txn.Get(headerKey)
+			if codec.IsCurrent(value) && err == nil {
+				continue
+			}
+			block, err := parseStoredBlock(value)
+			if err != nil {
+				return err
+			}
+			rewritten[string(key)] = block.Serialize()
+			rewritten[string(headerKey)] = encodeHeaderEntry(&block.BlockHeader, block.Height)
+		}
+		return nil
+	})
+	HandleErr(err)
+
+	batch := chain.Database.NewWriteBatch()
+	defer batch.Cancel()
+	for key, value := range rewritten {
+		HandleErr(batch.Set([]byte(key), value))
+	}
+	HandleErr(batch.Flush())
+	return len(rewritten)
+}
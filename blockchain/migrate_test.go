@@ -0,0 +1,142 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"main.go/codec"
+)
+
+// inTempDir runs the rest of the test in a fresh working directory with a tmp directory
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "tmp"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// openBaselineChain writes the entries of baselineChain to the database of a node in a
+// fresh working directory and opens it
+func openBaselineChain(t *testing.T) *BlockChain {
+	t.Helper()
+	entries := readBaselineChain(t)
+	inTempDir(t)
+	path := fmt.Sprintf(dbPath, "test")
+	db, err := badger.Open(badger.DefaultOptions(path).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		for key, value := range entries {
+			if err := txn.Set([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	chain := ContinueBlockchain("test")
+	t.Cleanup(func() { chain.Database.Close() })
+	return chain
+}
+
+// values returns every entry of the database but the tip
+func values(t *testing.T, chain *BlockChain) map[string][]byte {
+	t.Helper()
+	entries := make(map[string][]byte)
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			value, err := iter.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			entries[string(iter.Item().KeyCopy(nil))] = value
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(entries, "lh")
+	return entries
+}
+
+// A chain stored by the baseline is rewritten in the current format without changing a
+// block hash, transaction ID or unspent output, and migrating again writes nothing
+func TestMigrateBaselineChain(t *testing.T) {
+	before := baselineBlocks(t)
+	chain := openBaselineChain(t)
+	unspentBefore := chain.FindUTXO()
+
+	// 3 blocks, 3 headers and 3 UTXO set entries
+	if count := chain.MigrateStorage(); count != 9 {
+		t.Errorf("MigrateStorage wrote %d values, want 9", count)
+	}
+	for key, value := range values(t, chain) {
+		if !codec.IsCurrent(value) {
+			t.Errorf("%x still stored as %x...", key, value[:2])
+		}
+		if strings.HasPrefix(key, string(utxoPrefix)) {
+			if _, err := ParseOutputs(value); err != nil {
+				t.Errorf("UTXO set entry %x: %v", key, err)
+			}
+		}
+	}
+
+	for hash, old := range before {
+		block, err := chain.GetBlock([]byte(hash))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(block.Hash, old.Hash) || !ComputeTargetForBlock(&block).ValidatePOW() || !block.CheckMerkleRoot() {
+			t.Errorf("block %x changed in the migration", old.Hash)
+		}
+		header, height, err := chain.GetHeader([]byte(hash))
+		if err != nil || height != old.Height || !bytes.Equal(header.Hash(), old.Hash) {
+			t.Errorf("header of block %x: %v", old.Hash, err)
+		}
+		for i, tx := range block.Transactions {
+			if !bytes.Equal(tx.ID, old.Transactions[i].ID) || tx.CheckID() != nil {
+				t.Errorf("transaction %x changed in the migration", old.Transactions[i].ID)
+			}
+		}
+	}
+	if blocks := len(chain.GetBlocksHashes()); blocks != 3 {
+		t.Errorf("%d blocks reachable from the tip after the migration, want 3", blocks)
+	}
+
+	unspent := chain.FindUTXO()
+	if len(unspent) != len(unspentBefore) {
+		t.Errorf("%d transactions with unspent outputs after the migration, %d before", len(unspent), len(unspentBefore))
+	}
+	for txid, outs := range unspentBefore {
+		if !bytes.Equal(unspent[txid].SerializeOutputs(), outs.SerializeOutputs()) {
+			t.Errorf("unspent outputs of %s changed in the migration", txid)
+		}
+	}
+
+	if count := chain.MigrateStorage(); count != 0 {
+		t.Errorf("second migration wrote %d values", count)
+	}
+}
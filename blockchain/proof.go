@@ -23,15 +23,12 @@ func ComputeTargetForBlock(b *Block) *POW{
 	target.Lsh(target, uint(256 - DIFFICULTY_BITS))
 	return &POW{b, target}
 }
-func (pow *POW)AssembleBlockDataAndReturnByteRep(nonce int) []byte{
-	blockData := bytes.Join([][]byte{
-			pow.Block.PrevHash,
-			pow.Block.HashTransactions(),
-			UtilConvertIntToByteRep(int64(nonce)),
-			UtilConvertIntToByteRep(int64(DIFFICULTY_BITS)),
-	}, []byte{})
 
-	return blockData
+// AssembleBlockDataAndReturnByteRep returns the header data hashed with the given nonce
+func (pow *POW)AssembleBlockDataAndReturnByteRep(nonce int) []byte{
+	header := pow.Block.BlockHeader
+	header.Nonce = nonce
+	return header.POWData()
 }
 
 func UtilConvertIntToByteRep(num int64) []byte{
@@ -63,11 +60,19 @@ func (pow *POW) RunPOW() (int, []byte){
 	return nonce, hash[:]
 }
 
+// ValidatePOW checks that the header hashes to the block's hash and meets the target.
+// It only reads the header, CheckMerkleRoot ties the transactions to it
 func (pow *POW) ValidatePOW() bool{
 	var intRepOfHash big.Int
 
+	if pow.Block.Bits != DIFFICULTY_BITS{
+		return false
+	}
 	data := pow.AssembleBlockDataAndReturnByteRep(pow.Block.Nonce)
 	hash := sha256.Sum256(data)
+	if !bytes.Equal(hash[:], pow.Block.Hash){
+		return false
+	}
 
 	intRepOfHash.SetBytes(hash[:]) 
 	return intRepOfHash.Cmp(pow.Target) == -1
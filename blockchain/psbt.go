@@ -0,0 +1,226 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+
+	"main.go/codec"
+	"main.go/wallet"
+)
+
+// PartialTx is a transaction collecting signatures, possibly from keys on machines without
+// the chain: the unsigned transaction and, for each input, the output it spends and the
+// signatures collected so far
+type PartialTx struct {
+	Tx     Transaction
+	Inputs []PartialInput
+}
+
+// PartialInput holds what signing and finalizing one input needs. PubKeys and Sigs are
+// parallel, one signature per key
+type PartialInput struct {
+	PrevOut TxOutputs
+	PubKeys [][]byte
+	Sigs    [][]byte
+}
+
+// NewPartialTx wraps the unsigned tx with the outputs its inputs spend
+func (chain *BlockChain) NewPartialTx(tx *Transaction) (*PartialTx, error) {
+	if tx.IsCoinbaseTxn() {
+		return nil, errors.New("coinbase transactions are not signed")
+	}
+	p := &PartialTx{Tx: *tx}
+	for i := range p.Tx.Vin {
+		in := &p.Tx.Vin[i]
+		prevTx, err := chain.FindTrxById(in.TXID)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %s", i, err)
+		}
+		if in.Vout < 0 || in.Vout >= len(prevTx.Vout) {
+			return nil, fmt.Errorf("input %d: output %d does not exist", i, in.Vout)
+		}
+		// signatures go in the container until the transaction is finalized
+		in.Sig, in.Sigs = nil, nil
+		p.Inputs = append(p.Inputs, PartialInput{PrevOut: prevTx.Vout[in.Vout]})
+	}
+	return p, nil
+}
+
+// addSig records the signature of pubKey for input inId, replacing an earlier one
+func (p *PartialTx) addSig(inId int, pubKey, sig []byte) {
+	input := &p.Inputs[inId]
+	for i, key := range input.PubKeys {
+		if bytes.Equal(key, pubKey) {
+			input.Sigs[i] = sig
+			return
+		}
+	}
+	input.PubKeys = append(input.PubKeys, pubKey)
+	input.Sigs = append(input.Sigs, sig)
+}
+
+func (p *PartialTx) redeemScript(inId int) (*RedeemScript, error) {
+	if p.Inputs[inId].PrevOut.Kind != OutputScriptHash {
+		return nil, nil
+	}
+	in := p.Tx.Vin[inId]
+	if !bytes.Equal(wallet.PubKeyHash(in.Redeem), p.Inputs[inId].PrevOut.PubKeyHash) {
+		return nil, fmt.Errorf("input %d: redeem script does not match the output", inId)
+	}
+	script, err := DeserializeScript(in.Redeem)
+	if err != nil {
+		return nil, err
+	}
+	if script.Type != ScriptMultisig {
+		return nil, fmt.Errorf("input %d: only multisig scripts can be signed partially", inId)
+	}
+	return script, nil
+}
+
+// Sign signs every input privKey can unlock under hashType and returns how many it signed
+func (p *PartialTx) Sign(privKey ecdsa.PrivateKey, hashType byte) (int, error) {
+	pubKey := append(privKey.X.Bytes(), privKey.Y.Bytes()...)
+	signed := 0
+	for inId, input := range p.Inputs {
+		switch input.PrevOut.Kind {
+		case OutputPubKeyHash:
+			if !bytes.Equal(wallet.PubKeyHash(pubKey), input.PrevOut.PubKeyHash) {
+				continue
+			}
+		case OutputScriptHash:
+			script, err := p.redeemScript(inId)
+			if err != nil {
+				return signed, err
+			}
+			if script.KeyIndex(pubKey) < 0 {
+				continue
+			}
+		default:
+			continue
+		}
+		// signInput panics on a hash type that does not apply to the input
+		if _, err := p.Tx.SignatureHash(inId, input.PrevOut, hashType); err != nil {
+			return signed, err
+		}
+		p.addSig(inId, pubKey, p.Tx.signInput(privKey, inId, input.PrevOut, hashType))
+		signed++
+	}
+	return signed, nil
+}
+
+// Combine adds the signatures of other, a container of the same transaction
+func (p *PartialTx) Combine(other *PartialTx) error {
+	// the IDs they carry are not trusted, the transactions themselves must match
+	if !bytes.Equal(p.Tx.HashTx(), other.Tx.HashTx()) || len(p.Inputs) != len(other.Inputs) {
+		return errors.New("partially signed transactions of different transactions")
+	}
+	for inId, input := range other.Inputs {
+		for i, pubKey := range input.PubKeys {
+			p.addSig(inId, pubKey, input.Sigs[i])
+		}
+	}
+	return nil
+}
+
+// Signatures returns how many valid signatures input inId has and how many it needs
+func (p *PartialTx) Signatures(inId int) (int, int) {
+	input := p.Inputs[inId]
+	need := 1
+	if script, err := p.redeemScript(inId); err == nil && script != nil {
+		need = script.Required
+	}
+	have := 0
+	for i, pubKey := range input.PubKeys {
+		if p.Tx.checkSig(inId, input.PrevOut, pubKey, input.Sigs[i]) {
+			have++
+		}
+	}
+	return have, need
+}
+
+// Finalize returns the signed transaction once every input has enough valid signatures
+// and its ID matches it
+func (p *PartialTx) Finalize() (*Transaction, error) {
+	tx := p.Tx
+	tx.Vin = append([]TxInputs{}, p.Tx.Vin...)
+	for inId, input := range p.Inputs {
+		in := &tx.Vin[inId]
+		switch input.PrevOut.Kind {
+		case OutputPubKeyHash:
+			for i, pubKey := range input.PubKeys {
+				if bytes.Equal(wallet.PubKeyHash(pubKey), input.PrevOut.PubKeyHash) &&
+					p.Tx.checkSig(inId, input.PrevOut, pubKey, input.Sigs[i]) {
+					in.PubKey, in.Sig = pubKey, input.Sigs[i]
+					break
+				}
+			}
+			if len(in.Sig) == 0 {
+				return nil, fmt.Errorf("input %d is not signed", inId)
+			}
+		case OutputScriptHash:
+			script, err := p.redeemScript(inId)
+			if err != nil {
+				return nil, err
+			}
+			in.Sigs = make([][]byte, len(script.PubKeys))
+			count := 0
+			for i, pubKey := range input.PubKeys {
+				keyIdx := script.KeyIndex(pubKey)
+				if keyIdx < 0 || count == script.Required || !p.Tx.checkSig(inId, input.PrevOut, pubKey, input.Sigs[i]) {
+					continue
+				}
+				in.Sigs[keyIdx] = input.Sigs[i]
+				count++
+			}
+			if count < script.Required {
+				return nil, fmt.Errorf("input %d has %d of %d signatures", inId, count, script.Required)
+			}
+		default:
+			return nil, fmt.Errorf("input %d spends an output that cannot be signed", inId)
+		}
+	}
+	if err := tx.CheckID(); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// Serialize returns the canonical encoding of the container, see docs/serialization.md
+func (p *PartialTx) Serialize() []byte {
+	w := codec.NewWriter()
+	p.Tx.encode(w)
+	w.Uvarint(uint64(len(p.Inputs)))
+	for i := range p.Inputs {
+		p.Inputs[i].PrevOut.encode(w)
+		w.BytesList(p.Inputs[i].PubKeys)
+		w.BytesList(p.Inputs[i].Sigs)
+	}
+	return w.Data()
+}
+
+func ParsePartialTx(data []byte) (*PartialTx, error) {
+	r, err := codec.NewReader(data)
+	if err != nil {
+		return nil, err
+	}
+	p := &PartialTx{Tx: decodeTx(r)}
+	count := r.Count()
+	for i := 0; i < count && r.Err() == nil; i++ {
+		input := PartialInput{PrevOut: decodeOutput(r), PubKeys: r.BytesList(), Sigs: r.BytesList()}
+		p.Inputs = append(p.Inputs, input)
+	}
+	if err := r.Done(); err != nil {
+		return nil, err
+	}
+	if len(p.Inputs) != len(p.Tx.Vin) {
+		return nil, errors.New("partially signed transaction needs one entry per input")
+	}
+	for _, input := range p.Inputs {
+		if len(input.PubKeys) != len(input.Sigs) {
+			return nil, errors.New("partially signed transaction needs one signature per key")
+		}
+	}
+	return p, nil
+}
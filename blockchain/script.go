@@ -0,0 +1,160 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+
+	"main.go/codec"
+	"main.go/wallet"
+)
+
+const (
+	// ScriptMultisig is spendable with signatures from Required of the listed PubKeys
+	ScriptMultisig = iota + 1
+	// ScriptHTLC is spendable by Recipient with the preimage of SecretHash,
+	// or by Refund once LockTime has passed
+	ScriptHTLC
+)
+
+// SecretSize is the length of an HTLC secret
+const SecretSize = 32
+
+// MaxMultisigKeys caps the number of keys in one multisig script
+const MaxMultisigKeys = 15
+
+// RedeemScript is the spending condition behind a script hash output.
+// Only its hash is stored in the output, the spender reveals the whole script in TxInputs.Redeem
+type RedeemScript struct {
+	Type     int
+	Required int
+	PubKeys  [][]byte
+
+	SecretHash []byte
+	Recipient  []byte
+	Refund     []byte
+	LockTime   int64
+}
+
+func NewMultisigScript(required int, pubKeys [][]byte) (*RedeemScript, error) {
+	if len(pubKeys) == 0 || len(pubKeys) > MaxMultisigKeys {
+		return nil, errors.New("a multisig script needs between 1 and 15 public keys")
+	}
+	if required < 1 || required > len(pubKeys) {
+		return nil, errors.New("required signatures must be between 1 and the number of keys")
+	}
+	for i, key := range pubKeys {
+		for _, other := range pubKeys[i+1:] {
+			if bytes.Equal(key, other) {
+				return nil, errors.New("duplicate public key in multisig script")
+			}
+		}
+	}
+	return &RedeemScript{Type: ScriptMultisig, Required: required, PubKeys: pubKeys}, nil
+}
+
+// NewHTLCScript locks funds to recipient, who must reveal the preimage of secretHash,
+// with a refund to refund once lockTime (a height or unix time, like Transaction.LockTime) has passed
+func NewHTLCScript(secretHash, recipient, refund []byte, lockTime int64) (*RedeemScript, error) {
+	if len(secretHash) != sha256.Size {
+		return nil, errors.New("secret hash must be a sha256 digest")
+	}
+	if lockTime <= 0 {
+		return nil, errors.New("an HTLC needs a refund lock time")
+	}
+	return &RedeemScript{Type: ScriptHTLC, SecretHash: secretHash, Recipient: recipient, Refund: refund, LockTime: lockTime}, nil
+}
+
+func (script RedeemScript) Serialize() []byte {
+	w := codec.NewWriter()
+	script.encode(w)
+	return w.Data()
+}
+
+// DeserializeScript decodes a script written by Serialize. Scripts of outputs created
+// before the canonical format are gob encoded and still accepted, since only their hash is on chain
+func DeserializeScript(data []byte) (*RedeemScript, error) {
+	var script RedeemScript
+	if !codec.IsCanonical(data) {
+		decoder := gob.NewDecoder(bytes.NewReader(data))
+		if err := decoder.Decode(&script); err != nil {
+			return nil, err
+		}
+		return &script, nil
+	}
+	r, err := codec.NewReader(data)
+	if err != nil {
+		return nil, err
+	}
+	script = decodeScript(r)
+	if err := r.Done(); err != nil {
+		return nil, err
+	}
+	if script.Type != ScriptMultisig && script.Type != ScriptHTLC {
+		return nil, errors.New("unknown script type")
+	}
+	return &script, nil
+}
+
+// Hash is what a script hash output is locked to
+func (script RedeemScript) Hash() []byte {
+	return wallet.PubKeyHash(script.Serialize())
+}
+
+func (script RedeemScript) Address() []byte {
+	return wallet.ScriptAddress(script.Hash())
+}
+
+// KeyIndex returns the position of pubKey in the script, or -1
+func (script RedeemScript) KeyIndex(pubKey []byte) int {
+	for i, key := range script.PubKeys {
+		if bytes.Equal(key, pubKey) {
+			return i
+		}
+	}
+	return -1
+}
+
+// FindScriptOutput returns the index of the output of tx locked to the serialized script redeem, or -1
+func (tx *Transaction) FindScriptOutput(redeem []byte) int {
+	scriptHash := wallet.PubKeyHash(redeem)
+	for idx, out := range tx.Vout {
+		if out.Kind == OutputScriptHash && bytes.Equal(out.PubKeyHash, scriptHash) {
+			return idx
+		}
+	}
+	return -1
+}
+
+// CountSigs returns how many signature slots of a multisig input are filled
+func (in *TxInputs) CountSigs() int {
+	count := 0
+	for _, sig := range in.Sigs {
+		if len(sig) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// verifyHTLC checks the redeem path (recipient key and secret) or, without a secret,
+// the refund path, which also needs the spending transaction to be locked past script.LockTime
+func (tx *Transaction) verifyHTLC(inId int, prevOut TxOutputs, script *RedeemScript) bool {
+	in := tx.Vin[inId]
+	if len(in.Preimage) > 0 {
+		secretHash := sha256.Sum256(in.Preimage)
+		if !bytes.Equal(secretHash[:], script.SecretHash) || !in.UsesKey(script.Recipient) {
+			return false
+		}
+		return tx.checkSig(inId, prevOut, in.PubKey, in.Sig)
+	}
+	if !in.UsesKey(script.Refund) {
+		return false
+	}
+	sameKind := (tx.LockTime < LockTimeThreshold) == (script.LockTime < LockTimeThreshold)
+	if !sameKind || tx.LockTime < script.LockTime {
+		return false
+	}
+	return tx.checkSig(inId, prevOut, in.PubKey, in.Sig)
+}
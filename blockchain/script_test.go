@@ -0,0 +1,290 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+
+	"main.go/wallet"
+)
+
+// multisigSpend returns a spend of an output locked to script, signed by signers
+func multisigSpend(t *testing.T, script *RedeemScript, signers ...*wallet.Wallet) (*Transaction, map[string]Transaction) {
+	t.Helper()
+	prev, prevs := fundingTx(TxOutputs{Value: 10, PubKeyHash: script.Hash(), Kind: OutputScriptHash})
+	tx := spendTx(prev, TxInputs{Redeem: script.Serialize(), Sigs: make([][]byte, len(script.PubKeys))}, 0)
+	for _, signer := range signers {
+		tx.Sign(signer.PrivKey, prevs)
+	}
+	return tx, prevs
+}
+
+func TestMultisigVerify(t *testing.T) {
+	w := []*wallet.Wallet{wallet.MakeWallet(), wallet.MakeWallet(), wallet.MakeWallet()}
+	keys := [][]byte{w[0].PubKey, w[1].PubKey, w[2].PubKey}
+
+	tests := []struct {
+		name     string
+		required int
+		keys     [][]byte
+		signers  []*wallet.Wallet
+		valid    bool
+	}{
+		{"1 of 1", 1, keys[:1], w[:1], true},
+		{"2 of 3, first and second", 2, keys, w[:2], true},
+		{"2 of 3, first and third", 2, keys, []*wallet.Wallet{w[0], w[2]}, true},
+		{"2 of 3, second and third", 2, keys, w[1:], true},
+		{"2 of 3, all three", 2, keys, w, true},
+		{"3 of 3", 3, keys, w, true},
+		{"2 of 3, one signature", 2, keys, w[2:], false},
+		{"3 of 3, two signatures", 3, keys, w[:2], false},
+		{"2 of 2, no signature", 2, keys[:2], nil, false},
+		{"2 of 2, outside key", 2, keys[:2], []*wallet.Wallet{w[0], w[2]}, false},
+	}
+	for _, test := range tests {
+		script, err := NewMultisigScript(test.required, test.keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, prevs := multisigSpend(t, script, test.signers...)
+		if got := tx.Verify(prevs); got != test.valid {
+			t.Errorf("%s: Verify = %v, want %v", test.name, got, test.valid)
+		}
+		if got := tx.IsFullySigned(); got != test.valid {
+			t.Errorf("%s: IsFullySigned = %v, want %v", test.name, got, test.valid)
+		}
+	}
+}
+
+// Each signature must sit in the slot of its key, and the slots must match the keys
+func TestMultisigSignatureOrder(t *testing.T) {
+	w := []*wallet.Wallet{wallet.MakeWallet(), wallet.MakeWallet(), wallet.MakeWallet()}
+	script, err := NewMultisigScript(2, [][]byte{w[0].PubKey, w[1].PubKey, w[2].PubKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, prevs := multisigSpend(t, script, w[0], w[1])
+	if !tx.Verify(prevs) {
+		t.Fatal("signed spend does not verify")
+	}
+
+	swapped := copyTx(t, tx)
+	swapped.Vin[0].Sigs[0], swapped.Vin[0].Sigs[1] = swapped.Vin[0].Sigs[1], swapped.Vin[0].Sigs[0]
+	if swapped.Verify(prevs) {
+		t.Error("signatures in each other's slots verify")
+	}
+	moved := copyTx(t, tx)
+	moved.Vin[0].Sigs[1], moved.Vin[0].Sigs[2] = nil, moved.Vin[0].Sigs[1]
+	if moved.Verify(prevs) {
+		t.Error("signature in the slot of another key verifies")
+	}
+	short := copyTx(t, tx)
+	short.Vin[0].Sigs = short.Vin[0].Sigs[:2]
+	if short.Verify(prevs) {
+		t.Error("spend with fewer slots than keys verifies")
+	}
+	long := copyTx(t, tx)
+	long.Vin[0].Sigs = append(long.Vin[0].Sigs, nil)
+	if long.Verify(prevs) {
+		t.Error("spend with more slots than keys verifies")
+	}
+}
+
+// The revealed redeem script must be the one the output is locked to
+func TestMultisigRedeemMismatch(t *testing.T) {
+	w := []*wallet.Wallet{wallet.MakeWallet(), wallet.MakeWallet(), wallet.MakeWallet()}
+	script, err := NewMultisigScript(2, [][]byte{w[0].PubKey, w[1].PubKey, w[2].PubKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	others := map[string][][]byte{
+		"fewer required": {w[0].PubKey, w[1].PubKey, w[2].PubKey},
+		"reordered keys": {w[1].PubKey, w[0].PubKey, w[2].PubKey},
+		"fewer keys":     {w[0].PubKey, w[1].PubKey},
+	}
+	for name, keys := range others {
+		required := 2
+		if name == "fewer required" {
+			required = 1
+		}
+		other, err := NewMultisigScript(required, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// an output locked to script, spent revealing other and signed under it
+		prev, prevs := fundingTx(TxOutputs{Value: 10, PubKeyHash: script.Hash(), Kind: OutputScriptHash})
+		tx := spendTx(prev, TxInputs{Redeem: other.Serialize(), Sigs: make([][]byte, len(keys))}, 0)
+		tx.Sign(w[0].PrivKey, prevs)
+		tx.Sign(w[1].PrivKey, prevs)
+		if tx.Vin[0].CountSigs() < required {
+			t.Fatalf("%s: only %d signatures", name, tx.Vin[0].CountSigs())
+		}
+		if tx.Verify(prevs) {
+			t.Errorf("%s: spend revealing another script verifies", name)
+		}
+	}
+}
+
+func TestNewMultisigScriptRejects(t *testing.T) {
+	w := wallet.MakeWallet()
+	key := w.PubKey
+	tooMany := make([][]byte, MaxMultisigKeys+1)
+	for i := range tooMany {
+		tooMany[i] = wallet.MakeWallet().PubKey
+	}
+	tests := map[string]struct {
+		required int
+		keys     [][]byte
+	}{
+		"no keys":            {1, nil},
+		"too many keys":      {1, tooMany},
+		"none required":      {0, [][]byte{key}},
+		"more than the keys": {2, [][]byte{key}},
+		"duplicate key":      {1, [][]byte{key, key}},
+	}
+	for name, test := range tests {
+		if _, err := NewMultisigScript(test.required, test.keys); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+// shortKeyWallet makes a wallet whose public key has a coordinate below 2^248, which the
+// wallet writes a byte short
+func shortKeyWallet(short func(x, y *big.Int) bool) *wallet.Wallet {
+	for {
+		w := wallet.MakeWallet()
+		if short(w.PrivKey.X, w.PrivKey.Y) {
+			return w
+		}
+	}
+}
+
+// Keys a byte short verify whichever coordinate lost its leading zero
+func TestVerifyShortKeys(t *testing.T) {
+	shortX := shortKeyWallet(func(x, y *big.Int) bool { return x.BitLen() <= 248 && y.BitLen() > 248 })
+	shortY := shortKeyWallet(func(x, y *big.Int) bool { return y.BitLen() <= 248 && x.BitLen() > 248 })
+	full := shortKeyWallet(func(x, y *big.Int) bool { return x.BitLen() > 248 && y.BitLen() > 248 })
+
+	for name, w := range map[string]*wallet.Wallet{"short x": shortX, "short y": shortY} {
+		if len(w.PubKey) != 63 {
+			t.Fatalf("%s: %d byte key", name, len(w.PubKey))
+		}
+		prev, prevs := fundingTx(TxOutputs{Value: 10, PubKeyHash: wallet.PubKeyHash(w.PubKey)})
+		tx := spendTx(prev, TxInputs{}, 0)
+		tx.Sign(w.PrivKey, prevs)
+		if !tx.Verify(prevs) {
+			t.Errorf("%s: pubkey hash spend does not verify", name)
+		}
+	}
+
+	script, err := NewMultisigScript(2, [][]byte{shortY.PubKey, full.PubKey, shortX.PubKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, prevs := multisigSpend(t, script, shortY, shortX)
+	if !tx.Verify(prevs) {
+		t.Error("multisig spend by short keys does not verify")
+	}
+
+	padded := append(make([]byte, 64-len(shortY.PubKey)), shortY.PubKey...)
+	for name, key := range map[string][]byte{"off the curve": full.PubKey[1:], "too long": append(padded, 0), "empty": nil} {
+		if verifySig(key, make([]byte, 32), make([]byte, 64)) {
+			t.Errorf("%s: key accepted", name)
+		}
+	}
+}
+
+// htlcContract returns an output locked to an HTLC paying recipient for secret, refunded to
+// refund from height 50
+func htlcContract(t *testing.T, secret []byte, recipient, refund *wallet.Wallet) (*RedeemScript, *Transaction, map[string]Transaction) {
+	t.Helper()
+	secretHash := sha256.Sum256(secret)
+	script, err := NewHTLCScript(secretHash[:], wallet.PubKeyHash(recipient.PubKey), wallet.PubKeyHash(refund.PubKey), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev, prevs := fundingTx(TxOutputs{Value: 10, PubKeyHash: script.Hash(), Kind: OutputScriptHash})
+	return script, prev, prevs
+}
+
+func TestHTLCClaim(t *testing.T) {
+	recipient, refund := wallet.MakeWallet(), wallet.MakeWallet()
+	secret := bytes.Repeat([]byte{0x5e}, SecretSize)
+	script, prev, prevs := htlcContract(t, secret, recipient, refund)
+
+	tests := []struct {
+		name   string
+		secret []byte
+		signer *wallet.Wallet
+		valid  bool
+	}{
+		{"right secret", secret, recipient, true},
+		{"wrong secret", bytes.Repeat([]byte{0x5f}, SecretSize), recipient, false},
+		{"short secret", secret[:SecretSize-1], recipient, false},
+		{"right secret, refund key", secret, refund, false},
+	}
+	for _, test := range tests {
+		tx, err := NewHTLCSpend(script.Serialize(), prev, 0, string(recipient.Address()), test.secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tx.LockTime != 0 {
+			t.Errorf("%s: claim locked until %d", test.name, tx.LockTime)
+		}
+		tx.Sign(test.signer.PrivKey, prevs)
+		if got := tx.Verify(prevs); got != test.valid {
+			t.Errorf("%s: Verify = %v, want %v", test.name, got, test.valid)
+		}
+	}
+}
+
+// The refund must be locked to the contract's lock time, so it cannot be mined before it
+func TestHTLCRefund(t *testing.T) {
+	recipient, refund := wallet.MakeWallet(), wallet.MakeWallet()
+	script, prev, prevs := htlcContract(t, bytes.Repeat([]byte{0x5e}, SecretSize), recipient, refund)
+
+	tx, err := NewHTLCSpend(script.Serialize(), prev, 0, string(refund.Address()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.LockTime != script.LockTime {
+		t.Fatalf("refund locked until %d, want %d", tx.LockTime, script.LockTime)
+	}
+	tx.Sign(refund.PrivKey, prevs)
+	if !tx.Verify(prevs) {
+		t.Error("refund locked to the contract's lock time does not verify")
+	}
+	if tx.IsFinal(49, 0) {
+		t.Error("refund final before the lock time")
+	}
+	if !tx.IsFinal(50, 0) || !tx.IsFinal(51, 0) {
+		t.Error("refund not final from the lock time")
+	}
+
+	tests := []struct {
+		name     string
+		lockTime int64
+		signer   *wallet.Wallet
+		valid    bool
+	}{
+		{"after the lock time", 60, refund, true},
+		{"before the lock time", 49, refund, false},
+		{"not locked", 0, refund, false},
+		{"locked to a time instead of a height", LockTimeThreshold + 50, refund, false},
+		{"recipient key", 50, recipient, false},
+	}
+	for _, test := range tests {
+		tx, err := NewHTLCSpend(script.Serialize(), prev, 0, string(refund.Address()), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.LockTime = test.lockTime
+		tx.ID = tx.IDHash()
+		tx.Sign(test.signer.PrivKey, prevs)
+		if got := tx.Verify(prevs); got != test.valid {
+			t.Errorf("%s: Verify = %v, want %v", test.name, got, test.valid)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"main.go/codec"
+)
+
+// Canonical encodings of the chain's data structures, see docs/serialization.md.
+// Parse functions accept only the canonical format, so data from peers is never handed
+// to gob. Blocks and UTXO entries read from the database go through parseStoredBlock and
+// parseStoredOutputs, which also accept the gob encoding written before the canonical
+// format so existing databases keep loading; MigrateStorage rewrites them
+
+func (in *TxInputs) encode(w *codec.Writer) {
+	w.Bytes(in.TXID)
+	w.Varint(int64(in.Vout))
+	w.Bytes(in.Sig)
+	w.Bytes(in.PubKey)
+	w.Bytes(in.Redeem)
+	w.BytesList(in.Sigs)
+	w.Bytes(in.Preimage)
+	w.Uvarint(uint64(in.Sequence))
+}
+
+func decodeInput(r *codec.Reader) TxInputs {
+	var in TxInputs
+	in.TXID = r.Bytes()
+	in.Vout = r.Int()
+	in.Sig = r.Bytes()
+	in.PubKey = r.Bytes()
+	in.Redeem = r.Bytes()
+	in.Sigs = r.BytesList()
+	in.Preimage = r.Bytes()
+	in.Sequence = uint32(r.Uvarint())
+	return in
+}
+
+func (out *TxOutputs) encode(w *codec.Writer) {
+	w.Varint(int64(out.Value))
+	w.Varint(int64(out.Kind))
+	w.Bytes(out.PubKeyHash)
+	w.Bytes(out.Data)
+}
+
+func decodeOutput(r *codec.Reader) TxOutputs {
+	var out TxOutputs
+	out.Value = r.Int()
+	out.Kind = r.Int()
+	out.PubKeyHash = r.Bytes()
+	out.Data = r.Bytes()
+	return out
+}
+
+func (tx *Transaction) encode(w *codec.Writer) {
+	w.Uvarint(uint64(tx.Version))
+	w.Bytes(tx.ID)
+	w.Uvarint(uint64(len(tx.Vin)))
+	for i := range tx.Vin {
+		tx.Vin[i].encode(w)
+	}
+	w.Uvarint(uint64(len(tx.Vout)))
+	for i := range tx.Vout {
+		tx.Vout[i].encode(w)
+	}
+	w.Varint(tx.LockTime)
+}
+
+func decodeTx(r *codec.Reader) Transaction {
+	var tx Transaction
+	tx.Version = int(r.Uvarint())
+	tx.ID = r.Bytes()
+	count := r.Count()
+	for i := 0; i < count && r.Err() == nil; i++ {
+		tx.Vin = append(tx.Vin, decodeInput(r))
+	}
+	count = r.Count()
+	for i := 0; i < count && r.Err() == nil; i++ {
+		tx.Vout = append(tx.Vout, decodeOutput(r))
+	}
+	tx.LockTime = r.Varint()
+	return tx
+}
+
+// ParseTrx decodes a transaction written by SerializeTx
+func ParseTrx(data []byte) (Transaction, error) {
+	r, err := codec.NewReader(data)
+	if err != nil {
+		return Transaction{}, err
+	}
+	tx := decodeTx(r)
+	return tx, r.Done()
+}
+
+func (b *Block) encode(w *codec.Writer) {
+	b.BlockHeader.encode(w)
+	w.Bytes(b.Hash)
+	w.Varint(int64(b.Height))
+	w.Uvarint(uint64(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		tx.encode(w)
+	}
+}
+
+// gobBlock is the shape blocks had while stored with gob
+type gobBlock struct {
+	PrevHash     []byte
+	Transactions []*Transaction
+	Hash         []byte
+	Nonce        int
+	Timestamp    int64
+	Height       int
+}
+
+// parseStoredBlock decodes a block read from the database, which may still be gob encoded.
+// Blocks stored before headers existed, gob or format 1, come back as version 0 blocks
+// with their merkle root filled in
+func parseStoredBlock(data []byte) (*Block, error) {
+	if codec.IsCanonical(data) {
+		return ParseBlock(data)
+	}
+	var old gobBlock
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&old); err != nil {
+		return nil, err
+	}
+	block := Block{
+		BlockHeader:  BlockHeader{PrevHash: old.PrevHash, Timestamp: old.Timestamp, Nonce: old.Nonce},
+		Transactions: old.Transactions,
+		Hash:         old.Hash,
+		Height:       old.Height,
+	}
+	block.setLegacyHeader()
+	return &block, nil
+}
+
+// ParseBlock decodes a block written by Serialize in any canonical format version
+func ParseBlock(data []byte) (*Block, error) {
+	var block Block
+	r, err := codec.NewReader(data)
+	if err != nil {
+		return nil, err
+	}
+	if r.Version() == 1 {
+		block.PrevHash = r.Bytes()
+		block.Transactions = decodeTxs(r)
+		block.Hash = r.Bytes()
+		block.Nonce = r.Int()
+		block.Timestamp = r.Varint()
+		block.Height = r.Int()
+		block.setLegacyHeader()
+		return &block, r.Done()
+	}
+	block.BlockHeader = decodeHeader(r)
+	block.Hash = r.Bytes()
+	block.Height = r.Int()
+	block.Transactions = decodeTxs(r)
+	return &block, r.Done()
+}
+
+func decodeTxs(r *codec.Reader) []*Transaction {
+	var txs []*Transaction
+	count := r.Count()
+	for i := 0; i < count && r.Err() == nil; i++ {
+		tx := decodeTx(r)
+		txs = append(txs, &tx)
+	}
+	return txs
+}
+
+func (block *Block) setLegacyHeader() {
+	block.Version = 0
+	block.Bits = DIFFICULTY_BITS
+	block.MerkleRoot = block.HashTransactions()
+}
+
+// ParseOutputs decodes an entry of the UTXO set written by SerializeOutputs
+func ParseOutputs(data []byte) (OutputsArr, error) {
+	var outs OutputsArr
+	r, err := codec.NewReader(data)
+	if err != nil {
+		return outs, err
+	}
+	count := r.Count()
+	for i := 0; i < count && r.Err() == nil; i++ {
+		outs.Add(r.Int(), decodeOutput(r))
+	}
+	return outs, r.Done()
+}
+
+// parseStoredOutputs decodes a UTXO set entry read from the database, which may still be gob encoded
+func parseStoredOutputs(data []byte) (OutputsArr, error) {
+	if codec.IsCanonical(data) {
+		return ParseOutputs(data)
+	}
+	var outs OutputsArr
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&outs)
+	return outs, err
+}
+
+func (script *RedeemScript) encode(w *codec.Writer) {
+	w.Varint(int64(script.Type))
+	switch script.Type {
+	case ScriptMultisig:
+		w.Varint(int64(script.Required))
+		w.BytesList(script.PubKeys)
+	case ScriptHTLC:
+		w.Bytes(script.SecretHash)
+		w.Bytes(script.Recipient)
+		w.Bytes(script.Refund)
+		w.Varint(script.LockTime)
+	}
+}
+
+func decodeScript(r *codec.Reader) RedeemScript {
+	var script RedeemScript
+	script.Type = r.Int()
+	switch script.Type {
+	case ScriptMultisig:
+		script.Required = r.Int()
+		script.PubKeys = r.BytesList()
+	case ScriptHTLC:
+		script.SecretHash = r.Bytes()
+		script.Recipient = r.Bytes()
+		script.Refund = r.Bytes()
+		script.LockTime = r.Varint()
+	}
+	return script
+}
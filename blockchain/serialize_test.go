@@ -0,0 +1,356 @@
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"main.go/codec"
+	"main.go/wallet"
+)
+
+// baselineChain is the database of a chain of three blocks mined by the first version of
+// the program, one "key value" line in hex per entry. The baseline could not mine spends,
+// so every block holds only its coinbase
+const baselineChain = "testdata/baseline_chain.hex"
+
+// readBaselineChain returns the entries of baselineChain by key
+func readBaselineChain(t *testing.T) map[string][]byte {
+	t.Helper()
+	file, err := os.Open(baselineChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	entries := make(map[string][]byte)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			t.Fatalf("bad line %q", scanner.Text())
+		}
+		key, err := hex.DecodeString(fields[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := hex.DecodeString(fields[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[string(key)] = value
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+// baselineBlocks parses the gob blocks of baselineChain, keyed by hash
+func baselineBlocks(t *testing.T) map[string]*Block {
+	t.Helper()
+	blocks := make(map[string]*Block)
+	for key, value := range readBaselineChain(t) {
+		if key == "lh" || strings.HasPrefix(key, string(utxoPrefix)) {
+			continue
+		}
+		block, err := parseStoredBlock(value)
+		if err != nil {
+			t.Fatalf("block %x: %v", key, err)
+		}
+		if !bytes.Equal(block.Hash, []byte(key)) {
+			t.Fatalf("block stored under %x has hash %x", key, block.Hash)
+		}
+		blocks[key] = block
+	}
+	return blocks
+}
+
+// Blocks gob encoded by the baseline keep their proof of work, merkle root and transaction
+// IDs, which all depend on hashing version 0 transactions exactly as the baseline did
+func TestParseBaselineBlocks(t *testing.T) {
+	blocks := baselineBlocks(t)
+	if len(blocks) != 3 {
+		t.Fatalf("%d blocks in %s, want 3", len(blocks), baselineChain)
+	}
+	for _, block := range blocks {
+		if block.Version != 0 {
+			t.Errorf("block %x: version %d, want 0", block.Hash, block.Version)
+		}
+		if !ComputeTargetForBlock(block).ValidatePOW() {
+			t.Errorf("block %x: proof of work does not validate", block.Hash)
+		}
+		if !block.CheckMerkleRoot() {
+			t.Errorf("block %x: merkle root does not match", block.Hash)
+		}
+		for _, tx := range block.Transactions {
+			if tx.Version != 0 {
+				t.Errorf("tx %x: version %d, want 0", tx.ID, tx.Version)
+			}
+			if err := tx.CheckID(); err != nil {
+				t.Errorf("block %x: %v", block.Hash, err)
+			}
+			if err := tx.CheckInBlock(block.Version); err != nil {
+				t.Errorf("tx %x: %v", tx.ID, err)
+			}
+		}
+		if len(block.PrevHash) > 0 && blocks[string(block.PrevHash)] == nil {
+			t.Errorf("block %x: parent %x missing", block.Hash, block.PrevHash)
+		}
+	}
+}
+
+// A version 0 transaction cannot carry fields added later, its hash would not cover them
+func TestLegacyFieldsRejected(t *testing.T) {
+	tx := Transaction{
+		Vin:  []TxInputs{{TXID: bytes.Repeat([]byte{0x11}, 32), Vout: 0, Sig: []byte{1}, PubKey: []byte{2}}},
+		Vout: []TxOutputs{{Value: 10, PubKeyHash: bytes.Repeat([]byte{0xaa}, 20)}},
+	}
+	if err := tx.CheckInBlock(0); err != nil {
+		t.Fatalf("baseline shaped transaction rejected: %v", err)
+	}
+	changes := map[string]func(tx *Transaction){
+		"lock time": func(tx *Transaction) { tx.LockTime = 5 },
+		"sequence":  func(tx *Transaction) { tx.Vin[0].Sequence = 1 },
+		"redeem":    func(tx *Transaction) { tx.Vin[0].Redeem = []byte{1} },
+		"sigs":      func(tx *Transaction) { tx.Vin[0].Sigs = [][]byte{{1}} },
+		"preimage":  func(tx *Transaction) { tx.Vin[0].Preimage = []byte{1} },
+		"kind":      func(tx *Transaction) { tx.Vout[0].Kind = OutputScriptHash },
+		"data":      func(tx *Transaction) { tx.Vout[0].Data = []byte{1} },
+	}
+	for name, change := range changes {
+		changed := tx
+		changed.Vin = append([]TxInputs{}, tx.Vin...)
+		changed.Vout = append([]TxOutputs{}, tx.Vout...)
+		change(&changed)
+		if bytes.Equal(changed.HashTx(), tx.HashTx()) && changed.CheckInBlock(0) == nil {
+			t.Errorf("%s: version 0 transaction accepted although its hash ignores the field", name)
+		}
+	}
+}
+
+// docsTx is the transaction of the encoding example in docs/serialization.md
+func docsTx() Transaction {
+	return Transaction{
+		Vin: []TxInputs{{TXID: []byte{0xaa, 0xbb}, Vout: 1, Sig: []byte{0x01}, PubKey: []byte{0x02, 0x03}, Sequence: 5}},
+		Vout: []TxOutputs{
+			{Value: 50, PubKeyHash: []byte{0x11, 0x22}},
+			{Kind: OutputData, Data: []byte("hi")},
+		},
+		LockTime: 100,
+		Version:  1,
+	}
+}
+
+func TestDocsVectors(t *testing.T) {
+	tx := docsTx()
+	if got := hex.EncodeToString(tx.SerializeTx()); got != "af0201000102aabb0201010202030000000502640002112200000400026869c801" {
+		t.Errorf("transaction encoding %s", got)
+	}
+	if got := hex.EncodeToString(tx.HashTx()); got != "0fb788950727d6005fc696bfe7202d3dee17ee15204743437ed1293556ecc15d" {
+		t.Errorf("HashTx %s", got)
+	}
+
+	tx.ID = tx.HashTx()
+	block := Block{Transactions: []*Transaction{&tx}}
+	header := BlockHeader{
+		Version:    1,
+		PrevHash:   make([]byte, 32),
+		MerkleRoot: block.HashTransactions(),
+		Timestamp:  1700000000,
+		Bits:       12,
+		Nonce:      7,
+	}
+	if got := hex.EncodeToString(header.Serialize()); got != "af0201200000000000000000000000000000000000000000000000000000000000000000"+
+		"2031bc41a75bc971bdf479565f096c4804da0a16c8e65c20185099675093ddfcf380c49fd50c180e" {
+		t.Errorf("header encoding %s", got)
+	}
+	if got := hex.EncodeToString(header.Hash()); got != "c673ffa3a8a624a877a1d8b236e048fcd705966f130d94503dbd17fb2b55f5c3" {
+		t.Errorf("header hash %s", got)
+	}
+}
+
+// fullTx uses every field of a transaction
+func fullTx() *Transaction {
+	tx := &Transaction{
+		Vin: []TxInputs{
+			{TXID: bytes.Repeat([]byte{0x11}, 32), Vout: 3, Sig: bytes.Repeat([]byte{0x01}, sigLen), PubKey: bytes.Repeat([]byte{0x02}, 64), Sequence: RelativeLockBlocks(2)},
+			{TXID: bytes.Repeat([]byte{0x22}, 32), Redeem: []byte{0xaf, 0x02, 0x00}, Sigs: [][]byte{nil, {0x03}, nil}, Preimage: []byte{0x04}},
+		},
+		Vout: []TxOutputs{
+			{Value: 7, PubKeyHash: bytes.Repeat([]byte{0xaa}, 20)},
+			{Value: 1 << 40, PubKeyHash: bytes.Repeat([]byte{0xbb}, 20), Kind: OutputScriptHash},
+			{Kind: OutputData, Data: []byte("anchor")},
+		},
+		LockTime: -1,
+		Version:  TxVersion,
+	}
+	tx.ID = tx.IDHash()
+	return tx
+}
+
+func TestTransactionRoundTrip(t *testing.T) {
+	tx := fullTx()
+	parsed, err := ParseTrx(tx.SerializeTx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed.SerializeTx(), tx.SerializeTx()) || !bytes.Equal(parsed.HashTx(), tx.HashTx()) {
+		t.Errorf("transaction changed in a round trip:\n%s\n%s", tx.StringRep(), parsed.StringRep())
+	}
+	if len(parsed.Vin[1].Sigs) != 3 || parsed.Vin[1].Sigs[0] != nil {
+		t.Errorf("empty signature slots lost: %x", parsed.Vin[1].Sigs)
+	}
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	coinbase := CoinbaseTx(string(wallet.PubKeyHashAddress(bytes.Repeat([]byte{0xcc}, 20))), "round trip")
+	block := &Block{Transactions: []*Transaction{coinbase, fullTx()}, Height: 4}
+	block.BlockHeader = BlockHeader{Version: BlockVersion, PrevHash: bytes.Repeat([]byte{0x33}, 32), Timestamp: 1700000000, Bits: DIFFICULTY_BITS, Nonce: 9}
+	block.MerkleRoot = block.HashTransactions()
+	block.Hash = block.BlockHeader.Hash()
+
+	data := block.Serialize()
+	if !codec.IsCurrent(data) {
+		t.Fatalf("block not written in the current format: %x", data[:2])
+	}
+	parsed, err := ParseBlock(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed.Serialize(), data) || !bytes.Equal(parsed.BlockHeader.Hash(), block.Hash) || !parsed.CheckMerkleRoot() {
+		t.Error("block changed in a round trip")
+	}
+
+	header, err := DeserializeHeader(block.BlockHeader.Serialize())
+	if err != nil || !bytes.Equal(header.Serialize(), block.BlockHeader.Serialize()) {
+		t.Errorf("header changed in a round trip: %v", err)
+	}
+}
+
+// Format 1 wrote blocks without a header, they come back as version 0 blocks
+func TestParseFormat1Block(t *testing.T) {
+	coinbase := CoinbaseTx(string(wallet.PubKeyHashAddress(bytes.Repeat([]byte{0xcc}, 20))), "format 1")
+	coinbase.Version = 0
+	coinbase.ID = coinbase.IDHash()
+	w := codec.NewWriterVersion(1)
+	w.Bytes(nil)
+	w.Uvarint(1)
+	coinbase.encode(w)
+	w.Bytes([]byte{0x01})
+	w.Varint(5)
+	w.Varint(1600000000)
+	w.Varint(0)
+
+	block, err := ParseBlock(w.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Version != 0 || block.Nonce != 5 || block.Timestamp != 1600000000 || block.Bits != DIFFICULTY_BITS {
+		t.Errorf("format 1 block parsed as %+v", block.BlockHeader)
+	}
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		t.Error("merkle root of a format 1 block not filled in")
+	}
+}
+
+func TestOutputsRoundTrip(t *testing.T) {
+	var outs OutputsArr
+	outs.Add(0, TxOutputs{Value: 5, PubKeyHash: bytes.Repeat([]byte{0xaa}, 20)})
+	outs.Add(2, TxOutputs{Value: 6, PubKeyHash: bytes.Repeat([]byte{0xbb}, 20), Kind: OutputScriptHash})
+	parsed, err := ParseOutputs(outs.SerializeOutputs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Outputs) != 2 || parsed.Index(1) != 2 || parsed.Outputs[1].Value != 6 || parsed.Outputs[1].Kind != OutputScriptHash {
+		t.Errorf("outputs changed in a round trip: %+v", parsed)
+	}
+}
+
+func TestScriptRoundTrip(t *testing.T) {
+	multisig, err := NewMultisigScript(2, [][]byte{bytes.Repeat([]byte{1}, 64), bytes.Repeat([]byte{2}, 64), bytes.Repeat([]byte{3}, 64)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	htlc, err := NewHTLCScript(bytes.Repeat([]byte{4}, 32), bytes.Repeat([]byte{5}, 20), bytes.Repeat([]byte{6}, 20), 1700000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range []*RedeemScript{multisig, htlc} {
+		parsed, err := DeserializeScript(script.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(parsed.Hash(), script.Hash()) {
+			t.Errorf("script of type %d changed in a round trip", script.Type)
+		}
+	}
+	w := codec.NewWriter()
+	w.Varint(7)
+	if _, err := DeserializeScript(w.Data()); err == nil {
+		t.Error("unknown script type accepted")
+	}
+}
+
+func TestPartialTxRoundTrip(t *testing.T) {
+	tx := fullTx()
+	p := &PartialTx{Tx: *tx, Inputs: []PartialInput{
+		{PrevOut: TxOutputs{Value: 9, PubKeyHash: bytes.Repeat([]byte{0xaa}, 20)}, PubKeys: [][]byte{{1}}, Sigs: [][]byte{{2}}},
+		{PrevOut: TxOutputs{Value: 9, PubKeyHash: bytes.Repeat([]byte{0xbb}, 20), Kind: OutputScriptHash}},
+	}}
+	parsed, err := ParsePartialTx(p.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed.Serialize(), p.Serialize()) {
+		t.Error("partially signed transaction changed in a round trip")
+	}
+	p.Inputs = p.Inputs[:1]
+	if _, err := ParsePartialTx(p.Serialize()); err == nil {
+		t.Error("partially signed transaction without an entry per input accepted")
+	}
+}
+
+// Parse functions take only the canonical format with nothing after it. Gob is left to
+// the parseStored functions, for data read from the database
+func TestParseRejects(t *testing.T) {
+	chain := readBaselineChain(t)
+	gobBlock := chain[string(chain["lh"])]
+	if _, err := ParseBlock(gobBlock); err == nil {
+		t.Error("ParseBlock accepted a gob block")
+	}
+	block, err := parseStoredBlock(gobBlock)
+	if err != nil {
+		t.Fatalf("parseStoredBlock rejected a gob block: %v", err)
+	}
+
+	var outs OutputsArr
+	outs.Add(0, TxOutputs{Value: 5})
+	canonical := map[string][]byte{
+		"transaction": fullTx().SerializeTx(),
+		"outputs":     outs.SerializeOutputs(),
+		"header":      block.BlockHeader.Serialize(),
+		"block":       block.Serialize(),
+	}
+	parse := map[string]func([]byte) error{
+		"transaction": func(data []byte) error { _, err := ParseTrx(data); return err },
+		"outputs":     func(data []byte) error { _, err := ParseOutputs(data); return err },
+		"header":      func(data []byte) error { _, err := DeserializeHeader(data); return err },
+		"block":       func(data []byte) error { _, err := ParseBlock(data); return err },
+	}
+	for name, data := range canonical {
+		if err := parse[name](data); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if err := parse[name](append(append([]byte{}, data...), 0)); !errors.Is(err, codec.ErrTrailingData) {
+			t.Errorf("%s with a trailing byte: %v, want ErrTrailingData", name, err)
+		}
+		if err := parse[name](data[:len(data)-1]); err == nil {
+			t.Errorf("%s cut short accepted", name)
+		}
+	}
+}
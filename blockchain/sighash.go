@@ -0,0 +1,189 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+// Signature hash types, appended as the last byte of every signature.
+// The low bits pick which outputs are signed, SigHashAnyoneCanPay limits the inputs to the one being signed
+const (
+	// SigHashAll signs every input and every output
+	SigHashAll = byte(0x01)
+	// SigHashNone signs the inputs but no outputs, anyone may change where the coins go
+	SigHashNone = byte(0x02)
+	// SigHashSingle signs only the output with the same index as the input
+	SigHashSingle = byte(0x03)
+	// SigHashAnyoneCanPay signs only the current input, others may add inputs
+	SigHashAnyoneCanPay = byte(0x80)
+
+	sigHashMask = byte(0x1f)
+)
+
+// SigHashVersion is the version of the digest computed by SignatureHash
+const SigHashVersion = 1
+
+// Lengths of the two signature encodings. Legacy signatures carry no hash type
+// and sign the trimmed transaction copy digest (sigDigest)
+const (
+	legacySigLen = 64
+	sigLen       = 65
+)
+
+var errSigHashSingle = errors.New("SIGHASH_SINGLE input has no matching output")
+
+// ParseSigHashType reads a hash type name like "ALL" or "SINGLE|ANYONECANPAY"
+func ParseSigHashType(name string) (byte, error) {
+	var hashType byte
+	for _, part := range bytes.Split([]byte(name), []byte("|")) {
+		switch string(bytes.ToUpper(bytes.TrimSpace(part))) {
+		case "ALL":
+			hashType |= SigHashAll
+		case "NONE":
+			hashType |= SigHashNone
+		case "SINGLE":
+			hashType |= SigHashSingle
+		case "ANYONECANPAY":
+			hashType |= SigHashAnyoneCanPay
+		default:
+			return 0, errors.New("unknown sighash type " + string(part))
+		}
+	}
+	if !validSigHashType(hashType) {
+		return 0, errors.New("sighash type needs one of ALL, NONE or SINGLE")
+	}
+	return hashType, nil
+}
+
+func validSigHashType(hashType byte) bool {
+	base := hashType & sigHashMask
+	return base >= SigHashAll && base <= SigHashSingle && hashType&^(sigHashMask|SigHashAnyoneCanPay) == 0
+}
+
+// SignatureHash returns the digest signed by input inId, which spends prevOut, under hashType.
+//
+// The digest is sha256(sha256(preimage)). Integers in the preimage are big endian,
+// byte strings are prefixed with their length as a uint32:
+//
+//	uint32  SigHashVersion
+//	uint32  hashType
+//	uint32  tx.Version
+//	uint32  number of inputs, then for each input:
+//	          bytes  TXID
+//	          uint32 Vout
+//	          uint32 Sequence (0 for other inputs under NONE and SINGLE)
+//	          script code: for input inId the uint8 Kind, bytes PubKeyHash and int64 Value
+//	          of prevOut followed by bytes Redeem; for the other inputs a single 0xff
+//	uint32  number of outputs, then for each output:
+//	          int64 Value, uint8 Kind, bytes PubKeyHash, bytes Data
+//	int64   LockTime
+//
+// With SigHashAnyoneCanPay only input inId is written. SigHashNone writes no outputs.
+// SigHashSingle writes outputs 0 to inId, every output before inId as Value -1 and empty
+// PubKeyHash and Data, and fails when the transaction has no output inId.
+// Signatures, public keys and secrets are never part of the preimage
+func (tx *Transaction) SignatureHash(inId int, prevOut TxOutputs, hashType byte) ([]byte, error) {
+	if !validSigHashType(hashType) {
+		return nil, errors.New("invalid sighash type")
+	}
+	base := hashType & sigHashMask
+	anyoneCanPay := hashType&SigHashAnyoneCanPay != 0
+	if base == SigHashSingle && inId >= len(tx.Vout) {
+		return nil, errSigHashSingle
+	}
+
+	buff := new(bytes.Buffer)
+	writeUint32(buff, SigHashVersion)
+	writeUint32(buff, uint32(hashType))
+	writeUint32(buff, uint32(tx.Version))
+
+	inputs := tx.Vin
+	if anyoneCanPay {
+		inputs = tx.Vin[inId : inId+1]
+	}
+	writeUint32(buff, uint32(len(inputs)))
+	for idx, in := range inputs {
+		signing := anyoneCanPay || idx == inId
+		writeBytes(buff, in.TXID)
+		writeUint32(buff, uint32(in.Vout))
+		if signing || base == SigHashAll {
+			writeUint32(buff, in.Sequence)
+		} else {
+			writeUint32(buff, 0)
+		}
+		if signing {
+			buff.WriteByte(byte(prevOut.Kind))
+			writeBytes(buff, prevOut.PubKeyHash)
+			writeInt64(buff, int64(prevOut.Value))
+			writeBytes(buff, in.Redeem)
+		} else {
+			buff.WriteByte(0xff)
+		}
+	}
+
+	var outputs []TxOutputs
+	switch base {
+	case SigHashAll:
+		outputs = tx.Vout
+	case SigHashSingle:
+		outputs = tx.Vout[:inId+1]
+	}
+	writeUint32(buff, uint32(len(outputs)))
+	for idx, out := range outputs {
+		if base == SigHashSingle && idx != inId {
+			writeInt64(buff, -1)
+			buff.WriteByte(0)
+			writeBytes(buff, nil)
+			writeBytes(buff, nil)
+			continue
+		}
+		writeInt64(buff, int64(out.Value))
+		buff.WriteByte(byte(out.Kind))
+		writeBytes(buff, out.PubKeyHash)
+		writeBytes(buff, out.Data)
+	}
+	writeInt64(buff, tx.LockTime)
+
+	first := sha256.Sum256(buff.Bytes())
+	digest := sha256.Sum256(first[:])
+	return digest[:], nil
+}
+
+// checkSig verifies sig over input inId. Signatures ending in a hash type use SignatureHash.
+// Legacy 64 byte signatures use the trimmed copy digest they were made with, and are only
+// accepted in version 0 transactions, which were signed before hash types existed
+func (tx *Transaction) checkSig(inId int, prevOut TxOutputs, pubKey, sig []byte) bool {
+	switch len(sig) {
+	case legacySigLen:
+		if tx.Version != 0 {
+			return false
+		}
+		return verifySig(pubKey, tx.sigDigest(inId, prevOut), sig)
+	case sigLen:
+		digest, err := tx.SignatureHash(inId, prevOut, sig[sigLen-1])
+		if err != nil {
+			return false
+		}
+		return verifySig(pubKey, digest, sig[:legacySigLen])
+	}
+	return false
+}
+
+func writeUint32(buff *bytes.Buffer, num uint32) {
+	var raw [4]byte
+	binary.BigEndian.PutUint32(raw[:], num)
+	buff.Write(raw[:])
+}
+
+func writeInt64(buff *bytes.Buffer, num int64) {
+	var raw [8]byte
+	binary.BigEndian.PutUint64(raw[:], uint64(num))
+	buff.Write(raw[:])
+}
+
+func writeBytes(buff *bytes.Buffer, data []byte) {
+	writeUint32(buff, uint32(len(data)))
+	buff.Write(data)
+}
@@ -0,0 +1,211 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"main.go/wallet"
+)
+
+// sigHashVectorTx is the transaction of the test vectors in docs/sighash.md
+func sigHashVectorTx() *Transaction {
+	return &Transaction{
+		Vin: []TxInputs{
+			{TXID: bytes.Repeat([]byte{0x11}, 32), Vout: 0, Sequence: 0},
+			{TXID: bytes.Repeat([]byte{0x22}, 32), Vout: 1, Sequence: 5},
+		},
+		Vout: []TxOutputs{
+			{Value: 30, PubKeyHash: bytes.Repeat([]byte{0xbb}, 20), Kind: OutputPubKeyHash},
+			{Value: 19, PubKeyHash: bytes.Repeat([]byte{0xcc}, 20), Kind: OutputPubKeyHash},
+			{Value: 0, Kind: OutputData, Data: []byte("anchor")},
+		},
+		LockTime: 100,
+		Version:  TxVersion,
+	}
+}
+
+func TestSignatureHashVectors(t *testing.T) {
+	prevOut := TxOutputs{Value: 50, PubKeyHash: bytes.Repeat([]byte{0xaa}, 20), Kind: OutputPubKeyHash}
+	tests := []struct {
+		name     string
+		hashType byte
+		inId     int
+		digest   string
+	}{
+		{"ALL", SigHashAll, 0, "1a8a8e1f5e4cacdebb0125e4e76d2a61988bfb1f8c1da4e70dd1438f45416019"},
+		{"ALL", SigHashAll, 1, "afe2c6068999e9c13b17852df586863ae2a952f5454262aacbce8a1a04c7dcad"},
+		{"NONE", SigHashNone, 0, "7d9c2a91cb419e27257c6471616a54e5c624f293f0ab29654a76633e05e0a586"},
+		{"NONE", SigHashNone, 1, "e157e2c8dbd7d662bf0f0d2c619febddf106eac6f07de50fb244ccab1fbb58e9"},
+		{"SINGLE", SigHashSingle, 0, "f699bf1da0c1532de009063e536b7ce5ae48bc64686ec3a0a309a21e42af51d8"},
+		{"SINGLE", SigHashSingle, 1, "24a34910ccdf857176d9fb3402203d17a4ecf59e98e845c94d9ac251db54d9d6"},
+		{"ALL|ANYONECANPAY", SigHashAll | SigHashAnyoneCanPay, 0, "bdee967a9fefbb91c6aebb773d6876a8c6f6e3c5cbc8eb22c734d93b2d0b2847"},
+		{"ALL|ANYONECANPAY", SigHashAll | SigHashAnyoneCanPay, 1, "b4b2f1dd11a90b2d21877e45b54ac277650bf8beb1833ec24291636c206fcf00"},
+		{"NONE|ANYONECANPAY", SigHashNone | SigHashAnyoneCanPay, 0, "2930bc2deb83d8a896dd57302bb84fc2a99059b854e967b027eb8310248a1ad3"},
+		{"NONE|ANYONECANPAY", SigHashNone | SigHashAnyoneCanPay, 1, "9b6693b01173a06b44e4bfde7033c28a1fdd9ddb2c122b33e0e6e7aa5308f7bd"},
+		{"SINGLE|ANYONECANPAY", SigHashSingle | SigHashAnyoneCanPay, 0, "cd3275eaa0d8ae3319c4438ac6bf9ddc573252a9f5b3a13e9c67408fa17eb606"},
+		{"SINGLE|ANYONECANPAY", SigHashSingle | SigHashAnyoneCanPay, 1, "395273bb30f284fb0e9b594fd37cb7ef651baa0abcdf9283602ec13dcf1c80c8"},
+	}
+	for _, test := range tests {
+		hashType, err := ParseSigHashType(test.name)
+		if err != nil || hashType != test.hashType {
+			t.Errorf("ParseSigHashType(%q) = %#x, %v, want %#x", test.name, hashType, err, test.hashType)
+		}
+		digest, err := sigHashVectorTx().SignatureHash(test.inId, prevOut, test.hashType)
+		if err != nil {
+			t.Errorf("%s input %d: %v", test.name, test.inId, err)
+			continue
+		}
+		if got := hex.EncodeToString(digest); got != test.digest {
+			t.Errorf("%s input %d: digest %s, want %s", test.name, test.inId, got, test.digest)
+		}
+	}
+}
+
+func TestSignatureHashSingleWithoutOutput(t *testing.T) {
+	tx := sigHashVectorTx()
+	tx.Vout = tx.Vout[:1]
+	prevOut := TxOutputs{Value: 50, PubKeyHash: bytes.Repeat([]byte{0xaa}, 20), Kind: OutputPubKeyHash}
+	if _, err := tx.SignatureHash(1, prevOut, SigHashSingle); err == nil {
+		t.Error("SINGLE signed an input without a matching output")
+	}
+}
+
+func TestLegacySignatureOnlyInVersion0(t *testing.T) {
+	w := wallet.MakeWallet()
+	prevOut := TxOutputs{Value: 50, PubKeyHash: wallet.PubKeyHash(w.PubKey), Kind: OutputPubKeyHash}
+	for _, version := range []int{0, TxVersion} {
+		tx := sigHashVectorTx()
+		tx.Version = version
+		r, s, err := ecdsa.Sign(rand.Reader, &w.PrivKey, tx.sigDigest(0, prevOut))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := make([]byte, legacySigLen)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		if got := tx.checkSig(0, prevOut, w.PubKey, sig); got != (version == 0) {
+			t.Errorf("legacy signature in a version %d transaction accepted: %v", version, got)
+		}
+		full := tx.signInput(w.PrivKey, 0, prevOut, SigHashAll)
+		if !tx.checkSig(0, prevOut, w.PubKey, full) {
+			t.Errorf("signature with a hash type rejected in a version %d transaction", version)
+		}
+	}
+}
+
+// fundingTx returns a transaction whose output 0 is out, and the previous transactions
+// map Sign and Verify take for a spend of it
+func fundingTx(out TxOutputs) (*Transaction, map[string]Transaction) {
+	prev := &Transaction{
+		Vin:     []TxInputs{{TXID: bytes.Repeat([]byte{0x33}, 32), Vout: 0}},
+		Vout:    []TxOutputs{out},
+		Version: TxVersion,
+	}
+	prev.ID = prev.IDHash()
+	return prev, map[string]Transaction{hex.EncodeToString(prev.ID): *prev}
+}
+
+// spendTx returns an unsigned transaction spending output 0 of prev with in to a 10 coin output
+func spendTx(prev *Transaction, in TxInputs, lockTime int64) *Transaction {
+	in.TXID, in.Vout = prev.ID, 0
+	tx := &Transaction{
+		Vin:      []TxInputs{in},
+		Vout:     []TxOutputs{{Value: 10, PubKeyHash: bytes.Repeat([]byte{0xdd}, 20)}},
+		LockTime: lockTime,
+		Version:  TxVersion,
+	}
+	tx.ID = tx.IDHash()
+	return tx
+}
+
+func copyTx(t *testing.T, tx *Transaction) *Transaction {
+	t.Helper()
+	txCopy, err := ParseTrx(tx.SerializeTx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &txCopy
+}
+
+// Fields no signature covers are left out of the ID, so changing them either keeps the ID
+// or breaks the transaction. The version is signed, changing it breaks every signature
+func TestWitnessChangesKeepID(t *testing.T) {
+	w1, w2, w3 := wallet.MakeWallet(), wallet.MakeWallet(), wallet.MakeWallet()
+
+	p2pkhPrev, p2pkhPrevs := fundingTx(TxOutputs{Value: 10, PubKeyHash: wallet.PubKeyHash(w1.PubKey)})
+	p2pkh := spendTx(p2pkhPrev, TxInputs{}, 0)
+	p2pkh.Sign(w1.PrivKey, p2pkhPrevs)
+
+	multisig, err := NewMultisigScript(2, [][]byte{w1.PubKey, w2.PubKey, w3.PubKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	multisigPrev, multisigPrevs := fundingTx(TxOutputs{Value: 10, PubKeyHash: multisig.Hash(), Kind: OutputScriptHash})
+	multisigSpend := spendTx(multisigPrev, TxInputs{Redeem: multisig.Serialize(), Sigs: make([][]byte, 3)}, 0)
+	multisigSpend.Sign(w1.PrivKey, multisigPrevs)
+	multisigSpend.Sign(w2.PrivKey, multisigPrevs)
+
+	secret := bytes.Repeat([]byte{0x5e}, SecretSize)
+	secretHash := sha256.Sum256(secret)
+	htlc, err := NewHTLCScript(secretHash[:], wallet.PubKeyHash(w1.PubKey), wallet.PubKeyHash(w2.PubKey), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	htlcPrev, htlcPrevs := fundingTx(TxOutputs{Value: 10, PubKeyHash: htlc.Hash(), Kind: OutputScriptHash})
+	claim := spendTx(htlcPrev, TxInputs{Redeem: htlc.Serialize(), Preimage: secret}, 0)
+	claim.Sign(w1.PrivKey, htlcPrevs)
+
+	tests := []struct {
+		name   string
+		tx     *Transaction
+		prevs  map[string]Transaction
+		change func(tx *Transaction)
+	}{
+		{"pubkey hash: other key", p2pkh, p2pkhPrevs, func(tx *Transaction) { tx.Vin[0].PubKey = w2.PubKey }},
+		{"pubkey hash: no key", p2pkh, p2pkhPrevs, func(tx *Transaction) { tx.Vin[0].PubKey = nil }},
+		{"pubkey hash: signature", p2pkh, p2pkhPrevs, func(tx *Transaction) { tx.Vin[0].Sig[5] ^= 1 }},
+		{"pubkey hash: secret", p2pkh, p2pkhPrevs, func(tx *Transaction) { tx.Vin[0].Preimage = secret }},
+		{"multisig: pubkey", multisigSpend, multisigPrevs, func(tx *Transaction) { tx.Vin[0].PubKey = w3.PubKey }},
+		{"multisig: sig", multisigSpend, multisigPrevs, func(tx *Transaction) { tx.Vin[0].Sig = []byte{1, 2, 3} }},
+		{"multisig: drop a signature", multisigSpend, multisigPrevs, func(tx *Transaction) { tx.Vin[0].Sigs[1] = nil }},
+		{"multisig: swap signatures", multisigSpend, multisigPrevs, func(tx *Transaction) {
+			tx.Vin[0].Sigs[0], tx.Vin[0].Sigs[1] = tx.Vin[0].Sigs[1], tx.Vin[0].Sigs[0]
+		}},
+		{"multisig: extra signature", multisigSpend, multisigPrevs, func(tx *Transaction) { tx.Vin[0].Sigs[2] = tx.Vin[0].Sigs[0] }},
+		{"htlc: no secret", claim, htlcPrevs, func(tx *Transaction) { tx.Vin[0].Preimage = nil }},
+		{"htlc: wrong secret", claim, htlcPrevs, func(tx *Transaction) { tx.Vin[0].Preimage = bytes.Repeat([]byte{0x5f}, SecretSize) }},
+		{"htlc: refund key", claim, htlcPrevs, func(tx *Transaction) { tx.Vin[0].PubKey = w2.PubKey }},
+	}
+	for _, test := range tests {
+		if err := test.tx.CheckID(); err != nil || !test.tx.Verify(test.prevs) {
+			t.Fatalf("%s: signed transaction does not verify: %v", test.name, err)
+		}
+		changed := copyTx(t, test.tx)
+		test.change(changed)
+		if !bytes.Equal(changed.IDHash(), test.tx.ID) && changed.Verify(test.prevs) {
+			t.Errorf("%s: changed transaction still verifies with ID %x instead of %x", test.name, changed.IDHash(), test.tx.ID)
+		}
+	}
+
+	spends := []struct {
+		name  string
+		tx    *Transaction
+		prevs map[string]Transaction
+	}{{"pubkey hash", p2pkh, p2pkhPrevs}, {"multisig", multisigSpend, multisigPrevs}, {"htlc", claim, htlcPrevs}}
+	for _, version := range []int{0, 2, 7} {
+		for _, spend := range spends {
+			changed := copyTx(t, spend.tx)
+			changed.Version = version
+			if changed.Verify(spend.prevs) {
+				t.Errorf("%s: verifies as version %d", spend.name, version)
+			}
+			if changed.CheckSanity() == nil {
+				t.Errorf("%s: passes CheckSanity as version %d", spend.name, version)
+			}
+		}
+	}
+}
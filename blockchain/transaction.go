@@ -6,19 +6,28 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
-	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 	"strings"
 
+	legacy "main.go/blockchain/legacy"
+	"main.go/codec"
 	"main.go/wallet"
 )
 
+// TxVersion is the version of new transactions. Version 0 transactions were created while
+// transactions were gob encoded and are hashed the way they were then, see HashTx
+const TxVersion = 1
+
 type Transaction struct{
 	ID []byte
 	Vin []TxInputs
 	Vout []TxOutputs
+	// Block height (below LockTimeThreshold) or unix time before which the transaction cannot be mined
+	LockTime int64
+	Version int
 }
 
 
@@ -32,40 +41,130 @@ func CoinbaseTx(to, data string) *Transaction{
 		HandleErr(err)
 		data = fmt.Sprintf("Message: %x", randData)
 	}
-	txIn := TxInputs{[]byte{}, -1, nil, []byte(data)}
+	txIn := TxInputs{TXID: []byte{}, Vout: -1, PubKey: []byte(data)}
 	txOut := NewTxOutput(50, to)
 
-	tx := &Transaction{nil, []TxInputs{txIn}, []TxOutputs{*txOut}}
+	tx := &Transaction{nil, []TxInputs{txIn}, []TxOutputs{*txOut}, 0, TxVersion}
 
-	tx.ID = tx.HashTx()
+	tx.ID = tx.IDHash()
 	return tx
 
 }
 
-// func (tx * Transaction) SetID(){
-// 	var hash [32]byte
-// 	buff := new(bytes.Buffer)
-// 	encoder := gob.NewEncoder(buff)
-// 	err := encoder.Encode(tx)
-// 	HandleErr(err)
-// 	hash = sha256.Sum256(buff.Bytes())
-// 	tx.ID = hash[:]
-// }
-
 func (tx *Transaction) IsCoinbaseTxn() bool{
 	return len(tx.Vin) == 1 && len(tx.Vin[0].TXID) == 0 && tx.Vin[0].Vout == -1
 }
 
-func NewTransaction(w *wallet.Wallet, to string, amount int, utxo *UTXOset) *Transaction{
+func NewTransaction(w *wallet.Wallet, to, change string, amount int, lockTime int64, utxo *UTXOset) *Transaction{
+	return NewTransactionWithOutputs(w, []TxOutputs{*NewTxOutput(amount, to)}, change, lockTime, utxo)
+}
+
+// NewTransactionWithOutputs pays outputs from the wallet's coins and sends the change to
+// the change address, or back to the wallet when it is empty
+func NewTransactionWithOutputs(w *wallet.Wallet, outputs []TxOutputs, change string, lockTime int64, utxo *UTXOset) *Transaction{
+	tx := NewUnsignedTransaction(w.PubKey, wallet.PubKeyHash(w.PubKey), outputs, change, lockTime, utxo)
+	utxo.Blockchain.SignTrx(tx, w.PrivKey)
+	fmt.Println("New transaction created successfully")
+	return tx
+
+}
+
+// NewUnsignedTransaction pays outputs from the coins locked to pubKeyHash and sends the change to the
+// change address, or back to pubKeyHash when it is empty.
+// The inputs carry pubKey when it is known, otherwise the signer sets it
+func NewUnsignedTransaction(pubKey, pubKeyHash []byte, outputs []TxOutputs, change string, lockTime int64, utxo *UTXOset) *Transaction{
 	var inputs []TxInputs
-	var outputs []TxOutputs
 
-	// wallets, err := wallet.CreateWallets()
-	// HandleErr(err)
-	// w := wallets.GetWallet(from) 
-	pubKeyHash := wallet.PubKeyHash(w.PubKey)
+	amount := 0
+	for _, out := range outputs{
+		amount += out.Value
+	}
+	// A transaction needs at least one input, even one that only carries data
+	needed := amount
+	if needed == 0{
+		needed = 1
+	}
+	accumulated , validOutputs := utxo.FindSpendableOutputs(pubKeyHash, needed)
+	if accumulated < needed{
+		panic("Insufficient funds")
+	}
+	for txid, outs := range validOutputs{
+		txID, err := hex.DecodeString(txid)
+		HandleErr(err)
+
+		for _,out := range outs{
+			input := TxInputs{TXID: txID, Vout: out, PubKey: pubKey}
+			inputs = append(inputs, input)
+		}
+	}
+	if change == ""{
+		change = string(wallet.PubKeyHashAddress(pubKeyHash))
+	}
+	if accumulated > amount{
+		outputs = append(outputs, *NewTxOutput(accumulated - amount, change))
+	}
+	tx := &Transaction{nil, inputs, outputs, lockTime, TxVersion}
+	tx.ID = tx.IDHash()
+	return tx
+}
+
+// CheckSanity applies the checks that need nothing but the transaction itself to a new
+// transaction, which must have version TxVersion
+func (tx *Transaction) CheckSanity() error{
+	if tx.Version != TxVersion{
+		return fmt.Errorf("transaction version %d, want %d", tx.Version, TxVersion)
+	}
+	return tx.checkSanity()
+}
+
+// CheckInBlock is CheckSanity for a transaction in a block of version blockVersion.
+// Version 0 blocks hold version 0 transactions, later blocks hold TxVersion ones
+func (tx *Transaction) CheckInBlock(blockVersion int) error{
+	if blockVersion == 0{
+		if tx.Version != 0{
+			return fmt.Errorf("version %d transaction in a version 0 block", tx.Version)
+		}
+		return tx.checkSanity()
+	}
+	return tx.CheckSanity()
+}
+
+func (tx *Transaction) checkSanity() error{
+	if tx.Version == 0{
+		if err := tx.checkLegacyFields(); err != nil{
+			return err
+		}
+	}
+	if tx.IsCoinbaseTxn(){
+		return nil
+	}
+	if len(tx.Vin) == 0{
+		return errors.New("transaction has no inputs")
+	}
+	for idx, out := range tx.Vout{
+		if !out.IsData(){
+			continue
+		}
+		if out.Value != 0{
+			return fmt.Errorf("data output %d carries value", idx)
+		}
+		if len(out.Data) > MaxDataSize{
+			return fmt.Errorf("data output %d is larger than %d bytes", idx, MaxDataSize)
+		}
+	}
+	return nil
+}
+
+// NewMultisigTransaction spends outputs locked to the serialized multisig script redeem and returns the transaction unsigned.
+// Each key holder then adds a signature with BlockChain.SignTrx until script.Required are collected
+func NewMultisigTransaction(redeem []byte, to string, amount int, utxo *UTXOset) *Transaction{
+	var inputs []TxInputs
+	var outputs []TxOutputs
 
-	accumulated , validOutputs := utxo.FindSpendableOutputs(pubKeyHash, amount)
+	script, err := DeserializeScript(redeem)
+	HandleErr(err)
+	scriptHash := wallet.PubKeyHash(redeem)
+	accumulated, validOutputs := utxo.FindSpendableOutputs(scriptHash, amount)
 	if accumulated < amount{
 		panic("Insufficient funds")
 	}
@@ -73,30 +172,105 @@ func NewTransaction(w *wallet.Wallet, to string, amount int, utxo *UTXOset) *Tra
 		txID, err := hex.DecodeString(txid)
 		HandleErr(err)
 
-		for _,out := range outs{
-			input := TxInputs{txID, out,nil, w.PubKey}
+		for _, out := range outs{
+			input := TxInputs{TXID: txID, Vout: out, Redeem: redeem, Sigs: make([][]byte, len(script.PubKeys))}
 			inputs = append(inputs, input)
 		}
 	}
-	from := fmt.Sprintf("%s", w.Address())
 	outputs = append(outputs, *NewTxOutput(amount, to))
 	if accumulated > amount{
-		outputs = append(outputs, *NewTxOutput(accumulated - amount, from))
+		outputs = append(outputs, *NewTxOutput(accumulated - amount, string(wallet.ScriptAddress(scriptHash))))
 	}
-	tx := &Transaction{nil, inputs, outputs}
-	tx.ID = tx.HashTx()
-	utxo.Blockchain.SignTrx(tx, w.PrivKey)
-	fmt.Println("New transaction created successfully")
+	tx := &Transaction{nil, inputs, outputs, 0, TxVersion}
+	tx.ID = tx.IDHash()
 	return tx
+}
+
+// NewHTLCSpend spends the HTLC output vout of prevTx to the address to and returns the transaction unsigned.
+// Passing the secret takes the redeem path, passing none takes the refund path,
+// which locks the spend until the contract's lock time
+func NewHTLCSpend(redeem []byte, prevTx *Transaction, vout int, to string, secret []byte) (*Transaction, error){
+	script, err := DeserializeScript(redeem)
+	if err != nil{
+		return nil, err
+	}
+	if script.Type != ScriptHTLC{
+		return nil, errors.New("not an HTLC contract")
+	}
+	prevOut := prevTx.Vout[vout]
+	if prevOut.Kind != OutputScriptHash || !bytes.Equal(prevOut.PubKeyHash, wallet.PubKeyHash(redeem)){
+		return nil, errors.New("output is not locked to this contract")
+	}
+
+	input := TxInputs{TXID: prevTx.ID, Vout: vout, Redeem: redeem, Preimage: secret}
+	var lockTime int64
+	if len(secret) == 0{
+		lockTime = script.LockTime
+	}
+	tx := &Transaction{nil, []TxInputs{input}, []TxOutputs{*NewTxOutput(prevOut.Value, to)}, lockTime, TxVersion}
+	tx.ID = tx.IDHash()
+	return tx, nil
+}
 
+// IsFullySigned reports whether every multisig input has collected enough signatures
+func (tx *Transaction) IsFullySigned() bool{
+	for _, in := range tx.Vin{
+		if len(in.Redeem) == 0{
+			if len(in.Sig) == 0 && !tx.IsCoinbaseTxn(){
+				return false
+			}
+			continue
+		}
+		script, err := DeserializeScript(in.Redeem)
+		if err != nil{
+			return false
+		}
+		if script.Type == ScriptHTLC && len(in.Sig) == 0{
+			return false
+		}
+		if script.Type == ScriptMultisig && in.CountSigs() < script.Required{
+			return false
+		}
+	}
+	return true
 }
 
+// SerializeTx returns the canonical encoding of the transaction, see docs/serialization.md
 func (tx Transaction) SerializeTx() []byte{
-	buff := new(bytes.Buffer)
-	encoder := gob.NewEncoder(buff)
-	err := encoder.Encode(tx)
-	HandleErr(err)
-	return buff.Bytes()
+	w := codec.NewWriter()
+	tx.encode(w)
+	return w.Data()
+}
+
+// IDHash is what the ID of tx must be: HashTx of tx without the fields that unlock its
+// inputs. No signature covers Sig, Sigs, PubKey or Preimage, so anyone relaying tx could
+// change them, and IDs are set before the inputs are signed. Multisig inputs keep their
+// number of signature slots. The coinbase keeps the data in its PubKey, and version 0
+// transactions keep PubKey as their IDs were computed with it
+func (tx *Transaction) IDHash() []byte {
+	txCopy := *tx
+	txCopy.Vin = make([]TxInputs, len(tx.Vin))
+	for i, in := range tx.Vin {
+		in.Sig = nil
+		if in.Sigs != nil {
+			in.Sigs = make([][]byte, len(in.Sigs))
+		}
+		if tx.Version != 0 && !tx.IsCoinbaseTxn() {
+			in.PubKey = nil
+			in.Preimage = nil
+		}
+		txCopy.Vin[i] = in
+	}
+	return txCopy.HashTx()
+}
+
+// CheckID fails when the ID of tx is not its IDHash, as for a transaction received
+// from a peer that lied about it
+func (tx *Transaction) CheckID() error {
+	if !bytes.Equal(tx.ID, tx.IDHash()) {
+		return fmt.Errorf("transaction %x does not hash to its ID", tx.ID)
+	}
+	return nil
 }
 
 func (tx *Transaction) HashTx() []byte{
@@ -104,25 +278,135 @@ func (tx *Transaction) HashTx() []byte{
 	var hash [32]byte
 	txCopy := *tx
 	txCopy.ID = []byte{}
-	hash = sha256.Sum256(txCopy.SerializeTx())
+	if tx.Version == 0{
+		hash = sha256.Sum256(txCopy.legacyCopy().Encode())
+		return hash[:]
+	}
+	// Always hashed with the format 1 header, so later format versions keep transaction IDs
+	w := codec.NewWriterVersion(1)
+	txCopy.encode(w)
+	hash = sha256.Sum256(w.Data())
 	 return hash[:]
 }
 
+// legacyCopy converts tx to the frozen type gob encoded by version 0 transactions.
+// Fields added since are dropped, checkLegacyFields keeps them out of version 0 transactions
+func (tx *Transaction) legacyCopy() legacy.Transaction{
+	txCopy := legacy.Transaction{ID: tx.ID}
+	for _, in := range tx.Vin{
+		txCopy.Vin = append(txCopy.Vin, legacy.TxInputs{TXID: in.TXID, Vout: in.Vout, Sig: in.Sig, PubKey: in.PubKey})
+	}
+	for _, out := range tx.Vout{
+		txCopy.Vout = append(txCopy.Vout, legacy.TxOutputs{Value: out.Value, PubKeyHash: out.PubKeyHash})
+	}
+	return txCopy
+}
+
+// checkLegacyFields fails when a version 0 transaction uses a field its hash would not cover
+func (tx *Transaction) checkLegacyFields() error{
+	if tx.LockTime != 0{
+		return errors.New("version 0 transaction has a lock time")
+	}
+	for idx, in := range tx.Vin{
+		if in.Sequence != 0 || len(in.Redeem) > 0 || len(in.Sigs) > 0 || len(in.Preimage) > 0{
+			return fmt.Errorf("version 0 transaction input %d uses fields added after version 0", idx)
+		}
+	}
+	for idx, out := range tx.Vout{
+		if out.Kind != OutputPubKeyHash || len(out.Data) > 0{
+			return fmt.Errorf("version 0 transaction output %d is not pay to public key hash", idx)
+		}
+	}
+	return nil
+}
+
 func (tx *Transaction) TrimmedTxCopy() Transaction{
 	var inputs []TxInputs
 	var outputs []TxOutputs
 
 	for _, in := range tx.Vin{
-		inputs = append(inputs, TxInputs{in.TXID, in.Vout, nil, nil})
+		inputs = append(inputs, TxInputs{TXID: in.TXID, Vout: in.Vout, Sequence: in.Sequence})
 	}
 	for _, out := range tx.Vout{
-		outputs = append(outputs, TxOutputs{out.Value, out.PubKeyHash})
+		outputs = append(outputs, TxOutputs{out.Value, out.PubKeyHash, out.Kind, out.Data})
 	}
-	txCopy := Transaction{tx.ID, inputs, outputs}
+	txCopy := Transaction{tx.ID, inputs, outputs, tx.LockTime, tx.Version}
 	return txCopy
 }
 
+// sigDigest is the digest signed by legacy signatures, which carry no hash type: the trimmed
+// transaction with input inId's PubKey replaced by the hash locking the output it spends.
+// New signatures use SignatureHash
+func (tx *Transaction) sigDigest(inId int, prevOut TxOutputs) []byte{
+	txCopy := tx.TrimmedTxCopy()
+	txCopy.Vin[inId].PubKey = prevOut.PubKeyHash
+	return txCopy.HashTx()
+}
+
+// signInput signs input inId under hashType and appends the hash type to the signature
+func (tx *Transaction) signInput(privKey ecdsa.PrivateKey, inId int, prevOut TxOutputs, hashType byte) []byte{
+	digest, err := tx.SignatureHash(inId, prevOut, hashType)
+	HandleErr(err)
+	r, s, err := ecdsa.Sign(rand.Reader, &privKey, digest)
+	HandleErr(err)
+	// Pad r and s so the signature can always be split in half
+	signature := make([]byte, sigLen)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:legacySigLen])
+	signature[legacySigLen] = hashType
+	return signature
+}
+
+func verifySig(pubKey, digest, sig []byte) bool{
+	if len(pubKey) == 0 || len(sig) == 0{
+		return false
+	}
+	curve := elliptic.P256()
+
+	//  Extract pub key
+	x, y, ok := parsePubKey(curve, pubKey)
+	if !ok{
+		return false
+	}
+
+	sigLen := len(sig)
+	r := big.Int{}
+	s := big.Int{}
+	r.SetBytes(sig[:(sigLen / 2)])
+	s.SetBytes(sig[(sigLen/2):])
+
+	rawPubKey := ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	return ecdsa.Verify(&rawPubKey, digest, &r, &s)
+}
+
+// parsePubKey splits a public key into its coordinates. Wallets write each coordinate
+// without leading zeros, so a key may be a byte or two short and the split is the one on the curve
+func parsePubKey(curve elliptic.Curve, pubKey []byte) (*big.Int, *big.Int, bool){
+	size := (curve.Params().BitSize + 7) / 8
+	if len(pubKey) > 2*size{
+		return nil, nil, false
+	}
+	for xLen := len(pubKey) - size; xLen <= size; xLen++{
+		if xLen < 0{
+			continue
+		}
+		x := new(big.Int).SetBytes(pubKey[:xLen])
+		y := new(big.Int).SetBytes(pubKey[xLen:])
+		if curve.IsOnCurve(x, y){
+			return x, y, true
+		}
+	}
+	return nil, nil, false
+}
+
+// Sign signs every input privKey can unlock with SigHashAll and leaves the others untouched,
+// so a multisig spend can be passed from one key holder to the next
 func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTxs map[string]Transaction) {
+	tx.SignWithType(privKey, prevTxs, SigHashAll)
+}
+
+// SignWithType is Sign with a chosen signature hash type
+func (tx *Transaction) SignWithType(privKey ecdsa.PrivateKey, prevTxs map[string]Transaction, hashType byte) {
 	if tx.IsCoinbaseTxn(){
 		return
 	}
@@ -133,18 +417,40 @@ func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTxs map[string]Transac
 		}
 	}
 
-	txCopy := tx.TrimmedTxCopy()
-	for inId, in := range txCopy.Vin{
-		prevTxs := prevTxs[hex.EncodeToString(in.TXID)]
-		txCopy.Vin[inId].Sig = nil
-		txCopy.Vin[inId].PubKey = prevTxs.Vout[in.Vout].PubKeyHash
-		txCopy.ID = tx.HashTx()
-		txCopy.Vin[inId].PubKey = nil
-
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, txCopy.ID)
-		HandleErr(err)
-		signature := append(r.Bytes(), s.Bytes()...)
-		tx.Vin[inId].Sig = signature
+	pubKey := append(privKey.X.Bytes(), privKey.Y.Bytes()...)
+	for inId, in := range tx.Vin{
+		prevOut := prevTxs[hex.EncodeToString(in.TXID)].Vout[in.Vout]
+
+		switch prevOut.Kind{
+		case OutputPubKeyHash:
+			if !bytes.Equal(wallet.PubKeyHash(pubKey), prevOut.PubKeyHash){
+				continue
+			}
+			// spends built from a watch-only address leave the key to the signer
+			tx.Vin[inId].PubKey = pubKey
+			tx.Vin[inId].Sig = tx.signInput(privKey, inId, prevOut, hashType)
+		case OutputScriptHash:
+			script, err := DeserializeScript(in.Redeem)
+			if err != nil{
+				continue
+			}
+			if script.Type == ScriptHTLC{
+				pubKeyHash := wallet.PubKeyHash(pubKey)
+				if bytes.Equal(pubKeyHash, script.Recipient) || bytes.Equal(pubKeyHash, script.Refund){
+					tx.Vin[inId].PubKey = pubKey
+					tx.Vin[inId].Sig = tx.signInput(privKey, inId, prevOut, hashType)
+				}
+				continue
+			}
+			keyIdx := script.KeyIndex(pubKey)
+			if keyIdx < 0{
+				continue
+			}
+			if len(in.Sigs) != len(script.PubKeys){
+				tx.Vin[inId].Sigs = make([][]byte, len(script.PubKeys))
+			}
+			tx.Vin[inId].Sigs[keyIdx] = tx.signInput(privKey, inId, prevOut, hashType)
+		}
 	}
 }
 
@@ -158,55 +464,93 @@ func (tx *Transaction) Verify(prevTxs map[string]Transaction) bool{
 		}
 	}
 
-	txCopy := tx.TrimmedTxCopy()
-	curve := elliptic.P256()
 	for inId, in := range tx.Vin{
-		prevTxs := prevTxs[hex.EncodeToString(in.TXID)]
-		txCopy.Vin[inId].Sig = nil
-		txCopy.Vin[inId].PubKey = prevTxs.Vout[in.Vout].PubKeyHash
-		txCopy.ID = tx.HashTx()
-		txCopy.Vin[inId].PubKey = nil
-
-		//  Extract pub key
-		keyLen := len(in.PubKey)
-		x := big.Int{}
-		y := big.Int{}
-
-		x.SetBytes(in.PubKey[:keyLen/2])
-		y.SetBytes(in.PubKey[(keyLen / 2):])
-		
-		
-
-		sigLen := len(in.Sig)
-		r := big.Int{}
-		s := big.Int{}
-
-		r.SetBytes(in.Sig[:(sigLen / 2)])
-		s.SetBytes(in.Sig[(sigLen/2):])
-
-		rawPubKey := ecdsa.PublicKey{curve, &x, &y}
-		if !ecdsa.Verify(&rawPubKey, txCopy.ID, &r, &s){
+		prevOut := prevTxs[hex.EncodeToString(in.TXID)].Vout[in.Vout]
+
+		switch prevOut.Kind{
+		case OutputPubKeyHash:
+			if !in.UsesKey(prevOut.PubKeyHash) || !tx.checkSig(inId, prevOut, in.PubKey, in.Sig){
+				return false
+			}
+		case OutputScriptHash:
+			if !tx.verifyScript(inId, prevOut){
+				return false
+			}
+		default:
 			return false
 		}
 	}
 	return true
 }
 
+func (tx *Transaction) verifyScript(inId int, prevOut TxOutputs) bool{
+	in := tx.Vin[inId]
+	if !bytes.Equal(wallet.PubKeyHash(in.Redeem), prevOut.PubKeyHash){
+		return false
+	}
+	script, err := DeserializeScript(in.Redeem)
+	if err != nil{
+		return false
+	}
+	switch script.Type{
+	case ScriptMultisig:
+		return tx.verifyMultisig(inId, prevOut, script)
+	case ScriptHTLC:
+		return tx.verifyHTLC(inId, prevOut, script)
+	}
+	return false
+}
+
+func (tx *Transaction) verifyMultisig(inId int, prevOut TxOutputs, script *RedeemScript) bool{
+	in := tx.Vin[inId]
+	if len(in.Sigs) != len(script.PubKeys){
+		return false
+	}
+	valid := 0
+	for keyIdx, sig := range in.Sigs{
+		if len(sig) == 0{
+			continue
+		}
+		if !tx.checkSig(inId, prevOut, script.PubKeys[keyIdx], sig){
+			return false
+		}
+		valid++
+	}
+	return valid >= script.Required
+}
+
 
 func (tx Transaction) StringRep() string{
 	var lines []string
 
 	lines = append(lines, fmt.Sprintf("--- Transaction: %x", tx.ID))
+	if tx.LockTime != 0{
+		lines = append(lines, fmt.Sprintf(" Lock time: %d", tx.LockTime))
+	}
 	for idx, input := range tx.Vin{
 		lines = append(lines, fmt.Sprintf(" Input: %d", idx))
 		lines = append(lines, fmt.Sprintf(" TXID:  %x", input.TXID))
 		lines = append(lines, fmt.Sprintf(" Vout: %d", input.Vout))
 		lines = append(lines, fmt.Sprintf(" Signature: %x", input.Sig))
 		lines = append(lines, fmt.Sprintf(" PubKey: %x", input.PubKey))
+		if input.Sequence != 0{
+			lines = append(lines, fmt.Sprintf(" Sequence: %d", input.Sequence))
+		}
+		if len(input.Redeem) > 0{
+			lines = append(lines, fmt.Sprintf(" Redeem script: %x", input.Redeem))
+			lines = append(lines, fmt.Sprintf(" Signatures: %d of %d", input.CountSigs(), len(input.Sigs)))
+		}
+		if len(input.Preimage) > 0{
+			lines = append(lines, fmt.Sprintf(" Secret: %x", input.Preimage))
+		}
 	}
 	
 	for idx, output := range tx.Vout{
 		lines = append(lines, fmt.Sprintf(" Output ID: %v", idx))
+		if output.IsData(){
+			lines = append(lines, fmt.Sprintf(" Data: %x", output.Data))
+			continue
+		}
 		lines = append(lines, fmt.Sprintf(" Value: %d", output.Value))
 		lines = append(lines, fmt.Sprintf(" ScriptPubKey: %x", output.PubKeyHash ))
 	}
@@ -215,132 +559,3 @@ func (tx Transaction) StringRep() string{
 // 1PVSzWFTkxwHTvp3SfNgNRXzPFQsVDuVRK
 // 19Tyq48r4fSXfozb7wDxJEJUbgC8FMJRw7
 // 1MLrydCaFy2bYyyckYtrp2SEdn6uE54HMW
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-// func (tx Transaction) SerializeTx() []byte{
-// 	buff := new(bytes.Buffer)
-// 	encoder := gob.NewEncoder(buff)
-// 	err := encoder.Encode(tx)
-// 	HandleErr(err)
-// 	return buff.Bytes()
-// }
-
-// func (tx *Transaction) Hash() []byte{
-// 	var hash [32]byte
-// 	txCopy := *tx
-// 	txCopy.ID = []byte{}
-// 	hash  = sha256.Sum256(txCopy.SerializeTx())
-
-// 	return hash[:]
-// }
-
-// func (tx *Transaction) SignTx(privKey ecdsa.PrivateKey, prevTxs map[string]Transaction){
-// 	if tx.IsCoinbaseTxn(){
-// 		return
-// 	}
-// 	for _, in := range tx.Vin{
-// 		if prevTxs[hex.EncodeToString(in.TXID)].ID == nil{
-// 			panic("Error: No previous transaction found")
-// 		}
-// 	}
-// 	txCopy := tx.TrimmedTxCopy()
-
-// 	for inID, in := range txCopy.Vin{
-// 		prevTxs := prevTxs[hex.EncodeToString(in.TXID)]
-// 		// Set signature of inputs
-// 		txCopy.Vin[inID].Sig  = nil
-// 		//  Set pubkey hash to equal txOutput pubkey hash
-// 		txCopy.Vin[inID].PubKey = prevTxs.Vout[in.Vout].PubKeyHash
-// 		// Hash all transaction
-// 		txCopy.ID = tx.Hash()
-// 		// Reset pubkey hash to nil
-// 		txCopy.Vin[inID].PubKey = nil
-// 		// Sign txId
-// 		r, s, err := ecdsa.Sign(rand.Reader, &privKey, txCopy.ID)
-// 		HandleErr(err)
-// 		signature := append(r.Bytes(), s.Bytes()...)
-
-// 		// Update signature of input 
-// 		tx.Vin[inID].Sig = signature
-
-// 	}
-// } 
- 
-// func (tx *Transaction) TrimmedTxCopy() Transaction{
-// 	var inputs []TxInputs
-// 	var outputs []TxOutputs
-
-// 	for _, in := range tx.Vin{
-// 		inputs = append(inputs, TxInputs{in.TXID, in.Vout, nil, nil}) 
-// 	}
-// 	for _, out := range tx.Vout{
-// 		outputs = append(outputs, TxOutputs{out.Value, out.PubKeyHash})
-// 	}
-// 	txCopy := Transaction{tx.ID, inputs, outputs}
-// 	return txCopy
-// }
-
-// func (tx *Transaction) VerifyTx(privKey ecdsa.PrivateKey, prevTxs map[string]Transaction) bool{
-// 	if tx.IsCoinbaseTxn(){
-// 		return true
-// 	}
-// 	for _, in := range tx.Vin{
-// 		if prevTxs[hex.EncodeToString(in.TXID)].ID == nil{
-// 			panic("Error: Previous transaction not found")
-// 		}
-// 	}
-// 	txCopy := tx.TrimmedTxCopy()
-// 	curve := elliptic.P256()
-// 	for inId, in := range txCopy.Vin{
-// 		prevTxs := prevTxs[hex.EncodeToString(in.TXID)]
-// 		txCopy.Vin[inId].Sig = nil
-// 		txCopy.Vin[inId].PubKey = prevTxs.Vout[in.Vout].PubKeyHash
-// 		txCopy.ID = tx.Hash()
-// 		txCopy.Vin[inId].PubKey = nil
-// 		// Extract pub key and signature to verify message was signed by private key	
-// 		r := big.Int{}
-// 		s := big.Int{}
-// 		sigLen := len(in.Sig)
-// 		// Divide the signature in half (/2) to extract each part
-// 		r.SetBytes(in.Sig[:(sigLen / 2)])
-// 		s.SetBytes(in.Sig[(sigLen / 2):])
-
-
-// 		x := big.Int{}
-// 		y := big.Int{}
-
-// 		keyLen := len(in.PubKey)
-// 		x.SetBytes(in.PubKey[:(keyLen / 2)])
-// 		y.SetBytes(in.PubKey[(keyLen/2):])
-		
-// 		// Then using ECDSA, we create a new public key with the point x & y
-// 		rawPubKey := ecdsa.PublicKey{curve, &x, &y}
-
-
-
-// 	}
-// }
\ No newline at end of file
@@ -0,0 +1,46 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"main.go/wallet"
+)
+
+// The change goes to the change address given, or back to the sender without one
+func TestNewTransactionChange(t *testing.T) {
+	w := wallet.MakeWallet()
+	_, utxo := newTestChain(t, w)
+	to, change := wallet.MakeWallet(), wallet.MakeWallet()
+
+	tests := []struct {
+		change string
+		want   []byte
+	}{
+		{string(change.Address()), wallet.PubKeyHash(change.PubKey)},
+		{"", wallet.PubKeyHash(w.PubKey)},
+	}
+	for _, test := range tests {
+		tx := NewTransaction(w, string(to.Address()), test.change, 20, 0, utxo)
+		if len(tx.Vout) != 2 || !bytes.Equal(tx.Vout[0].PubKeyHash, wallet.PubKeyHash(to.PubKey)) {
+			t.Fatalf("change %q: outputs %+v", test.change, tx.Vout)
+		}
+		if out := tx.Vout[1]; out.Value != 30 || !bytes.Equal(out.PubKeyHash, test.want) {
+			t.Errorf("change %q: change output %+v", test.change, out)
+		}
+		if !utxo.Blockchain.VerifyTx(tx) {
+			t.Errorf("change %q: transaction does not verify", test.change)
+		}
+
+		unsigned := NewUnsignedTransaction(nil, wallet.PubKeyHash(w.PubKey), []TxOutputs{*NewTxOutput(20, string(to.Address()))}, test.change, 0, utxo)
+		if out := unsigned.Vout[1]; out.Value != 30 || !bytes.Equal(out.PubKeyHash, test.want) {
+			t.Errorf("change %q: unsigned change output %+v", test.change, out)
+		}
+	}
+
+	// nothing is left for change when the whole output is spent
+	tx := NewTransaction(w, string(to.Address()), string(change.Address()), 50, 0, utxo)
+	if len(tx.Vout) != 1 {
+		t.Errorf("spend of the whole output has %d outputs", len(tx.Vout))
+	}
+}
@@ -2,24 +2,47 @@ package blockchain
 
 import (
 	"bytes"
-	"encoding/gob"
 
+	"main.go/codec"
 	"main.go/wallet"
 )
 
+const (
+	// OutputPubKeyHash outputs are locked to the hash of a single public key
+	OutputPubKeyHash = iota
+	// OutputScriptHash outputs are locked to the hash of a redeem script the spender reveals
+	OutputScriptHash
+	// OutputData outputs carry up to MaxDataSize bytes and can never be spent
+	OutputData
+)
+
+// MaxDataSize caps the payload of a data output
+const MaxDataSize = 80
+
 type TxInputs struct{
 	TXID []byte
 	Vout int
 	Sig []byte
 	PubKey []byte
+	// Set only when spending a script hash output
+	Redeem []byte
+	Sigs [][]byte
+	// Secret revealed when redeeming an HTLC
+	Preimage []byte
+	// Relative lock time, see SequenceLockTimeMask
+	Sequence uint32
 }
 
 type TxOutputs struct{
 	Value int 
 	PubKeyHash []byte
+	Kind int
+	Data []byte
 }
 type OutputsArr struct{
 	Outputs []TxOutputs
+	// Indexes[i] is the position of Outputs[i] in its transaction
+	Indexes []int
 }
 func (in *TxInputs) UsesKey(pubKeyHash []byte) bool{
 	lockingHash := wallet.PubKeyHash(in.PubKey)
@@ -28,9 +51,10 @@ func (in *TxInputs) UsesKey(pubKeyHash []byte) bool{
 }
 
 func (out *TxOutputs) Lock(address []byte) {
-	pubKeyHash := wallet.Base58Decode(address)
-	pubKeyHash = pubKeyHash[1: len(pubKeyHash) - 4]
-	out.PubKeyHash = pubKeyHash
+	out.PubKeyHash = wallet.AddressHash(string(address))
+	if wallet.IsScriptAddress(string(address)){
+		out.Kind = OutputScriptHash
+	}
 }
 
 func (out *TxOutputs) IsLockedWithKey(pubKeyHash []byte) bool{
@@ -38,26 +62,56 @@ func (out *TxOutputs) IsLockedWithKey(pubKeyHash []byte) bool{
 	return cmp == 0
 }
 
+// Address returns the address the output is locked to
+func (out TxOutputs) Address() string {
+	if out.Kind == OutputScriptHash{
+		return string(wallet.ScriptAddress(out.PubKeyHash))
+	}
+	return string(wallet.PubKeyHashAddress(out.PubKeyHash))
+}
+
+// NewDataOutput returns an unspendable output carrying data
+func NewDataOutput(data []byte) *TxOutputs {
+	return &TxOutputs{Kind: OutputData, Data: data}
+}
+
+func (out *TxOutputs) IsData() bool {
+	return out.Kind == OutputData
+}
+
 func NewTxOutput(value int, address string) *TxOutputs {
-	newOut := &TxOutputs{value, nil}
+	newOut := &TxOutputs{Value: value}
 	newOut.Lock([]byte(address))
 
 	return newOut
 }
 
+func (outs *OutputsArr) Add(idx int, out TxOutputs) {
+	outs.Outputs = append(outs.Outputs, out)
+	outs.Indexes = append(outs.Indexes, idx)
+}
+
+// Index returns the position of Outputs[i] in its transaction.
+// Sets written before Indexes existed are assumed to hold every output in order
+func (outs OutputsArr) Index(i int) int {
+	if len(outs.Indexes) != len(outs.Outputs) {
+		return i
+	}
+	return outs.Indexes[i]
+}
+
 func (outs OutputsArr) SerializeOutputs() []byte{
-	buff := new(bytes.Buffer)
-	encoder := gob.NewEncoder(buff)
-	err := encoder.Encode(outs)
-	HandleErr(err)
-	return buff.Bytes()
+	w := codec.NewWriter()
+	w.Uvarint(uint64(len(outs.Outputs)))
+	for i := range outs.Outputs{
+		w.Varint(int64(outs.Index(i)))
+		outs.Outputs[i].encode(w)
+	}
+	return w.Data()
 } 
 
 func DeserializeOutputs(data []byte) OutputsArr{
-	var outs OutputsArr 
-
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-	err := decoder.Decode(&outs)
+	outs, err := parseStoredOutputs(data)
 	HandleErr(err)
 
 	return outs
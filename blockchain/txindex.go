@@ -0,0 +1,82 @@
+package blockchain
+
+import (
+	"bytes"
+
+	badger "github.com/dgraph-io/badger/v3"
+	"main.go/codec"
+)
+
+// TxIndexName names the optional transaction index, see EnableIndex
+const TxIndexName = "txindex"
+
+// txIndexPrefix keys the block hash and position of a best chain transaction, by transaction ID
+var txIndexPrefix = []byte("txi-")
+
+var txIndex = &chainIndex{
+	name:     TxIndexName,
+	prefixes: [][]byte{txIndexPrefix},
+	connect: func(txn *badger.Txn, block *Block) error {
+		for i, tx := range block.Transactions {
+			w := codec.NewRawWriter()
+			w.Bytes(block.Hash)
+			w.Uvarint(uint64(i))
+			if err := txn.Set(append(append([]byte{}, txIndexPrefix...), tx.ID...), w.Data()); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	disconnect: func(txn *badger.Txn, block *Block) error {
+		for _, tx := range block.Transactions {
+			key := append(append([]byte{}, txIndexPrefix...), tx.ID...)
+			blockHash, _, err := readTxIndexEntry(txn, tx.ID)
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			// a transaction mined again on the new branch keeps that entry
+			if bytes.Equal(blockHash, block.Hash) {
+				if err := txn.Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	},
+}
+
+func readTxIndexEntry(txn *badger.Txn, ID []byte) ([]byte, int, error) {
+	value, err := getValue(txn, txIndexPrefix, ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	r := codec.NewRawReader(value)
+	blockHash := r.Bytes()
+	pos := int(r.Uvarint())
+	return blockHash, pos, r.Done()
+}
+
+// LookupTx returns the block hash and position of a best chain transaction from the txindex.
+// It reports false when the index is not in sync or does not hold the transaction
+func (chain *BlockChain) LookupTx(ID []byte) ([]byte, int, bool) {
+	var blockHash []byte
+	var pos int
+	found := false
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		if indexState(txn, TxIndexName) != indexInSync {
+			return nil
+		}
+		var err error
+		blockHash, pos, err = readTxIndexEntry(txn, ID)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		found = err == nil
+		return err
+	})
+	HandleErr(err)
+	return blockHash, pos, found
+}
@@ -0,0 +1,168 @@
+package blockchain
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"main.go/wallet"
+)
+
+// reorgFixture is a chain whose best block a1, on top of genesis, holds a payment, and a
+// longer branch b1, b2 from genesis, not added yet, that mines the payment again in b2
+type reorgFixture struct {
+	chain        *BlockChain
+	payer, payee *wallet.Wallet
+	miner        string
+	payment      *Transaction
+	genesis      []byte
+	a1, b1, b2   *Block
+}
+
+// newReorg builds a reorgFixture with the named indexes enabled before a1 is mined
+func newReorg(t *testing.T, indexes ...string) *reorgFixture {
+	t.Helper()
+	f := &reorgFixture{payer: wallet.MakeWallet(), payee: wallet.MakeWallet()}
+	f.miner = string(wallet.MakeWallet().Address())
+	var utxo *UTXOset
+	f.chain, utxo = newTestChain(t, f.payer)
+	for _, name := range indexes {
+		if err := f.chain.EnableIndex(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.genesis = f.chain.LastHash
+	f.payment = NewTransaction(f.payer, string(f.payee.Address()), "", 20, 0, utxo)
+	f.a1 = f.chain.MineBlock([]*Transaction{CoinbaseTx(f.miner, ""), f.payment})
+	f.b1 = CreateBlock([]*Transaction{CoinbaseTx(f.miner, "")}, f.genesis, 1)
+	f.b2 = CreateBlock([]*Transaction{CoinbaseTx(f.miner, ""), f.payment}, f.b1.Hash, 2)
+	return f
+}
+
+// reorg adds b1, which does not move the best chain, then b2, which moves it to the b branch
+func (f *reorgFixture) reorg() {
+	f.chain.AddBlock(f.b1)
+	f.chain.AddBlock(f.b2)
+}
+
+// indexEntries returns the entries of the database under prefixes
+func indexEntries(t *testing.T, chain *BlockChain, prefixes ...[]byte) map[string]string {
+	t.Helper()
+	entries := make(map[string]string)
+	for key, value := range values(t, chain) {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, string(prefix)) {
+				entries[key] = string(value)
+			}
+		}
+	}
+	return entries
+}
+
+// checkRebuilt fails unless rebuilding the named index from scratch gives the entries it has
+func checkRebuilt(t *testing.T, chain *BlockChain, name string, prefixes ...[]byte) {
+	t.Helper()
+	before := indexEntries(t, chain, prefixes...)
+	if err := chain.RebuildIndex(name); err != nil {
+		t.Fatal(err)
+	}
+	after := indexEntries(t, chain, prefixes...)
+	if len(before) != len(after) {
+		t.Errorf("%s: %d entries, %d once rebuilt", name, len(before), len(after))
+	}
+	for key, value := range after {
+		if before[key] != value {
+			t.Errorf("%s: entry %x differs from the rebuilt one", name, key)
+		}
+	}
+}
+
+func checkLookupTx(t *testing.T, chain *BlockChain, tx *Transaction, block *Block, pos int) {
+	t.Helper()
+	blockHash, got, found := chain.LookupTx(tx.ID)
+	if block == nil {
+		if found {
+			t.Errorf("transaction %x still indexed in %x", tx.ID, blockHash)
+		}
+		return
+	}
+	if !found || !bytes.Equal(blockHash, block.Hash) || got != pos {
+		t.Errorf("transaction %x indexed at %x:%d (%v), want %x:%d", tx.ID, blockHash, got, found, block.Hash, pos)
+	}
+}
+
+// A reorg drops the transactions of the disconnected branch from the txindex and indexes
+// those of the new branch, a transaction on both at its new place
+func TestTxIndexReorg(t *testing.T) {
+	f := newReorg(t, TxIndexName)
+	checkLookupTx(t, f.chain, f.payment, f.a1, 1)
+
+	f.chain.AddBlock(f.b1)
+	checkLookupTx(t, f.chain, f.a1.Transactions[0], f.a1, 0)
+	checkLookupTx(t, f.chain, f.b1.Transactions[0], nil, 0)
+
+	f.chain.AddBlock(f.b2)
+	if !f.chain.IndexInSync(TxIndexName) {
+		t.Fatal("txindex not in sync after the reorg")
+	}
+	checkLookupTx(t, f.chain, f.payment, f.b2, 1)
+	checkLookupTx(t, f.chain, f.a1.Transactions[0], nil, 0)
+	checkLookupTx(t, f.chain, f.b1.Transactions[0], f.b1, 0)
+	checkLookupTx(t, f.chain, f.b2.Transactions[0], f.b2, 0)
+	if _, block, err := f.chain.FindTrxBlock(f.payment.ID); err != nil || !bytes.Equal(block.Hash, f.b2.Hash) {
+		t.Errorf("FindTrxBlock found the payment in %v, %v, want b2", block, err)
+	}
+	if _, err := f.chain.FindTrxById(f.a1.Transactions[0].ID); err == nil {
+		t.Error("FindTrxById found the coinbase of the disconnected block")
+	}
+	checkRebuilt(t, f.chain, TxIndexName, txIndexPrefix)
+}
+
+// When the new tip's branch has a block not stored yet the enabled indexes go stale, and
+// are not read, until SyncIndexes rebuilds them
+func TestIndexesStaleUntilSync(t *testing.T) {
+	f := newReorg(t, TxIndexName)
+	f.chain.AddBlock(f.b2)
+	if f.chain.IndexInSync(TxIndexName) || !f.chain.IndexEnabled(TxIndexName) {
+		t.Fatal("txindex not stale after a tip whose parent is missing")
+	}
+	if _, _, found := f.chain.LookupTx(f.payment.ID); found {
+		t.Error("stale txindex read")
+	}
+
+	f.chain.AddBlock(f.b1)
+	f.chain.SyncIndexes()
+	for _, name := range []string{TxIndexName, HeightIndexName} {
+		if !f.chain.IndexInSync(name) {
+			t.Errorf("%s not in sync after SyncIndexes", name)
+		}
+	}
+	if f.chain.IndexEnabled(AddrIndexName) {
+		t.Error("SyncIndexes enabled the address index")
+	}
+	checkLookupTx(t, f.chain, f.payment, f.b2, 1)
+	checkLookupTx(t, f.chain, f.a1.Transactions[0], nil, 0)
+}
+
+func TestDisableIndex(t *testing.T) {
+	f := newReorg(t, TxIndexName)
+	if err := f.chain.DisableIndex(TxIndexName); err != nil {
+		t.Fatal(err)
+	}
+	if f.chain.IndexEnabled(TxIndexName) || len(indexEntries(t, f.chain, txIndexPrefix)) != 0 {
+		t.Error("txindex kept once disabled")
+	}
+	f.reorg()
+	if f.chain.IndexEnabled(TxIndexName) || len(indexEntries(t, f.chain, txIndexPrefix)) != 0 {
+		t.Error("disabled txindex updated by a reorg")
+	}
+	if _, block, err := f.chain.FindTrxBlock(f.payment.ID); err != nil || !bytes.Equal(block.Hash, f.b2.Hash) {
+		t.Errorf("FindTrxBlock without the txindex found the payment in %v, %v, want b2", block, err)
+	}
+	if err := f.chain.DisableIndex(HeightIndexName); err == nil {
+		t.Error("height index disabled")
+	}
+	if err := f.chain.EnableIndex("nosuchindex"); err == nil {
+		t.Error("unknown index enabled")
+	}
+}
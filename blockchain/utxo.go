@@ -140,10 +140,10 @@ func (u UTXOset) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[s
 			txID := hex.EncodeToString(k)
 			outs := DeserializeOutputs(value)
 
-			for outIdx, out := range outs.Outputs {
+			for i, out := range outs.Outputs {
 				if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
 					accumulated += out.Value
-					unspentOuts[txID] = append(unspentOuts[txID], outIdx)
+					unspentOuts[txID] = append(unspentOuts[txID], outs.Index(i))
 				}
 			}
 		}
@@ -207,9 +207,9 @@ func (utxo *UTXOset) Update(block *Block) {
 
 					outs := DeserializeOutputs(value)
 
-					for outIdx, out := range outs.Outputs {
-						if outIdx != in.Vout {
-							updatedOuts.Outputs = append(updatedOuts.Outputs, out)
+					for i, out := range outs.Outputs {
+						if outs.Index(i) != in.Vout {
+							updatedOuts.Add(outs.Index(i), out)
 						}
 					}
 
@@ -227,9 +227,15 @@ func (utxo *UTXOset) Update(block *Block) {
 			}
 
 			newOutputs := OutputsArr{}
-			
-			newOutputs.Outputs = append(newOutputs.Outputs, tx.Vout...)
-		
+			for outIdx, out := range tx.Vout {
+				// Data outputs can never be spent, so they stay out of the set
+				if !out.IsData() {
+					newOutputs.Add(outIdx, out)
+				}
+			}
+			if len(newOutputs.Outputs) == 0 {
+				continue
+			}
 
 			txID := append(utxoPrefix, tx.ID...)
 			if err := txn.Set(txID, newOutputs.SerializeOutputs()); err != nil {
@@ -0,0 +1,185 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	legacy "main.go/blockchain/legacy"
+	"main.go/wallet"
+)
+
+// newTestChain creates a chain in a fresh working directory whose genesis reward goes to w,
+// with its UTXO set built
+func newTestChain(t *testing.T, w *wallet.Wallet) (*BlockChain, *UTXOset) {
+	t.Helper()
+	inTempDir(t)
+	chain := InitializeBlockchain(string(w.Address()), "test")
+	t.Cleanup(func() { chain.Database.Close() })
+	utxo := &UTXOset{Blockchain: chain}
+	utxo.Reindex()
+	return chain, utxo
+}
+
+// utxoEntry reads the UTXO set entry of txid, reporting whether there is one
+func utxoEntry(t *testing.T, chain *BlockChain, txid []byte) (OutputsArr, bool) {
+	t.Helper()
+	var outs OutputsArr
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(append(append([]byte{}, utxoPrefix...), txid...))
+		if err != nil {
+			return err
+		}
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		outs, err = parseStoredOutputs(value)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return outs, false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return outs, true
+}
+
+// A data output never enters the UTXO set, and the outputs after it keep their index
+// whether the set is updated block by block or rebuilt
+func TestDataOutputNotInUTXOSet(t *testing.T) {
+	w := wallet.MakeWallet()
+	chain, utxo := newTestChain(t, w)
+	pubKeyHash := wallet.PubKeyHash(w.PubKey)
+
+	outputs := []TxOutputs{*NewDataOutput([]byte("anchored digest"))}
+	tx := NewTransactionWithOutputs(w, outputs, "", 0, utxo)
+	if len(tx.Vout) != 2 || !tx.Vout[0].IsData() {
+		t.Fatalf("anchor has outputs %+v, want the data output and change", tx.Vout)
+	}
+	block := chain.MineBlock([]*Transaction{CoinbaseTx(string(w.Address()), ""), tx})
+	utxo.Update(block)
+
+	check := func(how string) {
+		outs, ok := utxoEntry(t, chain, tx.ID)
+		if !ok || len(outs.Outputs) != 1 || outs.Index(0) != 1 || outs.Outputs[0].IsData() {
+			t.Errorf("%s: UTXO set entry %+v, want the change output at index 1", how, outs)
+		}
+		for _, out := range utxo.FindUTXO(pubKeyHash) {
+			if out.IsData() {
+				t.Errorf("%s: FindUTXO returned a data output", how)
+			}
+		}
+		_, spendable := utxo.FindSpendableOutputs(pubKeyHash, 1000)
+		if got := spendable[hex.EncodeToString(tx.ID)]; len(got) != 1 || got[0] != 1 {
+			t.Errorf("%s: spendable outputs of the anchor %v, want [1]", how, got)
+		}
+		if unspent := chain.FindUTXO()[hex.EncodeToString(tx.ID)]; len(unspent.Outputs) != 1 || unspent.Index(0) != 1 {
+			t.Errorf("%s: chain UTXO of the anchor %+v", how, unspent)
+		}
+	}
+	check("updated")
+	utxo.Reindex()
+	check("reindexed")
+
+	// spending the change removes the entry, the data output is not left behind
+	spend := NewTransaction(w, string(w.Address()), "", 100, 0, utxo)
+	spendsChange := false
+	for _, in := range spend.Vin {
+		if bytes.Equal(in.TXID, tx.ID) {
+			spendsChange = in.Vout == 1
+		}
+	}
+	if !spendsChange {
+		t.Fatal("spend does not take the anchor's change at index 1")
+	}
+	utxo.Update(chain.MineBlock([]*Transaction{CoinbaseTx(string(w.Address()), ""), spend}))
+	if outs, ok := utxoEntry(t, chain, tx.ID); ok {
+		t.Errorf("anchor still in the UTXO set after its change was spent: %+v", outs)
+	}
+}
+
+func TestOutputsIndex(t *testing.T) {
+	outs := OutputsArr{Outputs: make([]TxOutputs, 3)}
+	for i := range outs.Outputs {
+		if outs.Index(i) != i {
+			t.Errorf("without indexes, Index(%d) = %d", i, outs.Index(i))
+		}
+	}
+	outs.Indexes = []int{0, 2, 5}
+	if outs.Index(1) != 2 || outs.Index(2) != 5 {
+		t.Errorf("Index = %d, %d, want 2, 5", outs.Index(1), outs.Index(2))
+	}
+}
+
+// UTXO set entries written by the baseline have no indexes: every output of the transaction
+// is there in order, and spending one by its Vout finds it
+func TestBaselineUTXOEntries(t *testing.T) {
+	var coinbases []*Transaction
+	for _, block := range baselineBlocks(t) {
+		coinbases = append(coinbases, block.Transactions[0])
+	}
+	chain := openBaselineChain(t)
+	utxo := &UTXOset{Blockchain: chain}
+
+	for _, coinbase := range coinbases {
+		outs, ok := utxoEntry(t, chain, coinbase.ID)
+		if !ok || len(outs.Indexes) != 0 || len(outs.Outputs) != len(coinbase.Vout) {
+			t.Fatalf("baseline entry of %x: %+v", coinbase.ID, outs)
+		}
+		pubKeyHash := coinbase.Vout[0].PubKeyHash
+		_, spendable := utxo.FindSpendableOutputs(pubKeyHash, 1<<30)
+		if got := spendable[hex.EncodeToString(coinbase.ID)]; len(got) != 1 || got[0] != 0 {
+			t.Errorf("spendable outputs of %x: %v, want [0]", coinbase.ID, got)
+		}
+	}
+
+	// a spend of another index leaves the entry, a spend of index 0 removes it
+	coinbase := coinbases[0]
+	spend := func(vout int) {
+		tx := &Transaction{Vin: []TxInputs{{TXID: coinbase.ID, Vout: vout}}, Version: TxVersion}
+		utxo.Update(&Block{Transactions: []*Transaction{tx}})
+	}
+	spend(1)
+	if outs, ok := utxoEntry(t, chain, coinbase.ID); !ok || len(outs.Outputs) != 1 || outs.Index(0) != 0 {
+		t.Errorf("spend of index 1 changed the entry to %+v", outs)
+	}
+	spend(0)
+	if _, ok := utxoEntry(t, chain, coinbase.ID); ok {
+		t.Error("spend of index 0 left the baseline entry")
+	}
+
+	// a gob entry of several outputs, as the baseline wrote for a payment with change
+	pubKeyHash := bytes.Repeat([]byte{0x42}, 20)
+	txid := bytes.Repeat([]byte{0x07}, 32)
+	var old struct{ Outputs []legacy.TxOutputs }
+	for _, value := range []int{10, 20, 30} {
+		old.Outputs = append(old.Outputs, legacy.TxOutputs{Value: value, PubKeyHash: pubKeyHash})
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(old); err != nil {
+		t.Fatal(err)
+	}
+	err := chain.Database.Update(func(txn *badger.Txn) error {
+		return txn.Set(append(append([]byte{}, utxoPrefix...), txid...), buf.Bytes())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase = &Transaction{ID: txid}
+	spend(1)
+	outs, ok := utxoEntry(t, chain, txid)
+	if !ok || len(outs.Outputs) != 2 || outs.Outputs[0].Value != 10 || outs.Outputs[1].Value != 30 {
+		t.Fatalf("spend of index 1 left %+v, want the outputs of 10 and 30", outs)
+	}
+	if outs.Index(0) != 0 || outs.Index(1) != 2 {
+		t.Errorf("remaining outputs at %d and %d, want 0 and 2", outs.Index(0), outs.Index(1))
+	}
+	_, spendable := utxo.FindSpendableOutputs(pubKeyHash, 100)
+	if got := spendable[hex.EncodeToString(txid)]; len(got) != 2 || got[0] != 0 || got[1] != 2 {
+		t.Errorf("spendable outputs %v, want [0 2]", got)
+	}
+}
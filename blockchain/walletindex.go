@@ -0,0 +1,456 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	badger "github.com/dgraph-io/badger/v3"
+	"main.go/codec"
+)
+
+// WalletIndexName names the index of the transactions touching a node's wallet keys,
+// enabled by SetWalletKeys
+const WalletIndexName = "walletindex"
+
+// CoinbaseMaturity is the number of confirmations before the wallet counts a coinbase
+// output as confirmed balance. The chain itself does not enforce it
+const CoinbaseMaturity = 100
+
+// walletKeyPrefix keys the PubKeyHashes the wallet index follows, see SetWalletKeys.
+// walletTxPrefix keys the received and sent amounts of a best chain wallet transaction by
+// height and position in its block, as 8 and 4 bytes big endian. walletOutPrefix keys the
+// PubKeyHash, value, height and kind of every output paying the wallet, by outpoint.
+// walletPendingPrefix keys the wallet transactions sent but not mined yet, by ID
+var (
+	walletKeyPrefix     = []byte("wk-")
+	walletTxPrefix      = []byte("wtx-")
+	walletOutPrefix     = []byte("wo-")
+	walletPendingPrefix = []byte("wp-")
+)
+
+// WalletOutput is an unspent output paying one of the wallet keys. Pending outputs belong
+// to a transaction not mined yet and have no confirmations
+type WalletOutput struct {
+	TxID          []byte
+	Index         int
+	Value         int
+	PubKeyHash    []byte
+	Height        int
+	Confirmations int
+	Coinbase      bool
+	Pending       bool
+}
+
+// WalletTx is a transaction touching the wallet keys, with the value it paid to them
+// and the value it spent from them
+type WalletTx struct {
+	TxID          []byte
+	Height        int
+	Confirmations int
+	Received      int
+	Sent          int
+	Coinbase      bool
+	Pending       bool
+}
+
+// WalletBalance splits the value of the wallet's unspent outputs: Immature holds coinbase
+// outputs short of CoinbaseMaturity confirmations, Unconfirmed the outputs of pending transactions
+type WalletBalance struct {
+	Confirmed   int
+	Unconfirmed int
+	Immature    int
+}
+
+func walletTxKey(height, pos int) []byte {
+	var h [8]byte
+	var p [4]byte
+	binary.BigEndian.PutUint64(h[:], uint64(height))
+	binary.BigEndian.PutUint32(p[:], uint32(pos))
+	key := append(append([]byte{}, walletTxPrefix...), h[:]...)
+	return append(key, p[:]...)
+}
+
+func readWalletKeys(txn *badger.Txn) map[string]bool {
+	keys := make(map[string]bool)
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = walletKeyPrefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		keys[string(it.Item().Key()[len(walletKeyPrefix):])] = true
+	}
+	return keys
+}
+
+// readWalletOut returns the value of an output paying the wallet
+func readWalletOut(txn *badger.Txn, txid []byte, vout int) (WalletOutput, error) {
+	value, err := getValue(txn, walletOutPrefix, OutpointItem(txid, vout))
+	if err != nil {
+		return WalletOutput{}, err
+	}
+	r := codec.NewRawReader(value)
+	out := WalletOutput{TxID: txid, Index: vout}
+	out.PubKeyHash = r.Bytes()
+	out.Value = r.Int()
+	out.Height = int(r.Uvarint())
+	out.Coinbase = r.Bool()
+	return out, r.Done()
+}
+
+// readPending returns the pending wallet transactions
+func readPending(txn *badger.Txn) ([]Transaction, error) {
+	var txs []Transaction
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = walletPendingPrefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		value, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := ParseTrx(value)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// walletAmounts returns what tx pays to the wallet keys and spends from outputs paying
+// them, mined ones or those of the pending transactions
+func walletAmounts(txn *badger.Txn, tx *Transaction, keys map[string]bool, pending []Transaction) (int, int, error) {
+	received, sent := 0, 0
+	for _, out := range tx.Vout {
+		if !out.IsData() && keys[string(out.PubKeyHash)] {
+			received += out.Value
+		}
+	}
+	if tx.IsCoinbaseTxn() {
+		return received, sent, nil
+	}
+	for _, in := range tx.Vin {
+		out, err := readWalletOut(txn, in.TXID, in.Vout)
+		if err == nil {
+			sent += out.Value
+			continue
+		}
+		if err != badger.ErrKeyNotFound {
+			return 0, 0, err
+		}
+		for _, p := range pending {
+			if bytes.Equal(p.ID, in.TXID) && in.Vout < len(p.Vout) && keys[string(p.Vout[in.Vout].PubKeyHash)] {
+				sent += p.Vout[in.Vout].Value
+			}
+		}
+	}
+	return received, sent, nil
+}
+
+var walletIndex = &chainIndex{
+	name:     WalletIndexName,
+	prefixes: [][]byte{walletTxPrefix, walletOutPrefix},
+	connect: func(txn *badger.Txn, block *Block) error {
+		keys := readWalletKeys(txn)
+		spent := make(map[string]bool)
+		for pos, tx := range block.Transactions {
+			received, sent, err := walletAmounts(txn, tx, keys, nil)
+			if err != nil {
+				return err
+			}
+			if !tx.IsCoinbaseTxn() {
+				for _, in := range tx.Vin {
+					spent[string(OutpointItem(in.TXID, in.Vout))] = true
+				}
+			}
+			if err := txn.Delete(append(append([]byte{}, walletPendingPrefix...), tx.ID...)); err != nil {
+				return err
+			}
+			if received == 0 && sent == 0 {
+				continue
+			}
+			w := codec.NewRawWriter()
+			w.Bytes(tx.ID)
+			w.Varint(int64(received))
+			w.Varint(int64(sent))
+			if err := txn.Set(walletTxKey(block.Height, pos), w.Data()); err != nil {
+				return err
+			}
+			for vout, out := range tx.Vout {
+				if out.IsData() || !keys[string(out.PubKeyHash)] {
+					continue
+				}
+				w := codec.NewRawWriter()
+				w.Bytes(out.PubKeyHash)
+				w.Varint(int64(out.Value))
+				w.Uvarint(uint64(block.Height))
+				w.Bool(tx.IsCoinbaseTxn())
+				outKey := append(append([]byte{}, walletOutPrefix...), OutpointItem(tx.ID, vout)...)
+				if err := txn.Set(outKey, w.Data()); err != nil {
+					return err
+				}
+			}
+		}
+		// pending transactions spending the same outputs as the block can never be mined
+		pending, err := readPending(txn)
+		if err != nil {
+			return err
+		}
+		for _, tx := range pending {
+			for _, in := range tx.Vin {
+				if spent[string(OutpointItem(in.TXID, in.Vout))] {
+					if err := txn.Delete(append(append([]byte{}, walletPendingPrefix...), tx.ID...)); err != nil {
+						return err
+					}
+					break
+				}
+			}
+		}
+		return nil
+	},
+	// wallet transactions of a disconnected block are pending again, but for the coinbase
+	disconnect: func(txn *badger.Txn, block *Block) error {
+		for pos := len(block.Transactions) - 1; pos >= 0; pos-- {
+			tx := block.Transactions[pos]
+			key := walletTxKey(block.Height, pos)
+			if _, err := txn.Get(key); err == badger.ErrKeyNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+			for vout := range tx.Vout {
+				outKey := append(append([]byte{}, walletOutPrefix...), OutpointItem(tx.ID, vout)...)
+				if err := txn.Delete(outKey); err != nil {
+					return err
+				}
+			}
+			if !tx.IsCoinbaseTxn() {
+				pendingKey := append(append([]byte{}, walletPendingPrefix...), tx.ID...)
+				if err := txn.Set(pendingKey, tx.SerializeTx()); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	},
+}
+
+// SetWalletKeys makes the wallet index follow pubKeyHashes, the hashes of every address of
+// the wallet. The index is enabled on first use and built again whenever the hashes change
+func (chain *BlockChain) SetWalletKeys(pubKeyHashes [][]byte) error {
+	changed := false
+	var state byte
+	err := chain.Database.Update(func(txn *badger.Txn) error {
+		state = indexState(txn, WalletIndexName)
+		keys := readWalletKeys(txn)
+		wanted := make(map[string]bool)
+		for _, hash := range pubKeyHashes {
+			wanted[string(hash)] = true
+			if !keys[string(hash)] {
+				changed = true
+				if err := txn.Set(append(append([]byte{}, walletKeyPrefix...), hash...), []byte{}); err != nil {
+					return err
+				}
+			}
+		}
+		for hash := range keys {
+			if !wanted[hash] {
+				changed = true
+				if err := txn.Delete(append(append([]byte{}, walletKeyPrefix...), hash...)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	HandleErr(err)
+	if changed || state == 0 {
+		return chain.EnableIndex(WalletIndexName)
+	}
+	if state == indexStale {
+		return chain.RebuildIndex(WalletIndexName)
+	}
+	return nil
+}
+
+// AddPendingTx keeps tx as a pending wallet transaction until it is mined, when it
+// touches the wallet keys. It reports whether tx was kept
+func (chain *BlockChain) AddPendingTx(tx *Transaction) bool {
+	kept := false
+	err := chain.Database.Update(func(txn *badger.Txn) error {
+		if indexState(txn, WalletIndexName) != indexInSync {
+			return nil
+		}
+		pending, err := readPending(txn)
+		if err != nil {
+			return err
+		}
+		received, sent, err := walletAmounts(txn, tx, readWalletKeys(txn), pending)
+		if err != nil || (received == 0 && sent == 0) {
+			return err
+		}
+		kept = true
+		return txn.Set(append(append([]byte{}, walletPendingPrefix...), tx.ID...), tx.SerializeTx())
+	})
+	HandleErr(err)
+	return kept
+}
+
+// WalletUnspent returns the outputs paying the wallet keys that are neither spent in the
+// best chain nor by a pending wallet transaction, oldest first and pending ones last
+func (chain *BlockChain) WalletUnspent() ([]WalletOutput, error) {
+	var unspent []WalletOutput
+	best := chain.GetBestHeight()
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		keys := readWalletKeys(txn)
+		pending, err := readPending(txn)
+		if err != nil {
+			return err
+		}
+		pendingSpent := make(map[string]bool)
+		for _, tx := range pending {
+			for _, in := range tx.Vin {
+				pendingSpent[string(OutpointItem(in.TXID, in.Vout))] = true
+			}
+		}
+
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = walletOutPrefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			outpoint := it.Item().KeyCopy(nil)[len(walletOutPrefix):]
+			if pendingSpent[string(outpoint)] || len(outpoint) < 4 {
+				continue
+			}
+			txid := outpoint[:len(outpoint)-4]
+			vout := int(binary.BigEndian.Uint32(outpoint[len(outpoint)-4:]))
+			value, err := getValue(txn, utxoPrefix, txid)
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			outs := DeserializeOutputs(value)
+			for i := range outs.Outputs {
+				if outs.Index(i) != vout {
+					continue
+				}
+				out, err := readWalletOut(txn, txid, vout)
+				if err != nil {
+					return err
+				}
+				out.Confirmations = best - out.Height + 1
+				unspent = append(unspent, out)
+			}
+		}
+
+		for _, tx := range pending {
+			for vout, out := range tx.Vout {
+				if out.IsData() || !keys[string(out.PubKeyHash)] || pendingSpent[string(OutpointItem(tx.ID, vout))] {
+					continue
+				}
+				unspent = append(unspent, WalletOutput{
+					TxID:       tx.ID,
+					Index:      vout,
+					Value:      out.Value,
+					PubKeyHash: out.PubKeyHash,
+					Pending:    true,
+				})
+			}
+		}
+		return nil
+	})
+	sort.SliceStable(unspent, func(i, j int) bool {
+		if unspent[i].Pending != unspent[j].Pending {
+			return !unspent[i].Pending
+		}
+		return unspent[i].Height < unspent[j].Height
+	})
+	return unspent, err
+}
+
+// GetWalletBalance sums the wallet's unspent outputs, see WalletUnspent
+func (chain *BlockChain) GetWalletBalance() (WalletBalance, error) {
+	var balance WalletBalance
+	unspent, err := chain.WalletUnspent()
+	for _, out := range unspent {
+		switch {
+		case out.Pending:
+			balance.Unconfirmed += out.Value
+		case out.Coinbase && out.Confirmations < CoinbaseMaturity:
+			balance.Immature += out.Value
+		default:
+			balance.Confirmed += out.Value
+		}
+	}
+	return balance, err
+}
+
+// WalletTransactions returns up to count wallet transactions after the skip most recent
+// ones, most recent first, and the number of wallet transactions. Pending transactions come
+// first. A count of 0 returns all transactions after skip
+func (chain *BlockChain) WalletTransactions(skip, count int) ([]WalletTx, int, error) {
+	var all []WalletTx
+	best := chain.GetBestHeight()
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		keys := readWalletKeys(txn)
+		pending, err := readPending(txn)
+		if err != nil {
+			return err
+		}
+		for i := range pending {
+			received, sent, err := walletAmounts(txn, &pending[i], keys, pending)
+			if err != nil {
+				return err
+			}
+			all = append(all, WalletTx{TxID: pending[i].ID, Received: received, Sent: sent, Pending: true})
+		}
+
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = walletTxPrefix
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(append(append([]byte{}, walletTxPrefix...), 0xff)); it.Valid(); it.Next() {
+			key := it.Item().KeyCopy(nil)[len(walletTxPrefix):]
+			if len(key) != 8+4 {
+				continue
+			}
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			r := codec.NewRawReader(value)
+			entry := WalletTx{
+				TxID:     r.Bytes(),
+				Height:   int(binary.BigEndian.Uint64(key[:8])),
+				Received: r.Int(),
+				Sent:     r.Int(),
+				Coinbase: binary.BigEndian.Uint32(key[8:]) == 0,
+			}
+			if err := r.Done(); err != nil {
+				return err
+			}
+			entry.Confirmations = best - entry.Height + 1
+			all = append(all, entry)
+		}
+		return nil
+	})
+	total := len(all)
+	if skip > total {
+		skip = total
+	}
+	all = all[skip:]
+	if count > 0 && count < len(all) {
+		all = all[:count]
+	}
+	return all, total, err
+}
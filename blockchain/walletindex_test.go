@@ -0,0 +1,148 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"main.go/wallet"
+)
+
+// walletTestKeys makes the wallet index follow the payer, the payee and the miner of f
+func walletTestKeys(t *testing.T, f *reorgFixture) {
+	t.Helper()
+	keys := [][]byte{
+		wallet.PubKeyHash(f.payer.PubKey),
+		wallet.PubKeyHash(f.payee.PubKey),
+		wallet.AddressHash(f.miner),
+	}
+	if err := f.chain.SetWalletKeys(keys); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkWalletBalance(t *testing.T, chain *BlockChain, want WalletBalance) {
+	t.Helper()
+	if balance, err := chain.GetWalletBalance(); err != nil || balance != want {
+		t.Errorf("wallet balance %+v, %v, want %+v", balance, err, want)
+	}
+}
+
+func checkWalletTxs(t *testing.T, chain *BlockChain, want ...WalletTx) {
+	t.Helper()
+	txs, total, err := chain.WalletTransactions(0, 0)
+	if err != nil || total != len(want) || len(txs) != len(want) {
+		t.Fatalf("%d of %d wallet transactions, %v, want %d", len(txs), total, err, len(want))
+	}
+	for i, tx := range txs {
+		w := want[i]
+		if !bytes.Equal(tx.TxID, w.TxID) || tx.Height != w.Height || tx.Confirmations != w.Confirmations ||
+			tx.Received != w.Received || tx.Sent != w.Sent || tx.Coinbase != w.Coinbase || tx.Pending != w.Pending {
+			t.Errorf("wallet transaction %d is %+v, want %+v", i, tx, w)
+		}
+	}
+}
+
+// Balances, unspent outputs and transactions follow blocks, pending transactions and
+// a reorg, and match the index built again from scratch
+func TestWalletIndex(t *testing.T) {
+	f := newReorg(t)
+	walletTestKeys(t, f)
+	utxo := &UTXOset{Blockchain: f.chain}
+	utxo.Reindex()
+	genesis, err := f.chain.GetBlock(f.genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funding := genesis.Transactions[0].ID
+
+	checkWalletBalance(t, f.chain, WalletBalance{Confirmed: 50, Immature: 50})
+	checkWalletTxs(t, f.chain,
+		WalletTx{TxID: f.payment.ID, Height: 1, Confirmations: 1, Received: 50, Sent: 50},
+		WalletTx{TxID: f.a1.Transactions[0].ID, Height: 1, Confirmations: 1, Received: 50, Coinbase: true},
+		WalletTx{TxID: funding, Height: 0, Confirmations: 2, Received: 50, Coinbase: true})
+
+	// the payee pays the miner back, the output it spends leaves the unspent ones
+	refund := NewTransaction(f.payee, f.miner, "", 5, 0, utxo)
+	if !f.chain.AddPendingTx(refund) {
+		t.Fatal("wallet transaction not kept pending")
+	}
+	prev, _ := fundingTx(TxOutputs{Value: 10, PubKeyHash: bytes.Repeat([]byte{0xee}, 20)})
+	unrelated := spendTx(prev, TxInputs{}, 0)
+	if f.chain.AddPendingTx(unrelated) {
+		t.Error("transaction not touching the wallet kept pending")
+	}
+	checkWalletBalance(t, f.chain, WalletBalance{Confirmed: 30, Unconfirmed: 20, Immature: 50})
+	unspent, err := f.chain.WalletUnspent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, out := range unspent {
+		if bytes.Equal(out.TxID, f.payment.ID) && out.Index == 0 {
+			t.Error("output spent by a pending transaction listed as unspent")
+		}
+	}
+	if last := unspent[len(unspent)-1]; !last.Pending || !bytes.Equal(last.TxID, refund.ID) {
+		t.Errorf("last unspent output %+v, want one of the pending refund", last)
+	}
+
+	f.reorg()
+	utxo.Reindex()
+	if !f.chain.IndexInSync(WalletIndexName) {
+		t.Fatal("wallet index not in sync after the reorg")
+	}
+	checkWalletBalance(t, f.chain, WalletBalance{Confirmed: 30, Unconfirmed: 20, Immature: 100})
+	checkWalletTxs(t, f.chain,
+		WalletTx{TxID: refund.ID, Received: 20, Sent: 20, Pending: true},
+		WalletTx{TxID: f.payment.ID, Height: 2, Confirmations: 1, Received: 50, Sent: 50},
+		WalletTx{TxID: f.b2.Transactions[0].ID, Height: 2, Confirmations: 1, Received: 50, Coinbase: true},
+		WalletTx{TxID: f.b1.Transactions[0].ID, Height: 1, Confirmations: 2, Received: 50, Coinbase: true},
+		WalletTx{TxID: funding, Height: 0, Confirmations: 3, Received: 50, Coinbase: true})
+	page, total, err := f.chain.WalletTransactions(1, 2)
+	if err != nil || total != 5 || len(page) != 2 || !bytes.Equal(page[0].TxID, f.payment.ID) {
+		t.Errorf("page of 2 after 1: %+v, %d, %v", page, total, err)
+	}
+	checkRebuilt(t, f.chain, WalletIndexName, walletTxPrefix, walletOutPrefix)
+
+	// a pending transaction is dropped once mined, or once another spend of its outputs is
+	spend := NewTransaction(f.payer, f.miner, "", 10, 0, utxo)
+	if !f.chain.AddPendingTx(spend) {
+		t.Fatal("spend not kept pending")
+	}
+	conflict := NewTransaction(f.payer, string(f.payee.Address()), "", 10, 0, utxo)
+	if !bytes.Equal(OutpointItem(spend.Vin[0].TXID, spend.Vin[0].Vout), OutpointItem(conflict.Vin[0].TXID, conflict.Vin[0].Vout)) {
+		t.Fatal("conflicting transaction spends another output")
+	}
+	utxo.Update(f.chain.MineBlock([]*Transaction{CoinbaseTx(f.miner, ""), refund, conflict}))
+	txs, _, err := f.chain.WalletTransactions(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range txs {
+		if tx.Pending {
+			t.Errorf("%x still pending", tx.TxID)
+		}
+	}
+}
+
+// A wallet transaction of a disconnected block not mined on the new branch is pending again
+func TestWalletIndexUnminedByReorg(t *testing.T) {
+	f := newReorg(t)
+	walletTestKeys(t, f)
+	c1 := CreateBlock([]*Transaction{CoinbaseTx(f.miner, "")}, f.genesis, 1)
+	c2 := CreateBlock([]*Transaction{CoinbaseTx(f.miner, "")}, c1.Hash, 2)
+	f.chain.AddBlock(c1)
+	f.chain.AddBlock(c2)
+
+	txs, total, err := f.chain.WalletTransactions(0, 0)
+	if err != nil || total != 4 || len(txs) != 4 {
+		t.Fatalf("%d of %d wallet transactions, %v, want 4", len(txs), total, err)
+	}
+	if !txs[0].Pending || !bytes.Equal(txs[0].TxID, f.payment.ID) || txs[0].Received != 50 || txs[0].Sent != 50 {
+		t.Errorf("first wallet transaction %+v, want the payment pending", txs[0])
+	}
+	for _, tx := range txs {
+		if bytes.Equal(tx.TxID, f.a1.Transactions[0].ID) {
+			t.Error("coinbase of the disconnected block kept")
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+
+	"main.go/blockchain"
+	"main.go/wallet"
+)
+
+// anchor commits the sha256 of a file to the chain in a data output
+func (cli *CommandLine) anchor(nodeId, from, path string, mineNow bool) {
+	if !wallet.ValidateAddress(from) {
+		panic("Invalid wallet address")
+	}
+	digest := hashFile(path)
+
+	chain := blockchain.ContinueBlockchain(nodeId)
+	UTXOSet := blockchain.UTXOset{Blockchain: chain}
+	wallets, err := wallet.CreateWallets(nodeId)
+	blockchain.HandleErr(err)
+	w := spendingWallet(nodeId, wallets, from)
+
+	outputs := []blockchain.TxOutputs{*blockchain.NewDataOutput(digest)}
+	change := changeAddress(wallets)
+	tx := blockchain.NewTransactionWithOutputs(&w, outputs, change, 0, &UTXOSet)
+	chain.Database.Close()
+	wallets.SaveFile(nodeId)
+
+	fmt.Printf("File hash: %x\n", digest)
+	fmt.Printf("Anchor tx: %x\n", tx.ID)
+	cli.broadcast(nodeId, tx, mineNow)
+}
+
+// verifyAnchor finds the transaction committing to a file's hash and checks the block it was mined in
+func (cli *CommandLine) verifyAnchor(nodeId, path string) {
+	digest := hashFile(path)
+	fmt.Printf("File hash: %x\n", digest)
+
+	chain := blockchain.ContinueBlockchain(nodeId)
+	defer chain.Database.Close()
+
+	tx, block, found := chain.FindDataOutput(digest)
+	if !found {
+		fmt.Println("Not anchored on this chain")
+		return
+	}
+	pow := blockchain.ComputeTargetForBlock(block)
+	confirmations := chain.GetBestHeight() - block.Height + 1
+
+	fmt.Printf("Anchor tx:     %x\n", tx.ID)
+	fmt.Printf("Block:         %x\n", block.Hash)
+	fmt.Printf("Height:        %d\n", block.Height)
+	fmt.Printf("Timestamp:     %d\n", block.Timestamp)
+	fmt.Printf("Confirmations: %d\n", confirmations)
+	fmt.Printf("Merkle root:   %x\n", block.HashTransactions())
+	fmt.Printf("POW valid:     %t\n", pow.ValidatePOW())
+}
+
+func hashFile(path string) []byte {
+	content, err := os.ReadFile(path)
+	blockchain.HandleErr(err)
+	digest := sha256.Sum256(content)
+	return digest[:]
+}
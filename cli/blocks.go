@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"fmt"
+
+	"main.go/blockchain"
+)
+
+// getBlock prints count best chain blocks starting at height, lowest first
+func (cli *CommandLine) getBlock(nodeId string, height, count int) {
+	chain := blockchain.ContinueBlockchain(nodeId)
+	defer chain.Database.Close()
+	blocks, err := chain.GetBlockRange(height, height+count-1)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for i := range blocks {
+		printBlock(&blocks[i])
+	}
+}
+
+func (cli *CommandLine) getBlockHash(nodeId string, height int) {
+	chain := blockchain.ContinueBlockchain(nodeId)
+	defer chain.Database.Close()
+	hash, err := chain.GetBlockHash(height)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%x\n", hash)
+}
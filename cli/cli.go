@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"main.go/blockchain"
@@ -8,21 +9,66 @@ import (
 	"main.go/wallet"
 	"os"
 	"runtime"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type CommandLine struct{}
 
 func (cli *CommandLine) printUsage() {
 	fmt.Println("Usage:")
-	fmt.Println("getbalance -address ADDRESS - get balance for an address")
+	fmt.Println("getbalance -address ADDRESS -spv - get balance for an address, -spv from the merkle proofs of a header only node")
 	fmt.Println("createblockchain -address ADDRESS creates a blockchain and sends rewards to address ")
 	fmt.Println("printchain - prints the blocks in the chain")
-	fmt.Println("send -from FROM -to TO - amount AMOUNT -mine - Send amount of coins")
-	fmt.Println("createwallet - Creates a new wallet")
-	fmt.Println("listaddresses - Lists the addresses in the wallet file")
+	fmt.Println("send -from FROM -to TO - amount AMOUNT -locktime LOCKTIME -data HEX -mine - Send amount of coins")
+	fmt.Println("sendmany -from FROM -file PATH -mine - Pays every address,amount of a CSV file or address: amount of a JSON object in one transaction")
+	fmt.Println("createwallet -mnemonic - Creates a new wallet, with -mnemonic an HD wallet backed up by the printed words")
+	fmt.Println("restorewallet -mnemonic WORDS - Restores an HD wallet and finds its used keys in the chain")
+	fmt.Println("listaddresses -change -label LABEL -verbose - Lists the addresses in the wallet file, with -change also the change addresses")
+	fmt.Println("setlabel -address ADDRESS -label LABEL -note NOTE - Labels an address of the wallet, -note keeps a note on it")
 	fmt.Println(" reindexutxo - Rebuilds the UTXO set")
-	fmt.Println("startnode -miner ADDRESS")
+	fmt.Println(" migratedb - Rewrites blocks and the UTXO set stored by older versions in the current format")
+	fmt.Println(" txindex -enable -disable - Builds and keeps, or deletes, the index of transactions by ID")
+	fmt.Println("gettransaction -txid TXID - Prints a mined transaction and its block")
+	fmt.Println(" importwatch -address ADDRESS | -pubkey HEX | -xpub XPUB - Watches addresses without their keys")
+	fmt.Println(" dumpprivkey -address ADDRESS - Prints the private key of ADDRESS for importprivkey")
+	fmt.Println(" importprivkey -key KEY -rescan - Adds an exported private key, with -rescan rebuilds the UTXO set")
+	fmt.Println(" importpubkey -pubkey HEX -rescan - Watches the address of a public key, with -rescan rebuilds the UTXO set")
+	fmt.Println(" signmessage -address ADDRESS -message MESSAGE - Signs MESSAGE with the key of ADDRESS to prove ownership")
+	fmt.Println(" verifymessage -address ADDRESS -signature SIG -message MESSAGE - Checks that the key of ADDRESS signed MESSAGE")
+	fmt.Println(" getxpub - Prints the extended public key of the HD wallet, to watch it elsewhere")
+	fmt.Println(" createpsbt -from FROM -to TO -amount AMOUNT | -tx FILE -out FILE - Writes a spend to sign offline, from a watch-only address or an unsigned tx file")
+	fmt.Println(" signpsbt -in FILE -address ADDRESS -sighash TYPE - Adds the signatures of ADDRESS, without the chain")
+	fmt.Println(" combinepsbt -in FILE,FILE... -out FILE - Merges the signatures of copies of one partially signed tx")
+	fmt.Println(" finalizepsbt -in FILE -out TXFILE - Writes the signed tx once every input has its signatures")
+	fmt.Println(" sendpsbt -in FILE -mine - Finalizes and sends the tx")
+	fmt.Println(" encryptwallet - Encrypts the private keys of the wallet with a passphrase")
+	fmt.Println(" walletpassphrase -timeout SECONDS - Unlocks the encrypted wallet for SECONDS")
+	fmt.Println(" walletlock - Locks the encrypted wallet again")
+	fmt.Println(" addrindex -enable -disable - Builds and keeps, or deletes, the index of outputs received and spent by address")
+	fmt.Println("history -address ADDRESS -skip N -count M - Lists outputs received and spent by ADDRESS with the running balance")
+	fmt.Println("getwalletbalance - Prints the confirmed, unconfirmed and immature balance of every wallet address")
+	fmt.Println("listunspent -minconf N -maxconf M - Lists the unspent outputs of the wallet with N to M confirmations")
+	fmt.Println("listtransactions -skip N -count M - Lists the transactions of the wallet, most recent first")
+	fmt.Println("getblock -height HEIGHT -count N - Prints N best chain blocks from HEIGHT")
+	fmt.Println("getblockhash -height HEIGHT - Prints the hash of the best chain block at HEIGHT")
+	fmt.Println("startnode -miner ADDRESS -spv -rescan HEIGHT -bloom - -spv syncs only headers and proofs of the wallet's transactions, -rescan scans the wallet from HEIGHT again, -bloom has the peer filter blocks and transactions with a Bloom filter")
+	fmt.Println("getpubkey -address ADDRESS - Prints the public key of a wallet address")
+	fmt.Println("createmultisig -required M -pubkeys KEY,KEY,... - Creates an M-of-N multisig address")
+	fmt.Println("spendmultisig -from MULTISIG -to TO -amount AMOUNT -out FILE - Writes an unsigned multisig spend to FILE")
+	fmt.Println("signmultisig -in FILE -address ADDRESS -sighash TYPE - Adds the signature of ADDRESS to the spend in FILE")
+	fmt.Println("sendmultisig -in FILE -mine - Broadcasts a multisig spend once enough signatures are collected")
+	fmt.Println("initiateswap -from FROM -to PARTICIPANT -amount AMOUNT -locktime LOCKTIME -mine - Starts an atomic swap with a new secret")
+	fmt.Println("participateswap -from FROM -to INITIATOR -amount AMOUNT -secrethash HASH -locktime LOCKTIME -mine - Answers an atomic swap")
+	fmt.Println("redeemswap -contract CONTRACT -txid TXID -secret SECRET -mine - Claims a swap contract with the secret")
+	fmt.Println("refundswap -contract CONTRACT -txid TXID -mine - Takes back an expired swap contract")
+	fmt.Println("auditswap -contract CONTRACT -txid TXID - Prints a swap contract and whether it was redeemed")
+	fmt.Println("anchor -from FROM -file PATH -mine - Commits the hash of a file to the chain")
+	fmt.Println("verifyanchor -file PATH - Proves a file's hash was committed to the chain")
+	fmt.Println("gettxproof -txid TXID - Prints a merkle proof that a transaction was mined")
+	fmt.Println("verifytxproof -proof PROOF - Checks a merkle proof printed by gettxproof")
 }
 
 func (cli *CommandLine) validateArgs() {
@@ -32,20 +78,26 @@ func (cli *CommandLine) validateArgs() {
 	}
 }
 
+func printBlock(block *blockchain.Block) {
+	fmt.Printf("Block Hash: %x \n", block.Hash)
+	fmt.Printf("Block PrevHash: %x \n", block.PrevHash)
+	fmt.Printf("Version: %d Height: %d Timestamp: %d Bits: %d Nonce: %d\n", block.Version, block.Height, block.Timestamp, block.Bits, block.Nonce)
+	fmt.Printf("Merkle root: %x\n", block.MerkleRoot)
+	// fmt.Printf("Block Data: %s \n", block.Data)
+	pow := blockchain.ComputeTargetForBlock(block)
+	fmt.Printf("POW %s\n", strconv.FormatBool(pow.ValidatePOW()))
+	for _, tx := range block.Transactions {
+		fmt.Println(tx.StringRep())
+	}
+}
+
 func (cli *CommandLine) printChain(nodeId string) {
 	chain := blockchain.ContinueBlockchain(nodeId)
 	defer chain.Database.Close()
 	iter := chain.Iterator()
 	for {
 		block := iter.Next()
-		fmt.Printf("Block Hash: %x \n", block.Hash)
-		fmt.Printf("Block PrevHash: %x \n", block.PrevHash)
-		// fmt.Printf("Block Data: %s \n", block.Data)
-		new := blockchain.ComputeTargetForBlock(block)
-		fmt.Printf("POW %s\n", strconv.FormatBool(new.ValidatePOW()))
-		for _, tx := range block.Transactions {
-			fmt.Println(tx.StringRep())
-		}
+		printBlock(block)
 
 		if len(block.PrevHash) == 0 {
 			break
@@ -70,8 +122,8 @@ func (cli *CommandLine) createBlockchain(nodeId,address string) {
 		panic("Invalid wallet address")
 	}
 	chain := blockchain.InitializeBlockchain(address, nodeId)
-	chain.Database.Close()
-	UTXOSet := blockchain.UTXOset{chain}
+	defer chain.Database.Close()
+	UTXOSet := blockchain.UTXOset{Blockchain: chain}
 	UTXOSet.Reindex()
 
 	fmt.Println("Finished")
@@ -82,12 +134,11 @@ func (cli *CommandLine) getBalance(nodeId,address string) {
 		panic("Invalid wallet address")
 	}
 	chain := blockchain.ContinueBlockchain(nodeId)
-	UTXOSet := blockchain.UTXOset{chain}
+	UTXOSet := blockchain.UTXOset{Blockchain: chain}
 	defer chain.Database.Close()
 
 	balance := 0
-	pubKeyHash := wallet.Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
+	pubKeyHash := wallet.AddressHash(address)
 
 	UTXOs := UTXOSet.FindUTXO(pubKeyHash)
 	// "Coins owned by the wallet address owner on the blockchain"
@@ -97,7 +148,7 @@ func (cli *CommandLine) getBalance(nodeId,address string) {
 	fmt.Printf("Balance of %s: %d\n", address, balance)
 }
 
-func (cli *CommandLine) send(from, to, nodeID string, amount int, mineNow bool) {
+func (cli *CommandLine) send(from, to, nodeID string, amount int, lockTime int64, dataHex string, mineNow bool, unsignedFile string) {
 	if !wallet.ValidateAddress(from) {
 		panic("Invalid wallet address")
 	}
@@ -106,32 +157,167 @@ func (cli *CommandLine) send(from, to, nodeID string, amount int, mineNow bool)
 	}
 	// fmt.Printf("Send called")
 	chain := blockchain.ContinueBlockchain(nodeID)
-	UTXOSet := blockchain.UTXOset{chain}
-	defer chain.Database.Close()
+	UTXOSet := blockchain.UTXOset{Blockchain: chain}
+
+	outputs := []blockchain.TxOutputs{*blockchain.NewTxOutput(amount, to)}
+	if dataHex != "" {
+		data, err := hex.DecodeString(dataHex)
+		blockchain.HandleErr(err)
+		if len(data) > blockchain.MaxDataSize {
+			panic(fmt.Sprintf("Data is larger than %d bytes", blockchain.MaxDataSize))
+		}
+		outputs = append(outputs, *blockchain.NewDataOutput(data))
+	}
 
 	wallets, err := wallet.CreateWallets(nodeID)
 	blockchain.HandleErr(err)
-	wallet := wallets.GetWallet(from)
+	if unsignedFile != "" {
+		tx := unsignedSpend(nodeID, wallets, from, outputs, lockTime, &UTXOSet)
+		chain.Database.Close()
+		writeTxFile(unsignedFile, tx)
+		fmt.Printf("Unsigned transaction written to %s, sign it with signmultisig and send it with sendmultisig\n", unsignedFile)
+		return
+	}
+	wallet := spendingWallet(nodeID, wallets, from)
+	change := changeAddress(wallets)
+	tx := blockchain.NewTransactionWithOutputs(&wallet, outputs, change, lockTime, &UTXOSet)
+	chain.Database.Close()
+	wallets.SaveFile(nodeID)
+	cli.broadcast(nodeID, tx, mineNow)
+}
+
+func (cli *CommandLine) getPubKey(nodeId, address string) {
+	wallets, err := wallet.CreateWallets(nodeId)
+	blockchain.HandleErr(err)
+	w := wallets.GetWallet(address)
+	fmt.Printf("%x\n", w.PubKey)
+}
+
+func (cli *CommandLine) createMultisig(nodeId string, required int, pubKeysArg string) {
+	var pubKeys [][]byte
+	for _, key := range strings.Split(pubKeysArg, ",") {
+		pubKey, err := hex.DecodeString(strings.TrimSpace(key))
+		blockchain.HandleErr(err)
+		pubKeys = append(pubKeys, pubKey)
+	}
+	script, err := blockchain.NewMultisigScript(required, pubKeys)
+	blockchain.HandleErr(err)
+
+	wallets, _ := wallet.CreateWallets(nodeId)
+	address := string(script.Address())
+	wallets.AddScript(address, script.Serialize())
+	wallets.SaveFile(nodeId)
+
+	fmt.Printf("Multisig address (%d of %d): %s\n", required, len(pubKeys), address)
+	fmt.Printf("Redeem script: %x\n", script.Serialize())
+}
+
+func (cli *CommandLine) spendMultisig(nodeId, from, to string, amount int, outFile string) {
+	if !wallet.ValidateAddress(from) || !wallet.IsScriptAddress(from) {
+		panic("Invalid multisig address")
+	}
+	if !wallet.ValidateAddress(to) {
+		panic("Invalid wallet address")
+	}
+	wallets, err := wallet.CreateWallets(nodeId)
+	blockchain.HandleErr(err)
+	redeem, ok := wallets.GetScript(from)
+	if !ok {
+		panic("Multisig address is not in the wallet, run createmultisig first")
+	}
+	script, err := blockchain.DeserializeScript(redeem)
+	blockchain.HandleErr(err)
+	if script.Type != blockchain.ScriptMultisig {
+		panic("Not a multisig address")
+	}
+
+	chain := blockchain.ContinueBlockchain(nodeId)
+	defer chain.Database.Close()
+	UTXOSet := blockchain.UTXOset{Blockchain: chain}
+
+	tx := blockchain.NewMultisigTransaction(redeem, to, amount, &UTXOSet)
+	writeTxFile(outFile, tx)
+	fmt.Printf("Unsigned spend written to %s, %d signatures needed\n", outFile, script.Required)
+}
+
+func (cli *CommandLine) signMultisig(nodeId, inFile, address, sigHash string) {
+	hashType, err := blockchain.ParseSigHashType(sigHash)
+	blockchain.HandleErr(err)
+	wallets, err := wallet.CreateWallets(nodeId)
+	blockchain.HandleErr(err)
+	signer := spendingWallet(nodeId, wallets, address)
+
+	chain := blockchain.ContinueBlockchain(nodeId)
+	defer chain.Database.Close()
+
+	tx := readTxFile(inFile)
+	chain.SignTrxWithType(&tx, signer.PrivKey, hashType)
+	writeTxFile(inFile, &tx)
+
+	for idx, in := range tx.Vin {
+		fmt.Printf("Input %d: %d of %d signatures\n", idx, in.CountSigs(), len(in.Sigs))
+	}
+}
+
+func (cli *CommandLine) sendMultisig(nodeId, inFile string, mineNow bool) {
+	tx := readTxFile(inFile)
+	if !tx.IsFullySigned() {
+		panic("Not enough signatures collected")
+	}
+	cli.broadcast(nodeId, &tx, mineNow)
+}
 
+// broadcast mines tx into a new block on this node, paying the reward to the first address
+// tx pays, or hands it to the first known node and keeps it as a pending wallet transaction
+func (cli *CommandLine) broadcast(nodeId string, tx *blockchain.Transaction, mineNow bool) {
+	if mineNow {
+		rewardTo := rewardAddress(tx)
+		chain := blockchain.ContinueBlockchain(nodeId)
+		defer chain.Database.Close()
+		UTXOSet := blockchain.UTXOset{Blockchain: chain}
 
-	tx := blockchain.NewTransaction(&wallet, to, amount, &UTXOSet)
-	if mineNow{
-		coinBtx := blockchain.CoinbaseTx(to, "")
+		coinBtx := blockchain.CoinbaseTx(rewardTo, "")
 		txs := []*blockchain.Transaction{coinBtx, tx}
 		block := chain.MineBlock(txs)
 		UTXOSet.Update(block)
-	}else{
+	} else {
+		chain := blockchain.ContinueBlockchain(nodeId)
+		chain.AddPendingTx(tx)
+		chain.Database.Close()
 		network.SendTx(network.KnownNodes[0], tx)
 		fmt.Println("sent tx")
 	}
+	fmt.Println("Success")
+}
 
+// rewardAddress is the address of the first output of tx that is not a data output,
+// the recipient of a plain send
+func rewardAddress(tx *blockchain.Transaction) string {
+	for _, out := range tx.Vout {
+		if !out.IsData() {
+			return out.Address()
+		}
+	}
+	panic("Transaction pays no address to reward")
+}
 
-	
-	fmt.Println("Success")
+func writeTxFile(path string, tx *blockchain.Transaction) {
+	data := hex.EncodeToString(tx.SerializeTx())
+	err := os.WriteFile(path, []byte(data), 0644)
+	blockchain.HandleErr(err)
+}
+
+func readTxFile(path string) blockchain.Transaction {
+	data, err := os.ReadFile(path)
+	blockchain.HandleErr(err)
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	blockchain.HandleErr(err)
+	return blockchain.DeserializeTrx(raw)
 }
 
 func (cli *CommandLine) Run() {
 	cli.validateArgs()
+	blockchain.HandleErr(wallet.RemoveExpiredUnlocks())
 
 	nodeID := os.Getenv("NODE_ID")
 	if nodeID == ""{
@@ -143,19 +329,160 @@ func (cli *CommandLine) Run() {
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
+	sendManyCmd := flag.NewFlagSet("sendmany", flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
+	restoreWalletCmd := flag.NewFlagSet("restorewallet", flag.ExitOnError)
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	setLabelCmd := flag.NewFlagSet("setlabel", flag.ExitOnError)
 	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	migrateDBCmd := flag.NewFlagSet("migratedb", flag.ExitOnError)
+	txIndexCmd := flag.NewFlagSet("txindex", flag.ExitOnError)
+	getTransactionCmd := flag.NewFlagSet("gettransaction", flag.ExitOnError)
+	importWatchCmd := flag.NewFlagSet("importwatch", flag.ExitOnError)
+	getXpubCmd := flag.NewFlagSet("getxpub", flag.ExitOnError)
+	signMessageCmd := flag.NewFlagSet("signmessage", flag.ExitOnError)
+	verifyMessageCmd := flag.NewFlagSet("verifymessage", flag.ExitOnError)
+	dumpPrivKeyCmd := flag.NewFlagSet("dumpprivkey", flag.ExitOnError)
+	importPrivKeyCmd := flag.NewFlagSet("importprivkey", flag.ExitOnError)
+	importPubKeyCmd := flag.NewFlagSet("importpubkey", flag.ExitOnError)
+	createPSBTCmd := flag.NewFlagSet("createpsbt", flag.ExitOnError)
+	signPSBTCmd := flag.NewFlagSet("signpsbt", flag.ExitOnError)
+	combinePSBTCmd := flag.NewFlagSet("combinepsbt", flag.ExitOnError)
+	finalizePSBTCmd := flag.NewFlagSet("finalizepsbt", flag.ExitOnError)
+	sendPSBTCmd := flag.NewFlagSet("sendpsbt", flag.ExitOnError)
+	encryptWalletCmd := flag.NewFlagSet("encryptwallet", flag.ExitOnError)
+	walletPassphraseCmd := flag.NewFlagSet("walletpassphrase", flag.ExitOnError)
+	walletLockCmd := flag.NewFlagSet("walletlock", flag.ExitOnError)
+	addrIndexCmd := flag.NewFlagSet("addrindex", flag.ExitOnError)
+	historyCmd := flag.NewFlagSet("history", flag.ExitOnError)
+	getWalletBalanceCmd := flag.NewFlagSet("getwalletbalance", flag.ExitOnError)
+	listUnspentCmd := flag.NewFlagSet("listunspent", flag.ExitOnError)
+	listTransactionsCmd := flag.NewFlagSet("listtransactions", flag.ExitOnError)
+	getBlockCmd := flag.NewFlagSet("getblock", flag.ExitOnError)
+	getBlockHashCmd := flag.NewFlagSet("getblockhash", flag.ExitOnError)
 	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
+	getPubKeyCmd := flag.NewFlagSet("getpubkey", flag.ExitOnError)
+	createMultisigCmd := flag.NewFlagSet("createmultisig", flag.ExitOnError)
+	spendMultisigCmd := flag.NewFlagSet("spendmultisig", flag.ExitOnError)
+	signMultisigCmd := flag.NewFlagSet("signmultisig", flag.ExitOnError)
+	sendMultisigCmd := flag.NewFlagSet("sendmultisig", flag.ExitOnError)
+	initiateSwapCmd := flag.NewFlagSet("initiateswap", flag.ExitOnError)
+	participateSwapCmd := flag.NewFlagSet("participateswap", flag.ExitOnError)
+	redeemSwapCmd := flag.NewFlagSet("redeemswap", flag.ExitOnError)
+	refundSwapCmd := flag.NewFlagSet("refundswap", flag.ExitOnError)
+	auditSwapCmd := flag.NewFlagSet("auditswap", flag.ExitOnError)
+	anchorCmd := flag.NewFlagSet("anchor", flag.ExitOnError)
+	verifyAnchorCmd := flag.NewFlagSet("verifyanchor", flag.ExitOnError)
+	getTxProofCmd := flag.NewFlagSet("gettxproof", flag.ExitOnError)
+	verifyTxProofCmd := flag.NewFlagSet("verifytxproof", flag.ExitOnError)
 
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
+	createWalletMnemonic := createWalletCmd.Bool("mnemonic", false, "Derive the keys from a new seed and print its mnemonic")
+	listAddressesChange := listAddressesCmd.Bool("change", false, "Also list the addresses made for change")
+	listAddressesLabel := listAddressesCmd.String("label", "", "List only the addresses with this label")
+	listAddressesVerbose := listAddressesCmd.Bool("verbose", false, "Also print the purpose, creation time and note of each address")
+	setLabelAddress := setLabelCmd.String("address", "", "Address of the wallet to label")
+	setLabelLabel := setLabelCmd.String("label", "", "Label, empty to remove it")
+	setLabelNote := setLabelCmd.String("note", "", "Note to keep on the address, empty to remove it. Left as is when not given")
+	restoreWalletMnemonic := restoreWalletCmd.String("mnemonic", "", "Words of the mnemonic, quoted")
+	getBalanceSPV := getBalanceCmd.Bool("spv", false, "Use the proofs collected by startnode -spv")
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address of the recipient of genesis block reward")
 	sendFrom := sendCmd.String("from", "", "Wallet address of sender")
 	sendTo := sendCmd.String("to", "", "Wallet address of receiver")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to  send")
 	sendMine := sendCmd.Bool("mine", false, "Mine immediately on the same node")
+	sendData := sendCmd.String("data", "", "Hex data to attach in an unspendable output")
+	sendUnsigned := sendCmd.String("unsigned", "", "Write the transaction unsigned to this file instead of signing and sending it")
+	sendLockTime := sendCmd.Int64("locktime", 0, "Block height, or unix time if 500000000 or more, before which the tx cannot be mined")
+	sendManyFrom := sendManyCmd.String("from", "", "Wallet address paying every recipient")
+	sendManyFile := sendManyCmd.String("file", "", "JSON or CSV file of recipient addresses and amounts")
+	sendManyMine := sendManyCmd.Bool("mine", false, "Mine immediately on the same node")
+	txIndexEnable := txIndexCmd.Bool("enable", false, "Build the index and keep it as blocks are added")
+	txIndexDisable := txIndexCmd.Bool("disable", false, "Delete the index")
+	getTransactionID := getTransactionCmd.String("txid", "", "Transaction to look up")
+	importWatchAddress := importWatchCmd.String("address", "", "Address to watch")
+	importWatchPubKey := importWatchCmd.String("pubkey", "", "Hex public key whose address to watch")
+	importWatchXpub := importWatchCmd.String("xpub", "", "Extended public key of an account whose addresses to watch")
+	signMessageAddress := signMessageCmd.String("address", "", "Address whose key signs")
+	signMessageMessage := signMessageCmd.String("message", "", "Message to sign")
+	verifyMessageAddress := verifyMessageCmd.String("address", "", "Address that should have signed")
+	verifyMessageSignature := verifyMessageCmd.String("signature", "", "Base64 signature printed by signmessage")
+	verifyMessageMessage := verifyMessageCmd.String("message", "", "Message that was signed")
+	dumpPrivKeyAddress := dumpPrivKeyCmd.String("address", "", "Address whose key to print")
+	importPrivKeyKey := importPrivKeyCmd.String("key", "", "Key printed by dumpprivkey")
+	importPrivKeyRescan := importPrivKeyCmd.Bool("rescan", false, "Rebuild the UTXO set and print the balance of the key")
+	importPubKeyPubKey := importPubKeyCmd.String("pubkey", "", "Hex public key whose address to watch")
+	importPubKeyRescan := importPubKeyCmd.Bool("rescan", false, "Rebuild the UTXO set and print the balance of the key")
+	createPSBTFrom := createPSBTCmd.String("from", "", "Address to spend from")
+	createPSBTTo := createPSBTCmd.String("to", "", "Address to pay")
+	createPSBTAmount := createPSBTCmd.Int("amount", 0, "Amount to pay")
+	createPSBTTx := createPSBTCmd.String("tx", "", "Unsigned transaction file, such as one written by spendmultisig")
+	createPSBTOut := createPSBTCmd.String("out", "", "File to write")
+	signPSBTIn := signPSBTCmd.String("in", "", "File to sign, updated in place")
+	signPSBTAddress := signPSBTCmd.String("address", "", "Address whose key signs")
+	signPSBTSigHash := signPSBTCmd.String("sighash", "ALL", "Signature hash type: ALL, NONE or SINGLE, optionally |ANYONECANPAY")
+	combinePSBTIn := combinePSBTCmd.String("in", "", "Comma separated files to combine")
+	combinePSBTOut := combinePSBTCmd.String("out", "", "File to write")
+	finalizePSBTIn := finalizePSBTCmd.String("in", "", "File to finalize")
+	finalizePSBTOut := finalizePSBTCmd.String("out", "", "Signed transaction file to write")
+	sendPSBTIn := sendPSBTCmd.String("in", "", "File to finalize and send")
+	sendPSBTMine := sendPSBTCmd.Bool("mine", false, "Mine immediately on the same node")
+	walletPassphraseTimeout := walletPassphraseCmd.Int("timeout", 60, "Seconds the wallet stays unlocked")
+	addrIndexEnable := addrIndexCmd.Bool("enable", false, "Build the index and keep it as blocks are added")
+	addrIndexDisable := addrIndexCmd.Bool("disable", false, "Delete the index")
+	historyAddress := historyCmd.String("address", "", "Address to list")
+	historySkip := historyCmd.Int("skip", 0, "Number of oldest entries to skip")
+	historyCount := historyCmd.Int("count", 20, "Number of entries to list, 0 for all")
+	listUnspentMinConf := listUnspentCmd.Int("minconf", 1, "Fewest confirmations of the outputs to list, 0 for pending ones")
+	listUnspentMaxConf := listUnspentCmd.Int("maxconf", 9999999, "Most confirmations of the outputs to list")
+	listTransactionsSkip := listTransactionsCmd.Int("skip", 0, "Number of most recent transactions to skip")
+	listTransactionsCount := listTransactionsCmd.Int("count", 10, "Number of transactions to list, 0 for all")
+	getBlockHeight := getBlockCmd.Int("height", -1, "Height of the first block")
+	getBlockCount := getBlockCmd.Int("count", 1, "Number of blocks")
+	getBlockHashHeight := getBlockHashCmd.Int("height", -1, "Height of the block")
 	startNodeMiner := startNodeCmd.String("miner", "", "start mining!")
+	startNodeSPV := startNodeCmd.Bool("spv", false, "Sync and validate only headers, fetch proofs of the wallet's transactions")
+	startNodeRescan := startNodeCmd.Int("rescan", -1, "With -spv, match the wallet against the blocks from this height again")
+	startNodeBloom := startNodeCmd.Bool("bloom", false, "With -spv, load a Bloom filter into the peer instead of using compact filters")
+	getPubKeyAddress := getPubKeyCmd.String("address", "", "Wallet address to print the public key of")
+	createMultisigRequired := createMultisigCmd.Int("required", 0, "Number of signatures needed to spend")
+	createMultisigPubKeys := createMultisigCmd.String("pubkeys", "", "Comma separated hex public keys")
+	spendMultisigFrom := spendMultisigCmd.String("from", "", "Multisig address to spend from")
+	spendMultisigTo := spendMultisigCmd.String("to", "", "Wallet address of receiver")
+	spendMultisigAmount := spendMultisigCmd.Int("amount", 0, "Amount to send")
+	spendMultisigOut := spendMultisigCmd.String("out", "", "File to write the unsigned spend to")
+	signMultisigIn := signMultisigCmd.String("in", "", "File holding the spend to sign")
+	signMultisigAddress := signMultisigCmd.String("address", "", "Wallet address to sign with")
+	signMultisigSigHash := signMultisigCmd.String("sighash", "ALL", "Signature hash type: ALL, NONE or SINGLE, optionally |ANYONECANPAY")
+	sendMultisigIn := sendMultisigCmd.String("in", "", "File holding the signed spend")
+	sendMultisigMine := sendMultisigCmd.Bool("mine", false, "Mine immediately on the same node")
+	initiateSwapFrom := initiateSwapCmd.String("from", "", "Wallet address funding the contract")
+	initiateSwapTo := initiateSwapCmd.String("to", "", "Participant's address on this chain")
+	initiateSwapAmount := initiateSwapCmd.Int("amount", 0, "Amount to lock")
+	initiateSwapLockTime := initiateSwapCmd.Int64("locktime", 0, "Refund lock time, defaults to 48 blocks from now")
+	initiateSwapMine := initiateSwapCmd.Bool("mine", false, "Mine immediately on the same node")
+	participateSwapFrom := participateSwapCmd.String("from", "", "Wallet address funding the contract")
+	participateSwapTo := participateSwapCmd.String("to", "", "Initiator's address on this chain")
+	participateSwapAmount := participateSwapCmd.Int("amount", 0, "Amount to lock")
+	participateSwapSecretHash := participateSwapCmd.String("secrethash", "", "Secret hash from the initiator's contract")
+	participateSwapLockTime := participateSwapCmd.Int64("locktime", 0, "Refund lock time, defaults to 24 blocks from now")
+	participateSwapMine := participateSwapCmd.Bool("mine", false, "Mine immediately on the same node")
+	redeemSwapContract := redeemSwapCmd.String("contract", "", "Contract in hex")
+	redeemSwapTxid := redeemSwapCmd.String("txid", "", "Transaction paying to the contract")
+	redeemSwapSecret := redeemSwapCmd.String("secret", "", "Secret in hex")
+	redeemSwapMine := redeemSwapCmd.Bool("mine", false, "Mine immediately on the same node")
+	refundSwapContract := refundSwapCmd.String("contract", "", "Contract in hex")
+	refundSwapTxid := refundSwapCmd.String("txid", "", "Transaction paying to the contract")
+	refundSwapMine := refundSwapCmd.Bool("mine", false, "Mine immediately on the same node")
+	auditSwapContract := auditSwapCmd.String("contract", "", "Contract in hex")
+	auditSwapTxid := auditSwapCmd.String("txid", "", "Transaction paying to the contract")
+	anchorFrom := anchorCmd.String("from", "", "Wallet address paying for the anchor")
+	anchorFile := anchorCmd.String("file", "", "File to anchor")
+	anchorMine := anchorCmd.Bool("mine", false, "Mine immediately on the same node")
+	verifyAnchorFile := verifyAnchorCmd.String("file", "", "File to look up")
+	getTxProofID := getTxProofCmd.String("txid", "", "Transaction to prove")
+	verifyTxProofData := verifyTxProofCmd.String("proof", "", "Proof printed by gettxproof")
 
 	switch os.Args[1] {
 	case "getbalance":
@@ -171,18 +498,144 @@ func (cli *CommandLine) Run() {
 	case "send":
 		err := sendCmd.Parse(os.Args[2:])
 		blockchain.HandleErr(err)
+	case "restorewallet":
+		err := restoreWalletCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
 	case "createwallet":
 		err := createWalletCmd.Parse(os.Args[2:])
 		blockchain.HandleErr(err)
+	case "sendmany":
+		err := sendManyCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
 	case "listaddresses":
 		err := listAddressesCmd.Parse(os.Args[2:])
 		blockchain.HandleErr(err)
+	case "setlabel":
+		err := setLabelCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
 	case "reindexutxo":
 		err := reindexUTXOCmd.Parse(os.Args[2:])
 		blockchain.HandleErr(err)
+	case "migratedb":
+		err := migrateDBCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "txindex":
+		err := txIndexCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "gettransaction":
+		err := getTransactionCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "importwatch":
+		err := importWatchCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "dumpprivkey":
+		err := dumpPrivKeyCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "importprivkey":
+		err := importPrivKeyCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "importpubkey":
+		err := importPubKeyCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "signmessage":
+		err := signMessageCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "verifymessage":
+		err := verifyMessageCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "getxpub":
+		err := getXpubCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "createpsbt":
+		err := createPSBTCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "signpsbt":
+		err := signPSBTCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "combinepsbt":
+		err := combinePSBTCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "finalizepsbt":
+		err := finalizePSBTCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "sendpsbt":
+		err := sendPSBTCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "encryptwallet":
+		err := encryptWalletCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "walletpassphrase":
+		err := walletPassphraseCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "walletlock":
+		err := walletLockCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "addrindex":
+		err := addrIndexCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "history":
+		err := historyCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "getwalletbalance":
+		err := getWalletBalanceCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "listunspent":
+		err := listUnspentCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "listtransactions":
+		err := listTransactionsCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "getblock":
+		err := getBlockCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "getblockhash":
+		err := getBlockHashCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
 	case "startnode":
 		err := startNodeCmd.Parse(os.Args[2:])
 		blockchain.HandleErr(err)
+	case "getpubkey":
+		err := getPubKeyCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "createmultisig":
+		err := createMultisigCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "spendmultisig":
+		err := spendMultisigCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "signmultisig":
+		err := signMultisigCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "sendmultisig":
+		err := sendMultisigCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "initiateswap":
+		err := initiateSwapCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "participateswap":
+		err := participateSwapCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "redeemswap":
+		err := redeemSwapCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "refundswap":
+		err := refundSwapCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "auditswap":
+		err := auditSwapCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "anchor":
+		err := anchorCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "verifyanchor":
+		err := verifyAnchorCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "gettxproof":
+		err := getTxProofCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
+	case "verifytxproof":
+		err := verifyTxProofCmd.Parse(os.Args[2:])
+		blockchain.HandleErr(err)
 	default:
 		cli.printUsage()
 		runtime.Goexit()
@@ -193,7 +646,194 @@ func (cli *CommandLine) Run() {
 			getBalanceCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.getBalance(*getBalanceAddress, nodeID)
+		if *getBalanceSPV {
+			cli.getSPVBalance(nodeID, *getBalanceAddress)
+		} else {
+			cli.getBalance(nodeID, *getBalanceAddress)
+		}
+	}
+
+	if txIndexCmd.Parsed() {
+		if *txIndexEnable == *txIndexDisable {
+			txIndexCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.setIndex(nodeID, blockchain.TxIndexName, *txIndexEnable)
+	}
+
+	if getTransactionCmd.Parsed() {
+		if *getTransactionID == "" {
+			getTransactionCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getTransaction(nodeID, *getTransactionID)
+	}
+
+	if importWatchCmd.Parsed() {
+		given := 0
+		for _, arg := range []string{*importWatchAddress, *importWatchPubKey, *importWatchXpub} {
+			if arg != "" {
+				given++
+			}
+		}
+		if given != 1 {
+			importWatchCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.importWatch(nodeID, *importWatchAddress, *importWatchPubKey, *importWatchXpub)
+	}
+
+	if dumpPrivKeyCmd.Parsed() {
+		if *dumpPrivKeyAddress == "" {
+			dumpPrivKeyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.dumpPrivKey(nodeID, *dumpPrivKeyAddress)
+	}
+
+	if importPrivKeyCmd.Parsed() {
+		if *importPrivKeyKey == "" {
+			importPrivKeyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.importPrivKey(nodeID, *importPrivKeyKey, *importPrivKeyRescan)
+	}
+
+	if importPubKeyCmd.Parsed() {
+		if *importPubKeyPubKey == "" {
+			importPubKeyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.importPubKey(nodeID, *importPubKeyPubKey, *importPubKeyRescan)
+	}
+
+	if signMessageCmd.Parsed() {
+		if *signMessageAddress == "" {
+			signMessageCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.signMessage(nodeID, *signMessageAddress, *signMessageMessage)
+	}
+
+	if verifyMessageCmd.Parsed() {
+		if *verifyMessageAddress == "" || *verifyMessageSignature == "" {
+			verifyMessageCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.verifyMessage(*verifyMessageAddress, *verifyMessageSignature, *verifyMessageMessage)
+	}
+
+	if getXpubCmd.Parsed() {
+		cli.getXpub(nodeID)
+	}
+
+	if createPSBTCmd.Parsed() {
+		spend := *createPSBTFrom != "" && *createPSBTTo != "" && *createPSBTAmount > 0
+		if *createPSBTOut == "" || spend == (*createPSBTTx != "") {
+			createPSBTCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.createPSBT(nodeID, *createPSBTFrom, *createPSBTTo, *createPSBTAmount, *createPSBTTx, *createPSBTOut)
+	}
+
+	if signPSBTCmd.Parsed() {
+		if *signPSBTIn == "" || *signPSBTAddress == "" {
+			signPSBTCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.signPSBT(nodeID, *signPSBTIn, *signPSBTAddress, *signPSBTSigHash)
+	}
+
+	if combinePSBTCmd.Parsed() {
+		if *combinePSBTIn == "" || *combinePSBTOut == "" {
+			combinePSBTCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.combinePSBT(*combinePSBTIn, *combinePSBTOut)
+	}
+
+	if finalizePSBTCmd.Parsed() {
+		if *finalizePSBTIn == "" || *finalizePSBTOut == "" {
+			finalizePSBTCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.finalizePSBT(nodeID, *finalizePSBTIn, *finalizePSBTOut, false)
+	}
+
+	if sendPSBTCmd.Parsed() {
+		if *sendPSBTIn == "" {
+			sendPSBTCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.finalizePSBT(nodeID, *sendPSBTIn, "", *sendPSBTMine)
+	}
+
+	if encryptWalletCmd.Parsed() {
+		cli.encryptWallet(nodeID)
+	}
+
+	if walletPassphraseCmd.Parsed() {
+		if *walletPassphraseTimeout <= 0 {
+			walletPassphraseCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.walletPassphrase(nodeID, *walletPassphraseTimeout)
+	}
+
+	if walletLockCmd.Parsed() {
+		cli.walletLock(nodeID)
+	}
+
+	if addrIndexCmd.Parsed() {
+		if *addrIndexEnable == *addrIndexDisable {
+			addrIndexCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.setIndex(nodeID, blockchain.AddrIndexName, *addrIndexEnable)
+	}
+
+	if historyCmd.Parsed() {
+		if *historyAddress == "" || *historySkip < 0 || *historyCount < 0 {
+			historyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.history(nodeID, *historyAddress, *historySkip, *historyCount)
+	}
+
+	if getWalletBalanceCmd.Parsed() {
+		cli.getWalletBalance(nodeID)
+	}
+
+	if listUnspentCmd.Parsed() {
+		if *listUnspentMinConf < 0 || *listUnspentMaxConf < *listUnspentMinConf {
+			listUnspentCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.listUnspent(nodeID, *listUnspentMinConf, *listUnspentMaxConf)
+	}
+
+	if listTransactionsCmd.Parsed() {
+		if *listTransactionsSkip < 0 || *listTransactionsCount < 0 {
+			listTransactionsCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.listTransactions(nodeID, *listTransactionsSkip, *listTransactionsCount)
+	}
+
+	if getBlockCmd.Parsed() {
+		if *getBlockHeight < 0 || *getBlockCount < 1 {
+			getBlockCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getBlock(nodeID, *getBlockHeight, *getBlockCount)
+	}
+
+	if getBlockHashCmd.Parsed() {
+		if *getBlockHashHeight < 0 {
+			getBlockHashCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getBlockHash(nodeID, *getBlockHashHeight)
 	}
 
 	if startNodeCmd.Parsed(){
@@ -202,7 +842,15 @@ func (cli *CommandLine) Run() {
 			startNodeCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.StartNode(nodeID, *startNodeMiner)
+		if *startNodeSPV {
+			if *startNodeMiner != "" {
+				fmt.Println("A header only node cannot mine")
+				runtime.Goexit()
+			}
+			cli.startSPV(nodeID, *startNodeRescan, *startNodeBloom)
+		} else {
+			cli.StartNode(nodeID, *startNodeMiner)
+		}
 	}
 	if createBlockchainCmd.Parsed() {
 		if *createBlockchainAddress == "" {
@@ -220,27 +868,200 @@ func (cli *CommandLine) Run() {
 			sendCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.send( nodeID ,*sendFrom, *sendTo, *sendAmount, *sendMine)
+		cli.send(*sendFrom, *sendTo, nodeID, *sendAmount, *sendLockTime, *sendData, *sendMine, *sendUnsigned)
+	}
+
+	if sendManyCmd.Parsed() {
+		if *sendManyFrom == "" || *sendManyFile == "" {
+			sendManyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.sendMany(nodeID, *sendManyFrom, *sendManyFile, *sendManyMine)
 	}
 
 	if listAddressesCmd.Parsed() {
-		cli.listAddresses(nodeID)
+		cli.listAddresses(nodeID, *listAddressesChange, *listAddressesLabel, *listAddressesVerbose)
+	}
+
+	if setLabelCmd.Parsed() {
+		if *setLabelAddress == "" {
+			setLabelCmd.Usage()
+			runtime.Goexit()
+		}
+		var note *string
+		setLabelCmd.Visit(func(f *flag.Flag) {
+			if f.Name == "note" {
+				note = setLabelNote
+			}
+		})
+		cli.setLabel(nodeID, *setLabelAddress, *setLabelLabel, note)
 	}
 	if createWalletCmd.Parsed() {
-		cli.createWallet(nodeID)
+		if *createWalletMnemonic {
+			cli.createHDWallet(nodeID)
+		} else {
+			cli.createWallet(nodeID)
+		}
+	}
+
+	if restoreWalletCmd.Parsed() {
+		if *restoreWalletMnemonic == "" {
+			restoreWalletCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.restoreWallet(nodeID, *restoreWalletMnemonic)
+	}
+	if reindexUTXOCmd.Parsed() {
+		cli.reindexUTXO(nodeID)
+	}
+	if migrateDBCmd.Parsed() {
+		cli.migrateDB(nodeID)
+	}
+	if getPubKeyCmd.Parsed() {
+		if *getPubKeyAddress == "" {
+			getPubKeyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getPubKey(nodeID, *getPubKeyAddress)
+	}
+	if createMultisigCmd.Parsed() {
+		if *createMultisigRequired <= 0 || *createMultisigPubKeys == "" {
+			createMultisigCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.createMultisig(nodeID, *createMultisigRequired, *createMultisigPubKeys)
+	}
+	if spendMultisigCmd.Parsed() {
+		if *spendMultisigFrom == "" || *spendMultisigTo == "" || *spendMultisigAmount <= 0 || *spendMultisigOut == "" {
+			spendMultisigCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.spendMultisig(nodeID, *spendMultisigFrom, *spendMultisigTo, *spendMultisigAmount, *spendMultisigOut)
+	}
+	if signMultisigCmd.Parsed() {
+		if *signMultisigIn == "" || *signMultisigAddress == "" {
+			signMultisigCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.signMultisig(nodeID, *signMultisigIn, *signMultisigAddress, *signMultisigSigHash)
+	}
+	if sendMultisigCmd.Parsed() {
+		if *sendMultisigIn == "" {
+			sendMultisigCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.sendMultisig(nodeID, *sendMultisigIn, *sendMultisigMine)
+	}
+	if initiateSwapCmd.Parsed() {
+		if *initiateSwapFrom == "" || *initiateSwapTo == "" || *initiateSwapAmount <= 0 {
+			initiateSwapCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.initiateSwap(nodeID, *initiateSwapFrom, *initiateSwapTo, *initiateSwapAmount, *initiateSwapLockTime, *initiateSwapMine)
+	}
+	if participateSwapCmd.Parsed() {
+		if *participateSwapFrom == "" || *participateSwapTo == "" || *participateSwapAmount <= 0 || *participateSwapSecretHash == "" {
+			participateSwapCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.participateSwap(nodeID, *participateSwapFrom, *participateSwapTo, *participateSwapAmount, *participateSwapSecretHash, *participateSwapLockTime, *participateSwapMine)
+	}
+	if redeemSwapCmd.Parsed() {
+		if *redeemSwapContract == "" || *redeemSwapTxid == "" || *redeemSwapSecret == "" {
+			redeemSwapCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.redeemSwap(nodeID, *redeemSwapContract, *redeemSwapTxid, *redeemSwapSecret, *redeemSwapMine)
+	}
+	if refundSwapCmd.Parsed() {
+		if *refundSwapContract == "" || *refundSwapTxid == "" {
+			refundSwapCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.refundSwap(nodeID, *refundSwapContract, *refundSwapTxid, *refundSwapMine)
+	}
+	if auditSwapCmd.Parsed() {
+		if *auditSwapContract == "" || *auditSwapTxid == "" {
+			auditSwapCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.auditSwap(nodeID, *auditSwapContract, *auditSwapTxid)
+	}
+	if anchorCmd.Parsed() {
+		if *anchorFrom == "" || *anchorFile == "" {
+			anchorCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.anchor(nodeID, *anchorFrom, *anchorFile, *anchorMine)
+	}
+	if verifyAnchorCmd.Parsed() {
+		if *verifyAnchorFile == "" {
+			verifyAnchorCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.verifyAnchor(nodeID, *verifyAnchorFile)
+	}
+	if getTxProofCmd.Parsed() {
+		if *getTxProofID == "" {
+			getTxProofCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getTxProof(nodeID, *getTxProofID)
+	}
+	if verifyTxProofCmd.Parsed() {
+		if *verifyTxProofData == "" {
+			verifyTxProofCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.verifyTxProof(nodeID, *verifyTxProofData)
 	}
 }
-func (cli *CommandLine) listAddresses(nodeId string) {
+// listAddresses prints the addresses of the wallet file, oldest first, leaving out change
+// addresses unless withChange and, when label is not empty, those labelled otherwise
+func (cli *CommandLine) listAddresses(nodeId string, withChange bool, label string, verbose bool) {
 	wallets, _ := wallet.CreateWallets(nodeId)
 	addresses := wallets.GetAllAddress()
+	sort.Slice(addresses, func(i, j int) bool {
+		ci, cj := wallets.AddressMeta(addresses[i]).Created, wallets.AddressMeta(addresses[j]).Created
+		if ci != cj {
+			return ci < cj
+		}
+		return addresses[i] < addresses[j]
+	})
 
 	for _, address := range addresses {
-		fmt.Println(address)
+		meta := wallets.AddressMeta(address)
+		if (meta.Purpose == wallet.PurposeChange && !withChange) || (label != "" && meta.Label != label) {
+			continue
+		}
+		line := address
+		if wallets.IsWatchOnly(address) {
+			line += " (watch-only)"
+		}
+		if meta.Purpose == wallet.PurposeChange {
+			line += " (change)"
+		}
+		if meta.Label != "" {
+			line += fmt.Sprintf(" %q", meta.Label)
+		}
+		if verbose {
+			created := "unknown"
+			if meta.Created > 0 {
+				created = time.Unix(meta.Created, 0).UTC().Format(time.RFC3339)
+			}
+			line += fmt.Sprintf(" purpose %s created %s", meta.Purpose, created)
+			if meta.Note != "" {
+				line += fmt.Sprintf(" note %q", meta.Note)
+			}
+		}
+		fmt.Println(line)
 	}
-
 }
+
 func (cli *CommandLine) createWallet(nodeId string) {
 	wallets, _ := wallet.CreateWallets(nodeId)
+	// the new key is encrypted like the others
+	unlock(wallets)
 	address := wallets.AddWallet()
 	wallets.SaveFile(nodeId)
 	fmt.Printf("New address generated is :%s\n", address)
@@ -249,9 +1070,16 @@ func (cli *CommandLine) createWallet(nodeId string) {
 func (cli *CommandLine) reindexUTXO(nodeId string) {
 	chain := blockchain.ContinueBlockchain(nodeId)
 	defer chain.Database.Close()
-	UTXOSet := blockchain.UTXOset{chain}
+	UTXOSet := blockchain.UTXOset{Blockchain: chain}
 	UTXOSet.Reindex()
 
 	count := UTXOSet.CountTrxs()
 	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", count)
 }
+
+func (cli *CommandLine) migrateDB(nodeId string) {
+	chain := blockchain.ContinueBlockchain(nodeId)
+	defer chain.Database.Close()
+	count := chain.MigrateStorage()
+	fmt.Printf("Done! Wrote %d entries in the current format.\n", count)
+}
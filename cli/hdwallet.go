@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"fmt"
+
+	"main.go/blockchain"
+	"main.go/wallet"
+)
+
+// createHDWallet gives the wallet a seed of fresh entropy and prints its mnemonic,
+// which restores every key derived from it
+func (cli *CommandLine) createHDWallet(nodeId string) {
+	wallets, _ := wallet.CreateWallets(nodeId)
+	if wallets.HD != nil {
+		fmt.Println("Wallet already has a seed, createwallet derives its next address")
+		return
+	}
+	unlock(wallets)
+	mnemonic := wallet.NewMnemonic()
+	seed, err := wallet.MnemonicSeed(mnemonic, "")
+	blockchain.HandleErr(err)
+	blockchain.HandleErr(wallets.SetSeed(seed))
+	address := wallets.AddWallet()
+	wallets.SaveFile(nodeId)
+	fmt.Println("Write down the mnemonic, it restores every key of this wallet:")
+	fmt.Println(mnemonic)
+	fmt.Printf("New address generated is :%s\n", address)
+}
+
+// restoreWallet gives the wallet the seed of mnemonic and adds the keys the chain
+// shows were used, see wallet.DiscoverHD
+func (cli *CommandLine) restoreWallet(nodeId, mnemonic string) {
+	seed, err := wallet.MnemonicSeed(mnemonic, "")
+	blockchain.HandleErr(err)
+	wallets, _ := wallet.CreateWallets(nodeId)
+	unlock(wallets)
+	blockchain.HandleErr(wallets.SetSeed(seed))
+
+	used := map[string]bool{}
+	if blockchain.ChainExists(nodeId) {
+		chain := blockchain.ContinueBlockchain(nodeId)
+		used = chain.UsedPubKeyHashes()
+		chain.Database.Close()
+	} else {
+		fmt.Println("No blockchain found, restoring the first address only")
+	}
+	found, err := wallets.DiscoverHD(func(pubKeyHash []byte) bool {
+		return used[string(pubKeyHash)]
+	})
+	blockchain.HandleErr(err)
+	if wallets.HD.Next[wallet.ReceiveBranch] == 0 {
+		_, err := wallets.NextHDAddress(wallet.ReceiveBranch)
+		blockchain.HandleErr(err)
+	}
+	wallets.SaveFile(nodeId)
+	fmt.Printf("Wallet restored, %d used keys found\n", found)
+	fmt.Printf("Next receive index %d, next change index %d\n",
+		wallets.HD.Next[wallet.ReceiveBranch], wallets.HD.Next[wallet.ChangeBranch])
+}
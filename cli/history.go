@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"fmt"
+
+	"main.go/blockchain"
+	"main.go/wallet"
+)
+
+// history lists the outputs received and spent by address from the address index,
+// oldest first, with the balance after each entry
+func (cli *CommandLine) history(nodeId, address string, skip, count int) {
+	if !wallet.ValidateAddress(address) {
+		panic("Invalid wallet address")
+	}
+	chain := blockchain.ContinueBlockchain(nodeId)
+	defer chain.Database.Close()
+	if !chain.IndexInSync(blockchain.AddrIndexName) {
+		fmt.Println("Address index is not enabled, run addrindex -enable")
+		return
+	}
+	entries, total, err := chain.AddressHistory(wallet.AddressHash(address), skip, count)
+	blockchain.HandleErr(err)
+	best := chain.GetBestHeight()
+	name := address
+	if wallets, err := wallet.CreateWallets(nodeId); err == nil && wallets.Label(address) != "" {
+		name = fmt.Sprintf("%s %q", address, wallets.Label(address))
+	}
+	fmt.Printf("History of %s: %d entries\n", name, total)
+	for _, entry := range entries {
+		direction, amount := "received", entry.Amount
+		if entry.Direction == blockchain.Spent {
+			direction, amount = "spent", -entry.Amount
+		}
+		fmt.Printf("%-8s %+d balance %d height %d confirmations %d tx %x:%d\n",
+			direction, amount, entry.Balance, entry.Height, best-entry.Height+1, entry.TxID, entry.Index)
+	}
+}
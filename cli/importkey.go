@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"main.go/blockchain"
+	"main.go/wallet"
+)
+
+func (cli *CommandLine) dumpPrivKey(nodeId, address string) {
+	wallets, err := wallet.CreateWallets(nodeId)
+	blockchain.HandleErr(err)
+	w := spendingWallet(nodeId, wallets, address)
+	encoded, err := wallet.EncodePrivKey(&w)
+	blockchain.HandleErr(err)
+	fmt.Println(encoded)
+}
+
+func (cli *CommandLine) importPrivKey(nodeId, encoded string, rescan bool) {
+	w, err := wallet.DecodePrivKey(encoded)
+	blockchain.HandleErr(err)
+	wallets, _ := wallet.CreateWallets(nodeId)
+	// the imported key is encrypted like the others
+	unlock(wallets)
+	address, err := wallets.ImportWallet(w)
+	blockchain.HandleErr(err)
+	wallets.SaveFile(nodeId)
+	fmt.Printf("Imported %s\n", address)
+	if rescan {
+		cli.rescan(nodeId, address)
+	}
+}
+
+func (cli *CommandLine) importPubKey(nodeId, pubKeyHex string, rescan bool) {
+	pubKey, err := hex.DecodeString(pubKeyHex)
+	blockchain.HandleErr(err)
+	wallets, _ := wallet.CreateWallets(nodeId)
+	address, err := wallets.AddWatchPubKey(pubKey)
+	blockchain.HandleErr(err)
+	wallets.SaveFile(nodeId)
+	fmt.Printf("Watching %s\n", address)
+	if rescan {
+		cli.rescan(nodeId, address)
+	}
+}
+
+// rescan rebuilds the UTXO set from the chain, so coins of an imported address show up
+// even when the set was built from an incomplete chain, and prints the address's balance
+func (cli *CommandLine) rescan(nodeId, address string) {
+	if !blockchain.ChainExists(nodeId) {
+		fmt.Println("No blockchain found, nothing to rescan")
+		return
+	}
+	chain := blockchain.ContinueBlockchain(nodeId)
+	UTXOSet := blockchain.UTXOset{Blockchain: chain}
+	UTXOSet.Reindex()
+	chain.Database.Close()
+	cli.getBalance(nodeId, address)
+}
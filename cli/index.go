@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"main.go/blockchain"
+)
+
+// setIndex builds and keeps, or deletes, the optional index called name
+func (cli *CommandLine) setIndex(nodeId, name string, enable bool) {
+	chain := blockchain.ContinueBlockchain(nodeId)
+	defer chain.Database.Close()
+	if enable {
+		blockchain.HandleErr(chain.EnableIndex(name))
+		fmt.Printf("Index %s built and enabled\n", name)
+		return
+	}
+	blockchain.HandleErr(chain.DisableIndex(name))
+	fmt.Printf("Index %s deleted\n", name)
+}
+
+// getTransaction prints a mined transaction and where it is, using the transaction index
+// when it is enabled and scanning the chain otherwise
+func (cli *CommandLine) getTransaction(nodeId, txidHex string) {
+	txid, err := hex.DecodeString(txidHex)
+	blockchain.HandleErr(err)
+
+	chain := blockchain.ContinueBlockchain(nodeId)
+	defer chain.Database.Close()
+	if !chain.IndexInSync(blockchain.TxIndexName) {
+		fmt.Println("Transaction index is not enabled, scanning the chain")
+	}
+	tx, block, err := chain.FindTrxBlock(txid)
+	if err != nil {
+		fmt.Println("Transaction not found in the best chain")
+		return
+	}
+	pos := 0
+	for i, blockTx := range block.Transactions {
+		if string(blockTx.ID) == string(tx.ID) {
+			pos = i
+		}
+	}
+	fmt.Println(tx.StringRep())
+	fmt.Printf("Block:         %x\n", block.Hash)
+	fmt.Printf("Height:        %d\n", block.Height)
+	fmt.Printf("Position:      %d\n", pos)
+	fmt.Printf("Confirmations: %d\n", chain.GetBestHeight()-block.Height+1)
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"fmt"
+
+	"main.go/blockchain"
+	"main.go/wallet"
+)
+
+// setLabel labels an address of the wallet file and, unless note is nil, keeps a note on it
+func (cli *CommandLine) setLabel(nodeId, address, label string, note *string) {
+	wallets, err := wallet.CreateWallets(nodeId)
+	blockchain.HandleErr(err)
+	blockchain.HandleErr(wallets.SetLabel(address, label))
+	if note != nil {
+		blockchain.HandleErr(wallets.SetNote(address, *note))
+	}
+	wallets.SaveFile(nodeId)
+	if label == "" {
+		fmt.Printf("Label of %s removed\n", address)
+		return
+	}
+	fmt.Printf("%s labelled %q\n", address, label)
+}
@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"main.go/blockchain"
+	"main.go/wallet"
+)
+
+// signMessage prints a base64 signature of message by the key of address
+func (cli *CommandLine) signMessage(nodeId, address, message string) {
+	if !wallet.ValidateAddress(address) || wallet.IsScriptAddress(address) {
+		panic("Invalid wallet address")
+	}
+	wallets, err := wallet.CreateWallets(nodeId)
+	blockchain.HandleErr(err)
+	w := spendingWallet(nodeId, wallets, address)
+	sig, err := wallet.SignMessage(&w, message)
+	blockchain.HandleErr(err)
+	fmt.Println(base64.StdEncoding.EncodeToString(sig))
+}
+
+// verifyMessage checks a signature printed by signmessage against address, without a wallet
+func (cli *CommandLine) verifyMessage(address, signature, message string) {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	blockchain.HandleErr(err)
+	valid, err := wallet.VerifyMessage(address, sig, message)
+	blockchain.HandleErr(err)
+	if !valid {
+		fmt.Printf("Signature is not from %s\n", address)
+		return
+	}
+	fmt.Printf("Signature is valid, the message was signed by %s\n", address)
+}
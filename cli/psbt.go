@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"main.go/blockchain"
+	"main.go/wallet"
+)
+
+func writePartialTxFile(path string, p *blockchain.PartialTx) {
+	data := hex.EncodeToString(p.Serialize())
+	err := os.WriteFile(path, []byte(data), 0644)
+	blockchain.HandleErr(err)
+}
+
+func readPartialTxFile(path string) *blockchain.PartialTx {
+	data, err := os.ReadFile(path)
+	blockchain.HandleErr(err)
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	blockchain.HandleErr(err)
+	p, err := blockchain.ParsePartialTx(raw)
+	blockchain.HandleErr(err)
+	return p
+}
+
+func printSignatures(p *blockchain.PartialTx) {
+	for inId := range p.Inputs {
+		have, need := p.Signatures(inId)
+		fmt.Printf("Input %d: %d of %d signatures\n", inId, have, need)
+	}
+}
+
+// createPSBT builds a spend from an address of the wallet, watch-only or not, or wraps
+// the unsigned transaction in txFile, with the outputs it spends for offline signers
+func (cli *CommandLine) createPSBT(nodeId, from, to string, amount int, txFile, outFile string) {
+	chain := blockchain.ContinueBlockchain(nodeId)
+	defer chain.Database.Close()
+	var tx *blockchain.Transaction
+	if txFile != "" {
+		unsigned := readTxFile(txFile)
+		tx = &unsigned
+	} else {
+		if !wallet.ValidateAddress(from) || !wallet.ValidateAddress(to) {
+			panic("Invalid wallet address")
+		}
+		wallets, err := wallet.CreateWallets(nodeId)
+		blockchain.HandleErr(err)
+		UTXOSet := blockchain.UTXOset{Blockchain: chain}
+		outputs := []blockchain.TxOutputs{*blockchain.NewTxOutput(amount, to)}
+		tx = unsignedSpend(nodeId, wallets, from, outputs, 0, &UTXOSet)
+	}
+	p, err := chain.NewPartialTx(tx)
+	blockchain.HandleErr(err)
+	writePartialTxFile(outFile, p)
+	fmt.Printf("Partially signed transaction %x written to %s\n", p.Tx.ID, outFile)
+	printSignatures(p)
+}
+
+// signPSBT signs with the key of address. It needs no chain, so it runs on offline machines
+func (cli *CommandLine) signPSBT(nodeId, inFile, address, sigHash string) {
+	hashType, err := blockchain.ParseSigHashType(sigHash)
+	blockchain.HandleErr(err)
+	wallets, err := wallet.CreateWallets(nodeId)
+	blockchain.HandleErr(err)
+	signer := spendingWallet(nodeId, wallets, address)
+
+	p := readPartialTxFile(inFile)
+	signed, err := p.Sign(signer.PrivKey, hashType)
+	blockchain.HandleErr(err)
+	writePartialTxFile(inFile, p)
+	fmt.Printf("Signed %d inputs\n", signed)
+	printSignatures(p)
+}
+
+func (cli *CommandLine) combinePSBT(inFiles, outFile string) {
+	var combined *blockchain.PartialTx
+	for _, path := range strings.Split(inFiles, ",") {
+		p := readPartialTxFile(strings.TrimSpace(path))
+		if combined == nil {
+			combined = p
+			continue
+		}
+		blockchain.HandleErr(combined.Combine(p))
+	}
+	writePartialTxFile(outFile, combined)
+	fmt.Printf("Combined into %s\n", outFile)
+	printSignatures(combined)
+}
+
+// finalizePSBT writes the signed transaction to outFile, or broadcasts it when outFile is empty
+func (cli *CommandLine) finalizePSBT(nodeId, inFile, outFile string, mineNow bool) {
+	p := readPartialTxFile(inFile)
+	tx, err := p.Finalize()
+	blockchain.HandleErr(err)
+	if outFile != "" {
+		writeTxFile(outFile, tx)
+		fmt.Printf("Signed transaction %x written to %s\n", tx.ID, outFile)
+		return
+	}
+	cli.broadcast(nodeId, tx, mineNow)
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"main.go/blockchain"
+	"main.go/wallet"
+)
+
+// payment is one recipient of sendmany
+type payment struct {
+	address string
+	amount  int
+}
+
+// readPayments reads the recipients of sendmany in file order, from a JSON object of
+// address to amount or from CSV lines of address,amount with an optional header line
+func readPayments(path string) ([]payment, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var payments []payment
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		payments, err = readJSONPayments(trimmed)
+	} else {
+		payments, err = readCSVPayments(trimmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(payments) == 0 {
+		return nil, errors.New("no recipients")
+	}
+	seen := make(map[string]bool)
+	for _, p := range payments {
+		if !wallet.ValidateAddress(p.address) {
+			return nil, fmt.Errorf("invalid address %q", p.address)
+		}
+		if p.amount <= 0 {
+			return nil, fmt.Errorf("amount for %s is not positive", p.address)
+		}
+		if seen[p.address] {
+			return nil, fmt.Errorf("%s is paid twice", p.address)
+		}
+		seen[p.address] = true
+	}
+	return payments, nil
+}
+
+func readJSONPayments(content []byte) ([]payment, error) {
+	var payments []payment
+	dec := json.NewDecoder(bytes.NewReader(content))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var amount int
+		if err := dec.Decode(&amount); err != nil {
+			return nil, fmt.Errorf("amount for %v: %w", key, err)
+		}
+		payments = append(payments, payment{key.(string), amount})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("data after the JSON object")
+	}
+	return payments, nil
+}
+
+func readCSVPayments(content []byte) ([]payment, error) {
+	r := csv.NewReader(bytes.NewReader(content))
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var payments []payment
+	for i, record := range records {
+		address := strings.TrimSpace(record[0])
+		amount, err := strconv.Atoi(strings.TrimSpace(record[1]))
+		if err != nil {
+			if i == 0 {
+				// header line
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		payments = append(payments, payment{address, amount})
+	}
+	return payments, nil
+}
+
+// sendMany pays every recipient listed in path from one address in a single transaction,
+// with the change going to a fresh change address. Every recipient is checked before
+// the wallet is unlocked
+func (cli *CommandLine) sendMany(nodeId, from, path string, mineNow bool) {
+	if !wallet.ValidateAddress(from) {
+		panic("Invalid wallet address")
+	}
+	payments, err := readPayments(path)
+	blockchain.HandleErr(err)
+
+	total := 0
+	var outputs []blockchain.TxOutputs
+	for _, p := range payments {
+		outputs = append(outputs, *blockchain.NewTxOutput(p.amount, p.address))
+		total += p.amount
+	}
+
+	chain := blockchain.ContinueBlockchain(nodeId)
+	UTXOSet := blockchain.UTXOset{Blockchain: chain}
+	wallets, err := wallet.CreateWallets(nodeId)
+	blockchain.HandleErr(err)
+	w := spendingWallet(nodeId, wallets, from)
+	change := changeAddress(wallets)
+	tx := blockchain.NewTransactionWithOutputs(&w, outputs, change, 0, &UTXOSet)
+	chain.Database.Close()
+	wallets.SaveFile(nodeId)
+
+	fmt.Printf("Paying %d recipients %d in tx %x\n", len(payments), total, tx.ID)
+	cli.broadcast(nodeId, tx, mineNow)
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"main.go/wallet"
+)
+
+// writePayments writes content to a recipients file and returns its path
+func writePayments(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "payments")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Recipients come back in file order, from JSON or CSV with or without a header
+func TestReadPayments(t *testing.T) {
+	a, b, c := string(wallet.MakeWallet().Address()), string(wallet.MakeWallet().Address()), string(wallet.MakeWallet().Address())
+	want := []payment{{c, 30}, {a, 10}, {b, 20}}
+	files := map[string]string{
+		"json":            fmt.Sprintf(`{"%s": 30, "%s": 10, "%s": 20}`, c, a, b),
+		"indented json":   fmt.Sprintf("\n  {\n  %q: 30,\n  %q: 10,\n  %q: 20\n}\n", c, a, b),
+		"csv":             fmt.Sprintf("%s,30\n%s,10\n%s,20\n", c, a, b),
+		"csv with header": fmt.Sprintf("address,amount\n%s, 30\n%s , 10\n%s,20", c, a, b),
+	}
+	for name, content := range files {
+		payments, err := readPayments(writePayments(t, content))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(payments) != len(want) {
+			t.Errorf("%s: %d recipients, want %d", name, len(payments), len(want))
+			continue
+		}
+		for i, p := range payments {
+			if p != want[i] {
+				t.Errorf("%s: recipient %d is %+v, want %+v", name, i, p, want[i])
+			}
+		}
+	}
+}
+
+// Every recipient is checked, so a bad line anywhere in the file rejects all of it
+func TestReadPaymentsRejects(t *testing.T) {
+	a, b := string(wallet.MakeWallet().Address()), string(wallet.MakeWallet().Address())
+	badChecksum := b[:len(b)-1] + "2"
+	if b[len(b)-1] == '2' {
+		badChecksum = b[:len(b)-1] + "3"
+	}
+	files := map[string]string{
+		"empty":              "",
+		"empty json":         "{}",
+		"invalid address":    fmt.Sprintf("%s,10\n%sx,20\n", a, b),
+		"bad checksum":       fmt.Sprintf(`{"%s": 10, "%s": 20}`, a, badChecksum),
+		"zero amount":        fmt.Sprintf("%s,10\n%s,0\n", a, b),
+		"negative amount":    fmt.Sprintf(`{"%s": 10, "%s": -5}`, a, b),
+		"paid twice":         fmt.Sprintf("%s,10\n%s,20\n%s,5\n", a, b, a),
+		"paid twice in json": fmt.Sprintf(`{"%s": 10, "%s": 20}`, a, a),
+		"fractional amount":  fmt.Sprintf(`{"%s": 1.5}`, a),
+		"string amount":      fmt.Sprintf(`{"%s": "10"}`, a),
+		"json after object":  fmt.Sprintf(`{"%s": 10} {}`, a),
+		"truncated json":     fmt.Sprintf(`{"%s": 10`, a),
+		"csv amount":         fmt.Sprintf("%s,10\n%s,ten\n", a, b),
+		"csv columns":        fmt.Sprintf("%s,10,extra\n", a),
+		"header only":        "address,amount\n",
+	}
+	for name, content := range files {
+		if payments, err := readPayments(writePayments(t, content)); err == nil {
+			t.Errorf("%s: read %d recipients", name, len(payments))
+		}
+	}
+	if _, err := readPayments(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing file read")
+	}
+}
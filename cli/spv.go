@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"fmt"
+	"runtime"
+
+	"main.go/blockchain"
+	"main.go/network"
+	"main.go/wallet"
+)
+
+// startSPV runs a node that keeps only headers and merkle proofs of the wallet's transactions.
+// With rescan at 0 or more, blocks from that height on are matched against the wallet again.
+// With bloom the peer filters blocks and relayed transactions for the node
+func (cli *CommandLine) startSPV(nodeId string, rescan int, bloom bool) {
+	fmt.Println("Starting header only node, tracking the addresses in the wallet")
+	if rescan >= 0 {
+		fmt.Println("Rescanning from height", rescan)
+	}
+	network.StartSPV(nodeId, rescan, bloom)
+}
+
+// getSPVBalance prints the balance of address from the proofs an SPV node collected,
+// with the confirmations of each unspent output counted on its headers
+func (cli *CommandLine) getSPVBalance(nodeId, address string) {
+	if !wallet.ValidateAddress(address) {
+		panic("Invalid wallet address")
+	}
+	if !blockchain.HeaderChainExists(nodeId) {
+		fmt.Println("No headers found, run startnode -spv first")
+		runtime.Goexit()
+	}
+	hc := blockchain.OpenHeaderChain(nodeId)
+	defer hc.Database.Close()
+
+	balance := 0
+	for _, out := range hc.UnspentOutputs(wallet.AddressHash(address)) {
+		balance += out.Output.Value
+		fmt.Printf("  %x:%d %d at height %d, %d confirmations\n", out.TxID, out.Vout, out.Output.Value, out.Height, hc.Confirmations(out.BlockHash))
+	}
+	fmt.Printf("Best header height: %d\n", hc.BestHeight())
+	fmt.Printf("Confirmed balance of %s: %d\n", address, balance)
+}
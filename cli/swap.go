@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"main.go/blockchain"
+	"main.go/wallet"
+)
+
+// Default refund lock times, in blocks after the current tip. The participant's contract
+// must expire first so the initiator cannot redeem it and still refund their own
+const (
+	initiatorLockBlocks   = 48
+	participantLockBlocks = 24
+)
+
+// initiateSwap starts an atomic swap: it picks a secret and locks amount to participant behind its hash
+func (cli *CommandLine) initiateSwap(nodeId, from, participant string, amount int, lockTime int64, mineNow bool) {
+	secret := make([]byte, blockchain.SecretSize)
+	_, err := rand.Read(secret)
+	blockchain.HandleErr(err)
+	secretHash := sha256.Sum256(secret)
+
+	fmt.Printf("Secret:      %x\n", secret)
+	fmt.Printf("Secret hash: %x\n", secretHash)
+	fmt.Println("Keep the secret private until you redeem the participant's contract")
+	cli.fundContract(nodeId, from, participant, amount, secretHash[:], lockTime, initiatorLockBlocks, mineNow)
+}
+
+// participateSwap answers an initiated swap with a contract locked to the initiator's secret hash
+func (cli *CommandLine) participateSwap(nodeId, from, initiator string, amount int, secretHashHex string, lockTime int64, mineNow bool) {
+	secretHash, err := hex.DecodeString(secretHashHex)
+	blockchain.HandleErr(err)
+	cli.fundContract(nodeId, from, initiator, amount, secretHash, lockTime, participantLockBlocks, mineNow)
+}
+
+func (cli *CommandLine) fundContract(nodeId, from, to string, amount int, secretHash []byte, lockTime int64, defaultLock int, mineNow bool) {
+	if !wallet.ValidateAddress(from) || !wallet.ValidateAddress(to) {
+		panic("Invalid wallet address")
+	}
+	chain := blockchain.ContinueBlockchain(nodeId)
+	UTXOSet := blockchain.UTXOset{Blockchain: chain}
+	if lockTime == 0 {
+		lockTime = int64(chain.GetBestHeight() + defaultLock)
+	}
+
+	script, err := blockchain.NewHTLCScript(secretHash, wallet.AddressHash(to), wallet.AddressHash(from), lockTime)
+	blockchain.HandleErr(err)
+	redeem := script.Serialize()
+	contractAddress := string(wallet.ScriptAddress(wallet.PubKeyHash(redeem)))
+
+	wallets, err := wallet.CreateWallets(nodeId)
+	blockchain.HandleErr(err)
+	w := spendingWallet(nodeId, wallets, from)
+	wallets.AddScript(contractAddress, redeem)
+	change := changeAddress(wallets)
+
+	tx := blockchain.NewTransaction(&w, contractAddress, change, amount, 0, &UTXOSet)
+	chain.Database.Close()
+	wallets.SaveFile(nodeId)
+
+	fmt.Printf("Contract address: %s\n", contractAddress)
+	fmt.Printf("Contract:         %x\n", redeem)
+	fmt.Printf("Contract tx:      %x\n", tx.ID)
+	fmt.Printf("Refundable after: %d\n", lockTime)
+	cli.broadcast(nodeId, tx, mineNow)
+}
+
+// redeemSwap claims a contract locked to one of our addresses by revealing the secret
+func (cli *CommandLine) redeemSwap(nodeId, contractHex, txidHex, secretHex string, mineNow bool) {
+	secret, err := hex.DecodeString(secretHex)
+	blockchain.HandleErr(err)
+	cli.spendContract(nodeId, contractHex, txidHex, secret, mineNow)
+}
+
+// refundSwap takes back the funds of an expired contract we created
+func (cli *CommandLine) refundSwap(nodeId, contractHex, txidHex string, mineNow bool) {
+	cli.spendContract(nodeId, contractHex, txidHex, nil, mineNow)
+}
+
+func (cli *CommandLine) spendContract(nodeId, contractHex, txidHex string, secret []byte, mineNow bool) {
+	redeem, script, contractTx, vout := cli.loadContract(nodeId, contractHex, txidHex)
+
+	to := string(wallet.PubKeyHashAddress(script.Refund))
+	if len(secret) > 0 {
+		to = string(wallet.PubKeyHashAddress(script.Recipient))
+	}
+	wallets, err := wallet.CreateWallets(nodeId)
+	blockchain.HandleErr(err)
+	w := spendingWallet(nodeId, wallets, to)
+
+	tx, err := blockchain.NewHTLCSpend(redeem, &contractTx, vout, to, secret)
+	blockchain.HandleErr(err)
+
+	chain := blockchain.ContinueBlockchain(nodeId)
+	chain.SignTrx(tx, w.PrivKey)
+	chain.Database.Close()
+
+	fmt.Printf("Spending %x:%d to %s\n", contractTx.ID, vout, to)
+	cli.broadcast(nodeId, tx, mineNow)
+}
+
+// auditSwap prints the terms of a contract and whether it has been redeemed or refunded.
+// A redeemed contract reveals the secret the counterparty needs for the other chain
+func (cli *CommandLine) auditSwap(nodeId, contractHex, txidHex string) {
+	_, script, contractTx, vout := cli.loadContract(nodeId, contractHex, txidHex)
+
+	fmt.Printf("Contract output: %x:%d\n", contractTx.ID, vout)
+	fmt.Printf("Amount:          %d\n", contractTx.Vout[vout].Value)
+	fmt.Printf("Recipient:       %s\n", wallet.PubKeyHashAddress(script.Recipient))
+	fmt.Printf("Refund to:       %s\n", wallet.PubKeyHashAddress(script.Refund))
+	fmt.Printf("Secret hash:     %x\n", script.SecretHash)
+	fmt.Printf("Lock time:       %d\n", script.LockTime)
+
+	chain := blockchain.ContinueBlockchain(nodeId)
+	defer chain.Database.Close()
+	fmt.Printf("Current height:  %d\n", chain.GetBestHeight())
+
+	spend, found := chain.FindSpendingTrx(contractTx.ID, vout)
+	if !found {
+		fmt.Println("Status:          unspent")
+		return
+	}
+	for _, in := range spend.Vin {
+		if bytes.Equal(in.TXID, contractTx.ID) && in.Vout == vout && len(in.Preimage) > 0 {
+			fmt.Printf("Status:          redeemed in %x\n", spend.ID)
+			fmt.Printf("Secret:          %x\n", in.Preimage)
+			return
+		}
+	}
+	fmt.Printf("Status:          refunded in %x\n", spend.ID)
+}
+
+func (cli *CommandLine) loadContract(nodeId, contractHex, txidHex string) ([]byte, *blockchain.RedeemScript, blockchain.Transaction, int) {
+	redeem, err := hex.DecodeString(contractHex)
+	blockchain.HandleErr(err)
+	script, err := blockchain.DeserializeScript(redeem)
+	blockchain.HandleErr(err)
+	if script.Type != blockchain.ScriptHTLC {
+		panic("Not an HTLC contract")
+	}
+	txid, err := hex.DecodeString(txidHex)
+	blockchain.HandleErr(err)
+
+	chain := blockchain.ContinueBlockchain(nodeId)
+	defer chain.Database.Close()
+	contractTx, err := chain.FindTrxById(txid)
+	blockchain.HandleErr(err)
+	vout := contractTx.FindScriptOutput(redeem)
+	if vout < 0 {
+		panic("The transaction does not pay to this contract")
+	}
+	return redeem, script, contractTx, vout
+}
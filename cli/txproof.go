@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"main.go/blockchain"
+)
+
+// getTxProof prints a merkle block proving the transaction was mined, for a client without the block
+func (cli *CommandLine) getTxProof(nodeId, txidHex string) {
+	txid, err := hex.DecodeString(txidHex)
+	blockchain.HandleErr(err)
+
+	chain := blockchain.ContinueBlockchain(nodeId)
+	defer chain.Database.Close()
+	mb, err := chain.GetTxProof(txid)
+	blockchain.HandleErr(err)
+
+	fmt.Printf("Block:  %x\n", mb.Header.Hash())
+	fmt.Printf("Height: %d\n", mb.Height)
+	fmt.Printf("Proof:  %x\n", mb.Serialize())
+}
+
+// verifyTxProof checks a proof printed by gettxproof. The proof stands on its own;
+// when this node knows the block its confirmations are printed too
+func (cli *CommandLine) verifyTxProof(nodeId, proofHex string) {
+	data, err := hex.DecodeString(proofHex)
+	blockchain.HandleErr(err)
+	mb, err := blockchain.DeserializeMerkleBlock(data)
+	blockchain.HandleErr(err)
+	if err := mb.Verify(); err != nil {
+		fmt.Println("Invalid proof:", err)
+		return
+	}
+	blockHash := mb.Header.Hash()
+	for _, tx := range mb.Txs {
+		fmt.Printf("Transaction %x\n", tx.ID)
+		for idx, out := range tx.Vout {
+			if out.IsData() {
+				fmt.Printf("  Output %d: data %x\n", idx, out.Data)
+				continue
+			}
+			fmt.Printf("  Output %d: %d to %s\n", idx, out.Value, out.Address())
+		}
+	}
+	fmt.Printf("Block:         %x\n", blockHash)
+	fmt.Printf("Height:        %d\n", mb.Height)
+	fmt.Println("Proof valid:   true")
+
+	if !blockchain.ChainExists(nodeId) {
+		return
+	}
+	chain := blockchain.ContinueBlockchain(nodeId)
+	defer chain.Database.Close()
+	if _, height, err := chain.GetHeader(blockHash); err == nil && chain.IsInBestChain(blockHash) {
+		fmt.Printf("Confirmations: %d\n", chain.GetBestHeight()-height+1)
+	} else {
+		fmt.Println("Confirmations: block is not in this node's best chain")
+	}
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"main.go/blockchain"
+	"main.go/wallet"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// readPassphrase prompts for a passphrase and reads one line of standard input
+func readPassphrase(prompt string) string {
+	fmt.Print(prompt)
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		panic("No passphrase given")
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+// unlock asks for the passphrase of a locked wallet file
+func unlock(wallets *wallet.WalletsFile) {
+	if !wallets.IsLocked() {
+		return
+	}
+	blockchain.HandleErr(wallets.Unlock(readPassphrase("Wallet passphrase: ")))
+}
+
+// spendingWallet returns the wallet of address with its private key, asking for the
+// passphrase when the wallet file is locked. An HD wallet file derives and saves the key
+// when address is one of its next keys, as used by a node watching the account
+func spendingWallet(nodeId string, wallets *wallet.WalletsFile, address string) wallet.Wallet {
+	if wallets.IsWatchOnly(address) {
+		panic(fmt.Sprintf("%s: %s. Use send -unsigned FILE to sign elsewhere", address, wallet.ErrWatchOnly))
+	}
+	if _, ok := wallets.Wallets[address]; !ok {
+		if wallets.HD == nil {
+			panic(fmt.Sprintf("The key for %s is not in this wallet", address))
+		}
+		unlock(wallets)
+		found, err := wallets.LookAheadHD(address)
+		blockchain.HandleErr(err)
+		if !found {
+			panic(fmt.Sprintf("The key for %s is not in this wallet", address))
+		}
+		wallets.SaveFile(nodeId)
+	}
+	unlock(wallets)
+	return wallets.GetWallet(address)
+}
+
+// changeAddress adds a fresh key to the unlocked wallet file to take the change of a
+// spend. The caller saves the file once the spend is built
+func changeAddress(wallets *wallet.WalletsFile) string {
+	address, err := wallets.NewChangeAddress()
+	blockchain.HandleErr(err)
+	return address
+}
+
+func (cli *CommandLine) encryptWallet(nodeId string) {
+	wallets, err := wallet.CreateWallets(nodeId)
+	blockchain.HandleErr(err)
+	if wallets.IsEncrypted() {
+		fmt.Println("Wallet is already encrypted")
+		return
+	}
+	passphrase := readPassphrase("New wallet passphrase: ")
+	if passphrase == "" {
+		panic("Empty passphrase")
+	}
+	if readPassphrase("Repeat the passphrase: ") != passphrase {
+		panic("Passphrases do not match")
+	}
+	blockchain.HandleErr(wallets.Encrypt(passphrase))
+	wallets.SaveFile(nodeId)
+	blockchain.HandleErr(wallet.RemoveUnlock(nodeId))
+	fmt.Println("Wallet encrypted, unlock it with walletpassphrase to spend")
+}
+
+func (cli *CommandLine) walletPassphrase(nodeId string, timeout int) {
+	wallets, err := wallet.CreateWallets(nodeId)
+	blockchain.HandleErr(err)
+	if !wallets.IsEncrypted() {
+		fmt.Println("Wallet is not encrypted")
+		return
+	}
+	blockchain.HandleErr(wallets.Unlock(readPassphrase("Wallet passphrase: ")))
+	blockchain.HandleErr(wallets.SaveUnlock(nodeId, time.Duration(timeout)*time.Second))
+	fmt.Printf("Wallet unlocked for %d seconds\n", timeout)
+}
+
+func (cli *CommandLine) walletLock(nodeId string) {
+	blockchain.HandleErr(wallet.RemoveUnlock(nodeId))
+	fmt.Println("Wallet locked")
+}
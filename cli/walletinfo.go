@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"fmt"
+
+	"main.go/blockchain"
+	"main.go/wallet"
+)
+
+// walletChain opens the chain with its wallet index following every address of the
+// wallet file, rebuilt when addresses were added since the last call. It also returns
+// the addresses by PubKeyHash
+func walletChain(nodeId string) (*blockchain.BlockChain, map[string]string) {
+	wallets, err := wallet.CreateWallets(nodeId)
+	blockchain.HandleErr(err)
+	addresses := make(map[string]string)
+	var hashes [][]byte
+	for _, address := range wallets.GetAllAddress() {
+		hash := wallet.AddressHash(address)
+		addresses[string(hash)] = address
+		hashes = append(hashes, hash)
+	}
+	chain := blockchain.ContinueBlockchain(nodeId)
+	blockchain.HandleErr(chain.SetWalletKeys(hashes))
+	return chain, addresses
+}
+
+func (cli *CommandLine) getWalletBalance(nodeId string) {
+	chain, _ := walletChain(nodeId)
+	defer chain.Database.Close()
+	balance, err := chain.GetWalletBalance()
+	blockchain.HandleErr(err)
+	fmt.Printf("Confirmed:   %d\n", balance.Confirmed)
+	fmt.Printf("Unconfirmed: %d\n", balance.Unconfirmed)
+	fmt.Printf("Immature:    %d\n", balance.Immature)
+}
+
+// listUnspent prints the wallet's unspent outputs with between minConf and maxConf
+// confirmations, pending ones having 0
+func (cli *CommandLine) listUnspent(nodeId string, minConf, maxConf int) {
+	chain, addresses := walletChain(nodeId)
+	defer chain.Database.Close()
+	unspent, err := chain.WalletUnspent()
+	blockchain.HandleErr(err)
+	total := 0
+	for _, out := range unspent {
+		if out.Confirmations < minConf || out.Confirmations > maxConf {
+			continue
+		}
+		total += out.Value
+		kind := ""
+		if out.Coinbase {
+			kind = " coinbase"
+			if out.Confirmations < blockchain.CoinbaseMaturity {
+				kind = " coinbase immature"
+			}
+		}
+		fmt.Printf("%x:%d %d %s confirmations %d%s\n",
+			out.TxID, out.Index, out.Value, addresses[string(out.PubKeyHash)], out.Confirmations, kind)
+	}
+	fmt.Printf("Total: %d\n", total)
+}
+
+// listTransactions prints count wallet transactions after the skip most recent, most recent first
+func (cli *CommandLine) listTransactions(nodeId string, skip, count int) {
+	chain, _ := walletChain(nodeId)
+	defer chain.Database.Close()
+	txs, total, err := chain.WalletTransactions(skip, count)
+	blockchain.HandleErr(err)
+	fmt.Printf("Wallet transactions: %d\n", total)
+	for _, tx := range txs {
+		category := "receive"
+		if tx.Coinbase {
+			category = "generate"
+		} else if tx.Sent > 0 {
+			category = "send"
+		}
+		height := fmt.Sprint(tx.Height)
+		if tx.Pending {
+			height = "pending"
+		}
+		fmt.Printf("%-8s %+d received %d sent %d height %s confirmations %d tx %x\n",
+			category, tx.Received-tx.Sent, tx.Received, tx.Sent, height, tx.Confirmations, tx.TxID)
+	}
+}
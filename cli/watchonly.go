@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"main.go/blockchain"
+	"main.go/wallet"
+)
+
+// importWatch watches an address, the address of a public key or the addresses of an
+// account's extended public key, found in the chain up to the gap limit
+func (cli *CommandLine) importWatch(nodeId, address, pubKeyHex, xpub string) {
+	wallets, _ := wallet.CreateWallets(nodeId)
+	switch {
+	case address != "":
+		blockchain.HandleErr(wallets.AddWatchAddress(address))
+		fmt.Printf("Watching %s\n", address)
+	case pubKeyHex != "":
+		pubKey, err := hex.DecodeString(pubKeyHex)
+		blockchain.HandleErr(err)
+		address, err := wallets.AddWatchPubKey(pubKey)
+		blockchain.HandleErr(err)
+		fmt.Printf("Watching %s\n", address)
+	default:
+		used := map[string]bool{}
+		if blockchain.ChainExists(nodeId) {
+			chain := blockchain.ContinueBlockchain(nodeId)
+			used = chain.UsedPubKeyHashes()
+			chain.Database.Close()
+		}
+		added, err := wallets.AddWatchXpub(xpub, func(pubKeyHash []byte) bool {
+			return used[string(pubKeyHash)]
+		})
+		blockchain.HandleErr(err)
+		fmt.Printf("Watching %d addresses of the extended public key\n", added)
+	}
+	wallets.SaveFile(nodeId)
+}
+
+func (cli *CommandLine) getXpub(nodeId string) {
+	wallets, _ := wallet.CreateWallets(nodeId)
+	if wallets.HD == nil {
+		fmt.Println("Wallet has no seed, create one with createwallet -mnemonic")
+		return
+	}
+	fmt.Println(wallets.HD.AccountXpub)
+}
+
+// unsignedSpend builds a spend from an address of the wallet, watch-only or not, without
+// signing it. Inputs carry the public key when the wallet knows it. The change of an address
+// of a watched extended public key goes to its next change key, that of other addresses back to them
+func unsignedSpend(nodeId string, wallets *wallet.WalletsFile, from string, outputs []blockchain.TxOutputs, lockTime int64, UTXOSet *blockchain.UTXOset) *blockchain.Transaction {
+	pubKey := wallets.WatchPubKey(from)
+	if w, ok := wallets.Wallets[from]; ok {
+		pubKey = w.PubKey
+	} else if !wallets.IsWatchOnly(from) {
+		panic(fmt.Sprintf("%s is not in this wallet", from))
+	}
+	change := ""
+	if entry, ok := wallets.Watch[from]; ok && entry.Xpub != "" {
+		var err error
+		change, err = wallets.NextWatchedChange(entry.Xpub)
+		blockchain.HandleErr(err)
+	}
+	tx := blockchain.NewUnsignedTransaction(pubKey, wallet.AddressHash(from), outputs, change, lockTime, UTXOSet)
+	if change != "" {
+		wallets.SaveFile(nodeId)
+	}
+	return tx
+}
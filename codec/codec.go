@@ -0,0 +1,253 @@
+// Package codec reads and writes the canonical binary encoding used for every
+// consensus object and network message. See docs/serialization.md for the format.
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// Magic starts every top level encoding. A gob stream can never start with it,
+	// which is how data written before the canonical format is told apart
+	Magic = byte(0xaf)
+	// FormatVersion is written right after Magic. Readers accept every version from 1 up to it
+	FormatVersion = byte(0x02)
+
+	// MaxBytesLen bounds any length prefixed field so a bad length cannot allocate gigabytes
+	MaxBytesLen = 32 << 20
+)
+
+var (
+	ErrShortRead      = errors.New("codec: unexpected end of data")
+	ErrNonCanonical   = errors.New("codec: varint is not minimally encoded")
+	ErrTrailingData   = errors.New("codec: trailing data")
+	ErrNotCanonical   = errors.New("codec: missing magic byte")
+	ErrUnknownVersion = errors.New("codec: unknown format version")
+)
+
+// IsCanonical reports whether data starts like a canonical encoding rather than a gob stream
+func IsCanonical(data []byte) bool {
+	return len(data) > 0 && data[0] == Magic
+}
+
+type Writer struct {
+	buf bytes.Buffer
+}
+
+// NewWriter returns a writer with the magic byte and format version already written
+func NewWriter() *Writer {
+	return NewWriterVersion(FormatVersion)
+}
+
+// NewWriterVersion writes the header of an older format version, for hashes that must not
+// change when the format does
+func NewWriterVersion(version byte) *Writer {
+	w := &Writer{}
+	w.buf.WriteByte(Magic)
+	w.buf.WriteByte(version)
+	return w
+}
+
+// NewRawWriter returns a writer for an encoding nested inside another one, without a header
+func NewRawWriter() *Writer {
+	return &Writer{}
+}
+
+func (w *Writer) Data() []byte {
+	return w.buf.Bytes()
+}
+
+func (w *Writer) Byte(b byte) {
+	w.buf.WriteByte(b)
+}
+
+func (w *Writer) Bool(b bool) {
+	if b {
+		w.buf.WriteByte(1)
+	} else {
+		w.buf.WriteByte(0)
+	}
+}
+
+// Uvarint writes an unsigned LEB128 varint, as encoding/binary.PutUvarint
+func (w *Writer) Uvarint(num uint64) {
+	var raw [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(raw[:], num)
+	w.buf.Write(raw[:n])
+}
+
+// Varint writes a zig-zag encoded signed varint, as encoding/binary.PutVarint
+func (w *Writer) Varint(num int64) {
+	var raw [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(raw[:], num)
+	w.buf.Write(raw[:n])
+}
+
+// Bytes writes data prefixed with its length as a Uvarint
+func (w *Writer) Bytes(data []byte) {
+	w.Uvarint(uint64(len(data)))
+	w.buf.Write(data)
+}
+
+func (w *Writer) String(s string) {
+	w.Bytes([]byte(s))
+}
+
+// BytesList writes a Uvarint count followed by each item as Bytes
+func (w *Writer) BytesList(list [][]byte) {
+	w.Uvarint(uint64(len(list)))
+	for _, item := range list {
+		w.Bytes(item)
+	}
+}
+
+// Reader decodes what a Writer wrote. The first error sticks: every later read
+// returns a zero value and Err reports it, so callers can check once at the end
+type Reader struct {
+	data    []byte
+	pos     int
+	err     error
+	version byte
+}
+
+// NewReader checks the magic byte and format version and returns a reader positioned after them
+func NewReader(data []byte) (*Reader, error) {
+	if !IsCanonical(data) {
+		return nil, ErrNotCanonical
+	}
+	if len(data) < 2 {
+		return nil, ErrShortRead
+	}
+	if data[1] == 0 || data[1] > FormatVersion {
+		return nil, fmt.Errorf("%w %d", ErrUnknownVersion, data[1])
+	}
+	return &Reader{data: data, pos: 2, version: data[1]}, nil
+}
+
+// IsCurrent reports whether data is a canonical encoding in the current format version
+func IsCurrent(data []byte) bool {
+	return len(data) > 1 && data[0] == Magic && data[1] == FormatVersion
+}
+
+// NewRawReader reads an encoding without a header
+func NewRawReader(data []byte) *Reader {
+	return &Reader{data: data, version: FormatVersion}
+}
+
+// Version is the format version of the data being read
+func (r *Reader) Version() byte {
+	return r.version
+}
+
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Done returns the first error, or ErrTrailingData if anything is left unread
+func (r *Reader) Done() error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.pos != len(r.data) {
+		return ErrTrailingData
+	}
+	return nil
+}
+
+func (r *Reader) Byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos >= len(r.data) {
+		r.err = ErrShortRead
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *Reader) Bool() bool {
+	b := r.Byte()
+	if b > 1 && r.err == nil {
+		r.err = errors.New("codec: bool is not 0 or 1")
+	}
+	return b == 1
+}
+
+func (r *Reader) Uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	num, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.err = ErrShortRead
+		return 0
+	}
+	var raw [binary.MaxVarintLen64]byte
+	if binary.PutUvarint(raw[:], num) != n {
+		r.err = ErrNonCanonical
+		return 0
+	}
+	r.pos += n
+	return num
+}
+
+func (r *Reader) Varint() int64 {
+	zigzag := r.Uvarint()
+	num := int64(zigzag >> 1)
+	if zigzag&1 != 0 {
+		num = ^num
+	}
+	return num
+}
+
+// Int reads a Varint into an int
+func (r *Reader) Int() int {
+	return int(r.Varint())
+}
+
+// Count reads a Uvarint element count, rejecting counts that cannot fit in what is left
+func (r *Reader) Count() int {
+	count := r.Uvarint()
+	if r.err == nil && count > uint64(len(r.data)-r.pos) {
+		r.err = ErrShortRead
+		return 0
+	}
+	return int(count)
+}
+
+// Bytes reads a length prefixed byte string. An empty string reads as nil
+func (r *Reader) Bytes() []byte {
+	length := r.Uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if length > MaxBytesLen || length > uint64(len(r.data)-r.pos) {
+		r.err = ErrShortRead
+		return nil
+	}
+	if length == 0 {
+		return nil
+	}
+	data := make([]byte, length)
+	copy(data, r.data[r.pos:])
+	r.pos += int(length)
+	return data
+}
+
+func (r *Reader) String() string {
+	return string(r.Bytes())
+}
+
+func (r *Reader) BytesList() [][]byte {
+	count := r.Count()
+	var list [][]byte
+	for i := 0; i < count && r.err == nil; i++ {
+		list = append(list, r.Bytes())
+	}
+	return list
+}
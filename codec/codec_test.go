@@ -0,0 +1,185 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// The varint vectors of docs/serialization.md
+func TestVarintVectors(t *testing.T) {
+	varints := []struct {
+		num     int64
+		encoded string
+	}{{0, "00"}, {1, "02"}, {-1, "01"}, {63, "7e"}, {-64, "7f"}, {64, "8001"}, {300, "d804"}}
+	for _, test := range varints {
+		w := NewRawWriter()
+		w.Varint(test.num)
+		if got := hex.EncodeToString(w.Data()); got != test.encoded {
+			t.Errorf("Varint(%d) = %s, want %s", test.num, got, test.encoded)
+		}
+		raw, _ := hex.DecodeString(test.encoded)
+		r := NewRawReader(raw)
+		if got := r.Varint(); got != test.num || r.Done() != nil {
+			t.Errorf("reading %s: %d, %v, want %d", test.encoded, got, r.Done(), test.num)
+		}
+	}
+
+	uvarints := []struct {
+		num     uint64
+		encoded string
+	}{{0, "00"}, {127, "7f"}, {128, "8001"}, {300, "ac02"}}
+	for _, test := range uvarints {
+		w := NewRawWriter()
+		w.Uvarint(test.num)
+		if got := hex.EncodeToString(w.Data()); got != test.encoded {
+			t.Errorf("Uvarint(%d) = %s, want %s", test.num, got, test.encoded)
+		}
+		raw, _ := hex.DecodeString(test.encoded)
+		r := NewRawReader(raw)
+		if got := r.Uvarint(); got != test.num || r.Done() != nil {
+			t.Errorf("reading %s: %d, %v, want %d", test.encoded, got, r.Done(), test.num)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	w := NewWriter()
+	w.Byte(0x7a)
+	w.Bool(true)
+	w.Bool(false)
+	w.Uvarint(1 << 63)
+	w.Varint(-1 << 63)
+	w.Varint(1<<63 - 1)
+	w.Bytes([]byte{1, 2, 3})
+	w.Bytes(nil)
+	w.String("africoin")
+	w.BytesList([][]byte{{4}, nil, {5, 6}})
+	w.BytesList(nil)
+
+	data := w.Data()
+	if !IsCanonical(data) || !IsCurrent(data) {
+		t.Fatalf("%x does not start with the current header", data)
+	}
+	r, err := NewReader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Byte(); got != 0x7a {
+		t.Errorf("Byte = %#x", got)
+	}
+	if !r.Bool() || r.Bool() {
+		t.Error("Bool did not round trip")
+	}
+	if got := r.Uvarint(); got != 1<<63 {
+		t.Errorf("Uvarint = %d", got)
+	}
+	if got := r.Varint(); got != -1<<63 {
+		t.Errorf("Varint = %d", got)
+	}
+	if got := r.Varint(); got != 1<<63-1 {
+		t.Errorf("Varint = %d", got)
+	}
+	if got := r.Bytes(); !bytes.Equal(got, []byte{1, 2, 3}) {
+		t.Errorf("Bytes = %x", got)
+	}
+	if got := r.Bytes(); got != nil {
+		t.Errorf("empty Bytes = %#v, want nil", got)
+	}
+	if got := r.String(); got != "africoin" {
+		t.Errorf("String = %q", got)
+	}
+	list := r.BytesList()
+	if len(list) != 3 || !bytes.Equal(list[0], []byte{4}) || list[1] != nil || !bytes.Equal(list[2], []byte{5, 6}) {
+		t.Errorf("BytesList = %x", list)
+	}
+	if got := r.BytesList(); got != nil {
+		t.Errorf("empty BytesList = %x", got)
+	}
+	if err := r.Done(); err != nil {
+		t.Errorf("Done = %v", err)
+	}
+}
+
+// Every value has exactly one encoding: varints padded with continuation bytes are rejected
+func TestNonMinimalVarints(t *testing.T) {
+	for _, encoded := range []string{"8000", "ff00", "808000", "8180808000"} {
+		raw, _ := hex.DecodeString(encoded)
+		r := NewRawReader(raw)
+		r.Uvarint()
+		if !errors.Is(r.Err(), ErrNonCanonical) {
+			t.Errorf("Uvarint %s: %v, want ErrNonCanonical", encoded, r.Err())
+		}
+		r = NewRawReader(raw)
+		r.Varint()
+		if !errors.Is(r.Err(), ErrNonCanonical) {
+			t.Errorf("Varint %s: %v, want ErrNonCanonical", encoded, r.Err())
+		}
+	}
+}
+
+func TestTrailingData(t *testing.T) {
+	w := NewWriter()
+	w.Bytes([]byte{1})
+	r, err := NewReader(append(w.Data(), 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Bytes()
+	if err := r.Done(); !errors.Is(err, ErrTrailingData) {
+		t.Errorf("Done = %v, want ErrTrailingData", err)
+	}
+}
+
+func TestRejectedInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		read    func(r *Reader)
+		wantErr error
+	}{
+		{"short varint", "af0280", func(r *Reader) { r.Uvarint() }, ErrShortRead},
+		{"empty", "af02", func(r *Reader) { r.Byte() }, ErrShortRead},
+		{"bytes longer than the data", "af020301", func(r *Reader) { r.Bytes() }, ErrShortRead},
+		{"count larger than the data", "af020500", func(r *Reader) { r.BytesList() }, ErrShortRead},
+		{"bool above 1", "af0202", func(r *Reader) { r.Bool() }, nil},
+	}
+	for _, test := range tests {
+		raw, _ := hex.DecodeString(test.data)
+		r, err := NewReader(raw)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		test.read(r)
+		if r.Err() == nil || (test.wantErr != nil && !errors.Is(r.Err(), test.wantErr)) {
+			t.Errorf("%s: error %v, want %v", test.name, r.Err(), test.wantErr)
+		}
+		if r.Done() == nil {
+			t.Errorf("%s: Done accepted it", test.name)
+		}
+	}
+}
+
+// The header tells canonical data from gob and refuses format versions it does not know
+func TestHeader(t *testing.T) {
+	if _, err := NewReader([]byte{0x0e, 0xff}); !errors.Is(err, ErrNotCanonical) {
+		t.Errorf("gob stream: %v, want ErrNotCanonical", err)
+	}
+	if _, err := NewReader([]byte{Magic}); !errors.Is(err, ErrShortRead) {
+		t.Errorf("magic only: %v, want ErrShortRead", err)
+	}
+	for _, version := range []byte{0, FormatVersion + 1} {
+		if _, err := NewReader([]byte{Magic, version}); !errors.Is(err, ErrUnknownVersion) {
+			t.Errorf("format version %d: %v, want ErrUnknownVersion", version, err)
+		}
+	}
+	old := NewWriterVersion(1)
+	r, err := NewReader(old.Data())
+	if err != nil || r.Version() != 1 {
+		t.Errorf("format version 1: version %v, %v", r, err)
+	}
+	if IsCurrent(old.Data()) {
+		t.Error("format version 1 reported as current")
+	}
+}
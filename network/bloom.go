@@ -0,0 +1,129 @@
+package network
+
+import (
+	"fmt"
+	"sync"
+
+	"main.go/blockchain"
+)
+
+// Bloom filters loaded by thin client peers, keyed by the peer's address.
+// Peers without one are sent everything
+var(
+	peerFilters = make(map[string]*blockchain.BloomFilter)
+	peerFiltersLock sync.Mutex
+)
+
+// FilterLoad replaces the Bloom filter of the sending peer
+type FilterLoad struct{
+	AddrYou   string
+	Filter    []byte
+	HashFuncs uint32
+	Tweak     uint32
+	Flags     byte
+}
+
+// FilterAdd adds one item to the sending peer's Bloom filter
+type FilterAdd struct{
+	AddrYou string
+	Data    []byte
+}
+
+// FilterClear removes the sending peer's Bloom filter
+type FilterClear struct{
+	AddrYou string
+}
+
+func SendFilterLoad(addr string, bf *blockchain.BloomFilter){
+	data := FilterLoad{nodeAddr, bf.Filter, bf.HashFuncs, bf.Tweak, bf.Flags}
+	request := encodePayload("filterload", &data)
+	SendData(addr, request)
+}
+
+func SendFilterAdd(addr string, item []byte){
+	data := FilterAdd{nodeAddr, item}
+	request := encodePayload("filteradd", &data)
+	SendData(addr, request)
+}
+
+func SendFilterClear(addr string){
+	data := FilterClear{nodeAddr}
+	request := encodePayload("filterclear", &data)
+	SendData(addr, request)
+}
+
+func HandleFilterLoad(request []byte){
+	var payload FilterLoad
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	bf := &blockchain.BloomFilter{Filter: payload.Filter, HashFuncs: payload.HashFuncs, Tweak: payload.Tweak, Flags: payload.Flags}
+	if err := bf.Validate(); err != nil{
+		fmt.Println("Rejected filter:", err)
+		return
+	}
+	peerFiltersLock.Lock()
+	peerFilters[payload.AddrYou] = bf
+	peerFiltersLock.Unlock()
+}
+
+func HandleFilterAdd(request []byte){
+	var payload FilterAdd
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	if len(payload.Data) > 520{
+		fmt.Println("Rejected filter item: larger than 520 bytes")
+		return
+	}
+	peerFiltersLock.Lock()
+	defer peerFiltersLock.Unlock()
+	if bf, ok := peerFilters[payload.AddrYou]; ok{
+		bf.Add(payload.Data)
+	}else{
+		fmt.Println("No filter loaded for", payload.AddrYou)
+	}
+}
+
+func HandleFilterClear(request []byte){
+	var payload FilterClear
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	peerFiltersLock.Lock()
+	delete(peerFilters, payload.AddrYou)
+	peerFiltersLock.Unlock()
+}
+
+// peerWantsTx reports whether tx should be relayed to peer, updating the peer's filter
+func peerWantsTx(peer string, tx *blockchain.Transaction) bool{
+	peerFiltersLock.Lock()
+	defer peerFiltersLock.Unlock()
+	bf, ok := peerFilters[peer]
+	return !ok || bf.MatchTx(tx)
+}
+
+// filteredBlock builds a merkle block of the transactions in block that match peer's filter
+func filteredBlock(peer string, block *blockchain.Block) (*blockchain.MerkleBlock, error){
+	peerFiltersLock.Lock()
+	bf, ok := peerFilters[peer]
+	var ids [][]byte
+	if ok{
+		for _, tx := range block.Transactions{
+			if bf.MatchTx(tx){
+				ids = append(ids, tx.ID)
+			}
+		}
+	}
+	peerFiltersLock.Unlock()
+	if !ok{
+		return nil, fmt.Errorf("no filter loaded for %s", peer)
+	}
+	return blockchain.NewMerkleBlock(block, ids)
+}
@@ -0,0 +1,66 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+
+	"main.go/blockchain"
+	"main.go/wallet"
+)
+
+// A peer's filter decides what it is sent once loaded, grows with filteradd and is dropped
+// by filterclear, after which the peer is sent everything again
+func TestPeerFilter(t *testing.T) {
+	const peer = "localhost:3999"
+	defer delete(peerFilters, peer)
+
+	mine, other := bytes.Repeat([]byte{0xaa}, 20), bytes.Repeat([]byte{0xbb}, 20)
+	payment := blockchain.CoinbaseTx(string(wallet.PubKeyHashAddress(mine)), "")
+	unrelated := blockchain.CoinbaseTx(string(wallet.PubKeyHashAddress(other)), "")
+	block := blockchain.CreateBlock([]*blockchain.Transaction{payment, unrelated}, nil, 0)
+
+	if !peerWantsTx(peer, unrelated) {
+		t.Error("peer without a filter not sent a transaction")
+	}
+	if _, err := filteredBlock(peer, block); err == nil {
+		t.Error("filtered block built for a peer without a filter")
+	}
+
+	bf := blockchain.NewBloomFilter(10, 0.0001, 5, blockchain.BloomUpdateNone)
+	bf.Add(mine)
+	HandleFilterLoad(encodePayload("filterload", &FilterLoad{peer, bf.Filter, bf.HashFuncs, bf.Tweak, bf.Flags}))
+	if !peerWantsTx(peer, payment) || peerWantsTx(peer, unrelated) {
+		t.Error("loaded filter not applied to transactions")
+	}
+	mb, err := filteredBlock(peer, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mb.Txs) != 1 || !bytes.Equal(mb.Txs[0].ID, payment.ID) {
+		t.Errorf("filtered block holds %d transactions, want the payment only", len(mb.Txs))
+	}
+	if err := mb.Verify(); err != nil {
+		t.Errorf("filtered block: %v", err)
+	}
+
+	HandleFilterAdd(encodePayload("filteradd", &FilterAdd{peer, other}))
+	if !peerWantsTx(peer, unrelated) {
+		t.Error("item added to the filter not matched")
+	}
+	loaded := append([]byte{}, peerFilters[peer].Filter...)
+	HandleFilterAdd(encodePayload("filteradd", &FilterAdd{peer, make([]byte, 521)}))
+	if !bytes.Equal(peerFilters[peer].Filter, loaded) {
+		t.Error("item larger than 520 bytes added to the filter")
+	}
+
+	HandleFilterClear(encodePayload("filterclear", &FilterClear{peer}))
+	if _, ok := peerFilters[peer]; ok {
+		t.Error("filter kept after filterclear")
+	}
+
+	invalid := FilterLoad{peer, make([]byte, blockchain.MaxBloomFilterSize+1), 1, 0, 0}
+	HandleFilterLoad(encodePayload("filterload", &invalid))
+	if _, ok := peerFilters[peer]; ok {
+		t.Error("oversized filter loaded")
+	}
+}
@@ -0,0 +1,228 @@
+package network
+
+import (
+	"main.go/codec"
+)
+
+// Payloads are written in the canonical format after the command bytes,
+// see docs/serialization.md
+type message interface {
+	encode(w *codec.Writer)
+	decode(r *codec.Reader)
+}
+
+func encodePayload(cmd string, msg message) []byte {
+	w := codec.NewWriter()
+	msg.encode(w)
+	return append(CmdToBytes(cmd), w.Data()...)
+}
+
+// decodePayload fills msg from the payload of request and rejects malformed or legacy gob payloads
+func decodePayload(request []byte, msg message) error {
+	r, err := codec.NewReader(request[commandLen:])
+	if err != nil {
+		return err
+	}
+	msg.decode(r)
+	return r.Done()
+}
+
+func (m *Addr) encode(w *codec.Writer) {
+	w.Uvarint(uint64(len(m.AddrList)))
+	for _, addr := range m.AddrList {
+		w.String(addr)
+	}
+}
+
+func (m *Addr) decode(r *codec.Reader) {
+	count := r.Count()
+	for i := 0; i < count && r.Err() == nil; i++ {
+		m.AddrList = append(m.AddrList, r.String())
+	}
+}
+
+func (m *Block) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+	w.Bytes(m.Block)
+}
+
+func (m *Block) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+	m.Block = r.Bytes()
+}
+
+func (m *GetBlocks) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+}
+
+func (m *GetBlocks) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+}
+
+func (m *GetData) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+	w.String(m.Type)
+	w.Bytes(m.ID)
+}
+
+func (m *GetData) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+	m.Type = r.String()
+	m.ID = r.Bytes()
+}
+
+func (m *MerkleBlock) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+	w.Bytes(m.MerkleBlock)
+}
+
+func (m *MerkleBlock) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+	m.MerkleBlock = r.Bytes()
+}
+
+func (m *GetHeaders) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+	w.Bytes(m.Since)
+}
+
+func (m *GetHeaders) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+	m.Since = r.Bytes()
+}
+
+func (m *Headers) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+	w.BytesList(m.Headers)
+}
+
+func (m *Headers) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+	m.Headers = r.BytesList()
+}
+
+func (m *Inventory) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+	w.String(m.Type)
+	w.BytesList(m.Items)
+}
+
+func (m *Inventory) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+	m.Type = r.String()
+	m.Items = r.BytesList()
+}
+
+func (m *TX) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+	w.Bytes(m.Transaction)
+}
+
+func (m *TX) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+	m.Transaction = r.Bytes()
+}
+
+func (m *Version) encode(w *codec.Writer) {
+	w.Varint(int64(m.Version))
+	w.Varint(int64(m.BestHeight))
+	w.String(m.AddrYou)
+}
+
+func (m *Version) decode(r *codec.Reader) {
+	m.Version = r.Int()
+	m.BestHeight = r.Int()
+	m.AddrYou = r.String()
+}
+
+func (m *GetProofs) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+	w.BytesList(m.PubKeyHashes)
+	w.Varint(int64(m.Height))
+}
+
+func (m *GetProofs) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+	m.PubKeyHashes = r.BytesList()
+	m.Height = r.Int()
+}
+
+func (m *GetCFHeaders) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+	w.Bytes(m.Since)
+}
+
+func (m *GetCFHeaders) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+	m.Since = r.Bytes()
+}
+
+func (m *CFHeaders) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+	w.Bytes(m.Since)
+	w.Bytes(m.PrevHeader)
+	w.BytesList(m.FilterHashes)
+}
+
+func (m *CFHeaders) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+	m.Since = r.Bytes()
+	m.PrevHeader = r.Bytes()
+	m.FilterHashes = r.BytesList()
+}
+
+func (m *GetCFilters) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+	w.BytesList(m.BlockHashes)
+}
+
+func (m *GetCFilters) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+	m.BlockHashes = r.BytesList()
+}
+
+func (m *CFilter) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+	w.Bytes(m.BlockHash)
+	w.Bytes(m.Filter)
+}
+
+func (m *CFilter) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+	m.BlockHash = r.Bytes()
+	m.Filter = r.Bytes()
+}
+
+func (m *FilterLoad) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+	w.Bytes(m.Filter)
+	w.Uvarint(uint64(m.HashFuncs))
+	w.Uvarint(uint64(m.Tweak))
+	w.Byte(m.Flags)
+}
+
+func (m *FilterLoad) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+	m.Filter = r.Bytes()
+	m.HashFuncs = uint32(r.Uvarint())
+	m.Tweak = uint32(r.Uvarint())
+	m.Flags = r.Byte()
+}
+
+func (m *FilterAdd) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+	w.Bytes(m.Data)
+}
+
+func (m *FilterAdd) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+	m.Data = r.Bytes()
+}
+
+func (m *FilterClear) encode(w *codec.Writer) {
+	w.String(m.AddrYou)
+}
+
+func (m *FilterClear) decode(r *codec.Reader) {
+	m.AddrYou = r.String()
+}
@@ -0,0 +1,68 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"reflect"
+	"testing"
+
+	"main.go/codec"
+)
+
+// Every payload decodes to the message it was encoded from, and nothing may follow it
+func TestPayloadRoundTrip(t *testing.T) {
+	hashes := [][]byte{bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)}
+	messages := map[string]struct {
+		sent, received message
+	}{
+		"addr":         {&Addr{AddrList: []string{"localhost:3000", "localhost:3001"}}, &Addr{}},
+		"block":        {&Block{AddrYou: "localhost:3000", Block: []byte{0xaf, 0x02}}, &Block{}},
+		"getblocks":    {&GetBlocks{AddrYou: "localhost:3000"}, &GetBlocks{}},
+		"getdata":      {&GetData{AddrYou: "localhost:3000", Type: "tx", ID: hashes[0]}, &GetData{}},
+		"merkleblock":  {&MerkleBlock{AddrYou: "localhost:3000", MerkleBlock: []byte{3}}, &MerkleBlock{}},
+		"getheaders":   {&GetHeaders{AddrYou: "localhost:3000", Since: hashes[0]}, &GetHeaders{}},
+		"headers":      {&Headers{AddrYou: "localhost:3000", Headers: hashes}, &Headers{}},
+		"inv":          {&Inventory{AddrYou: "localhost:3000", Type: "block", Items: hashes}, &Inventory{}},
+		"tx":           {&TX{AddrYou: "localhost:3000", Transaction: []byte{4, 5}}, &TX{}},
+		"version":      {&Version{Version: 2, BestHeight: -1, AddrYou: "localhost:3000"}, &Version{}},
+		"getproofs":    {&GetProofs{AddrYou: "localhost:3000", PubKeyHashes: hashes, Height: 7}, &GetProofs{}},
+		"getcfheaders": {&GetCFHeaders{AddrYou: "localhost:3000", Since: hashes[1]}, &GetCFHeaders{}},
+		"cfheaders": {&CFHeaders{AddrYou: "localhost:3000", Since: hashes[0], PrevHeader: hashes[1], FilterHashes: hashes},
+			&CFHeaders{}},
+		"getcfilters": {&GetCFilters{AddrYou: "localhost:3000", BlockHashes: hashes}, &GetCFilters{}},
+		"cfilter":     {&CFilter{AddrYou: "localhost:3000", BlockHash: hashes[0], Filter: []byte{6}}, &CFilter{}},
+		"filterload": {&FilterLoad{AddrYou: "localhost:3000", Filter: []byte{7, 8}, HashFuncs: 11, Tweak: 1 << 31, Flags: 1},
+			&FilterLoad{}},
+		"filteradd":   {&FilterAdd{AddrYou: "localhost:3000", Data: []byte{9}}, &FilterAdd{}},
+		"filterclear": {&FilterClear{AddrYou: "localhost:3000"}, &FilterClear{}},
+	}
+	for cmd, test := range messages {
+		request := encodePayload(cmd, test.sent)
+		if got := BytesToCmd(request[:commandLen]); got != cmd {
+			t.Errorf("%s: command read back as %q", cmd, got)
+		}
+		if err := decodePayload(request, test.received); err != nil {
+			t.Errorf("%s: %v", cmd, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.sent, test.received) {
+			t.Errorf("%s: sent %+v, received %+v", cmd, test.sent, test.received)
+		}
+		if err := decodePayload(append(request, 0), test.received); !errors.Is(err, codec.ErrTrailingData) {
+			t.Errorf("%s with a trailing byte: %v, want ErrTrailingData", cmd, err)
+		}
+	}
+}
+
+// Nodes speaking the gob protocol are not understood
+func TestGobPayloadRejected(t *testing.T) {
+	buff := new(bytes.Buffer)
+	if err := gob.NewEncoder(buff).Encode(GetBlocks{AddrYou: "localhost:3000"}); err != nil {
+		t.Fatal(err)
+	}
+	request := append(CmdToBytes("getblocks"), buff.Bytes()...)
+	if err := decodePayload(request, &GetBlocks{}); !errors.Is(err, codec.ErrNotCanonical) {
+		t.Errorf("gob payload: %v, want ErrNotCanonical", err)
+	}
+}
@@ -2,7 +2,6 @@ package network
 
 import (
 	"bytes"
-	"encoding/gob"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -11,6 +10,7 @@ import (
 	"os"
 	"runtime"
 	"syscall"
+	"time"
 
 	"github.com/vrecan/death/v3"
 	"main.go/blockchain"
@@ -19,7 +19,7 @@ import (
 
 const(
 	protocol = "tcp"
-	nVersion = 1
+	nVersion = 2
 	commandLen = 12
 )
 
@@ -45,6 +45,61 @@ type GetBlocks struct{
 	// Get the block from one node and send(copy) to another node
 }
 
+// GetHeaders asks for the headers of the best chain after Since, an empty Since starts at genesis
+type GetHeaders struct{
+	AddrYou string
+	Since   []byte
+}
+
+// Headers answers GetHeaders with serialized block headers, lowest first
+type Headers struct{
+	AddrYou string
+	Headers [][]byte
+}
+
+// MerkleBlock carries a serialized blockchain.MerkleBlock
+type MerkleBlock struct{
+	AddrYou     string
+	MerkleBlock []byte
+}
+
+// GetProofs asks a full node for merkle blocks of the best chain blocks from Height on
+// holding transactions that pay to or spend from PubKeyHashes
+type GetProofs struct{
+	AddrYou      string
+	PubKeyHashes [][]byte
+	Height       int
+}
+
+// GetCFHeaders asks for the filter hashes of the best chain blocks after Since,
+// an empty Since starts at genesis
+type GetCFHeaders struct{
+	AddrYou string
+	Since   []byte
+}
+
+// CFHeaders answers GetCFHeaders with the filter header of Since and the filter hashes
+// of the blocks after it, lowest first. Each filter header is
+// sha256(filter hash || previous filter header)
+type CFHeaders struct{
+	AddrYou      string
+	Since        []byte
+	PrevHeader   []byte
+	FilterHashes [][]byte
+}
+
+type GetCFilters struct{
+	AddrYou     string
+	BlockHashes [][]byte
+}
+
+// CFilter carries the compact filter of one block
+type CFilter struct{
+	AddrYou   string
+	BlockHash []byte
+	Filter    []byte
+}
+
 type GetData struct{
 	AddrYou   string
 	Type      string
@@ -98,13 +153,6 @@ func BytesToCmd(bytes []byte) string{
 func ExtractCmd(request []byte) []byte{
 	return request[:commandLen]
 }
-func GobEncode(data interface{}) []byte{
-	buff := new(bytes.Buffer)
-	encoder := gob.NewEncoder(buff)
-	err := encoder.Encode(data)
-	handleErr(err)
-	return buff.Bytes()
-}
 
 func CloseDB(chain *blockchain.BlockChain){
 	close := death.NewDeath(syscall.SIGINT, syscall.SIGTERM, os.Interrupt) // Linux, OSx, Windows
@@ -121,6 +169,10 @@ func HandleConn(conn net.Conn, chain *blockchain.BlockChain){
 	defer conn.Close()
 
 	handleErr(err)
+	if len(req) < commandLen{
+		fmt.Println("Invalid command")
+		return
+	}
 	command := BytesToCmd(req[:commandLen])
 	fmt.Printf("Received %s command \n", command)
 	switch command{
@@ -138,6 +190,24 @@ func HandleConn(conn net.Conn, chain *blockchain.BlockChain){
 		HandleGetBlocks(req, chain)
 	case "getdata":
 		HandleGetData(req, chain)
+	case "getheaders":
+		HandleGetHeaders(req, chain)
+	case "headers":
+		HandleHeaders(req, chain)
+	case "merkleblock":
+		HandleMerkleBlock(req)
+	case "getproofs":
+		HandleGetProofs(req, chain)
+	case "getcfheaders":
+		HandleGetCFHeaders(req, chain)
+	case "getcfilters":
+		HandleGetCFilters(req, chain)
+	case "filterload":
+		HandleFilterLoad(req)
+	case "filteradd":
+		HandleFilterAdd(req)
+	case "filterclear":
+		HandleFilterClear(req)
 
 
 	default:
@@ -167,65 +237,96 @@ func SendData(addr string, data []byte){
 func SendAddr(address string){
 	nodes := Addr{KnownNodes}
 	nodes.AddrList = append(nodes.AddrList, nodeAddr)
-	payload := GobEncode(nodes)
-	request := append(CmdToBytes("addr"), payload...)
+	request := encodePayload("addr", &nodes)
 
 	SendData(address, request)
 }
 
 func SendBlock(address string, block *blockchain.Block){
 	data := Block{nodeAddr, block.Serialize()}
-	payload := GobEncode(data)
-	request := append(CmdToBytes("block"), payload...)
+	request := encodePayload("block", &data)
 	
 	SendData(address, request)
 }
 
 func SendInventory(addr, kind string, items [][]byte){
-	data := Inventory{addr, kind, items}
-	payload := GobEncode(data)
-	request := append(CmdToBytes("inv"), payload...)
+	data := Inventory{nodeAddr, kind, items}
+	request := encodePayload("inv", &data)
 
 	SendData(addr, request)
 }
 
 func SendTx(addr string, transaction *blockchain.Transaction){
-	data := TX{addr, transaction.SerializeTx()} // Pilot Police 😎
-	payload := GobEncode(data)
-	request := append(CmdToBytes("tx"), payload...)
+	data := TX{nodeAddr, transaction.SerializeTx()} // Pilot Police 😎
+	request := encodePayload("tx", &data)
 	SendData(addr, request)
 }
 
 func SendVersion(addr string, chain *blockchain.BlockChain){
 	bestHeight := chain.GetBestHeight()
-	data := Version{nVersion, bestHeight, addr}
-	payload := GobEncode(data)
-	request := append(CmdToBytes("version"), payload...)
+	data := Version{nVersion, bestHeight, nodeAddr}
+	request := encodePayload("version", &data)
 	SendData(addr, request)
 }
 
 func SendGetBlocks(addr string){
 	data := GetBlocks{nodeAddr}
-	payload := GobEncode(data)
-	request := append(CmdToBytes("getblocks"), payload...)
+	request := encodePayload("getblocks", &data)
 	SendData(addr, request)
 }
 
 func SendGetData(addr, kind string, id []byte){
 	data := GetData{nodeAddr, kind, id}
-	payload := GobEncode(data)
-	request := append(CmdToBytes("getdata"), payload...)
+	request := encodePayload("getdata", &data)
+	SendData(addr, request)
+}
+
+func SendGetHeaders(addr string, since []byte){
+	data := GetHeaders{nodeAddr, since}
+	request := encodePayload("getheaders", &data)
+	SendData(addr, request)
+}
+
+func SendHeaders(addr string, headers []*blockchain.BlockHeader){
+	data := Headers{AddrYou: nodeAddr}
+	for _, header := range headers{
+		data.Headers = append(data.Headers, header.Serialize())
+	}
+	request := encodePayload("headers", &data)
+	SendData(addr, request)
+}
+
+func SendMerkleBlock(addr string, mb *blockchain.MerkleBlock){
+	data := MerkleBlock{nodeAddr, mb.Serialize()}
+	request := encodePayload("merkleblock", &data)
+	SendData(addr, request)
+}
+
+func SendGetProofs(addr string, pubKeyHashes [][]byte, height int){
+	data := GetProofs{nodeAddr, pubKeyHashes, height}
+	request := encodePayload("getproofs", &data)
+	SendData(addr, request)
+}
+
+func SendGetCFHeaders(addr string, since []byte){
+	data := GetCFHeaders{nodeAddr, since}
+	request := encodePayload("getcfheaders", &data)
+	SendData(addr, request)
+}
+
+func SendGetCFilters(addr string, blockHashes [][]byte){
+	data := GetCFilters{nodeAddr, blockHashes}
+	request := encodePayload("getcfilters", &data)
 	SendData(addr, request)
 }
 
 func HandleAddr(request []byte){
-	var buff bytes.Buffer
 	var payload Addr
 
-	buff.Write(request[commandLen:])
-	decoder := gob.NewDecoder(&buff)
-	err := decoder.Decode(&payload)
-	handleErr(err)
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
 	KnownNodes = append(KnownNodes, payload.AddrList...)
 	RequestBlocks() 
 }
@@ -237,15 +338,18 @@ func RequestBlocks(){
 }
 
 func HandleBlock(request []byte, chain *blockchain.BlockChain){
-	var buff bytes.Buffer
 	var payload Block
 
-	buff.Write(request[commandLen:])
-	decoder := gob.NewDecoder(&buff)
-	err := decoder.Decode(&payload)
-	handleErr(err)
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
 	blockData := payload.Block
-	block := blockchain.Deserialize(blockData)
+	block, err := blockchain.ParseBlock(blockData)
+	if err != nil{
+		fmt.Println("Invalid block:", err)
+		return
+	}
 	fmt.Println("Received a new block")
 	chain.AddBlock(block) // CHANGE LATER
 	fmt.Printf("Added block %x\n", block.Hash)
@@ -255,31 +359,30 @@ func HandleBlock(request []byte, chain *blockchain.BlockChain){
 		SendGetData(payload.AddrYou, "block", blockHash)
 		blocksInTransit = blocksInTransit[1:]
 	}else{
-		UTXOSet := blockchain.UTXOset{chain}
+		UTXOSet := blockchain.UTXOset{Blockchain: chain}
 		UTXOSet.Reindex()
+		chain.SyncIndexes()
 	}
 }
 
 func HandleGetBlocks(request []byte, chain *blockchain.BlockChain){
-	var buff bytes.Buffer
 	var payload GetBlocks
 
-	buff.Write(request[commandLen:])
-	decoder := gob.NewDecoder(&buff)
-	err := decoder.Decode(&payload)
-	handleErr(err)
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
 	blocks := chain.GetBlocksHashes()
-	SendInventory(payload.AddrYou, "blocks", blocks)
+	SendInventory(payload.AddrYou, "block", blocks)
 }
 
 func HandleGetData(request []byte, chain *blockchain.BlockChain){
-	var buff bytes.Buffer
 	var payload GetData
 
-	buff.Write(request[commandLen:])
-	decoder := gob.NewDecoder(&buff)
-	err := decoder.Decode(&payload)
-	handleErr(err)
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
 
 	if payload.Type == "block"{
 		block, err := chain.GetBlock([]byte(payload.ID))
@@ -289,20 +392,157 @@ func HandleGetData(request []byte, chain *blockchain.BlockChain){
 
 	if payload.Type == "tx"{
 		txId := hex.EncodeToString(payload.ID)
-		tx := memPool[txId]
-
+		tx, ok := memPool[txId]
+		// a peer with a Bloom filter only gets the transactions it matches,
+		// even when it asks for others by ID
+		if !ok || !peerWantsTx(payload.AddrYou, &tx){
+			return
+		}
 		SendTx(payload.AddrYou, &tx)
 	}
+
+	if payload.Type == "filteredblock"{
+		block, err := chain.GetBlock(payload.ID)
+		if err != nil{
+			fmt.Println(err)
+			return
+		}
+		mb, err := filteredBlock(payload.AddrYou, &block)
+		if err != nil{
+			fmt.Println(err)
+			return
+		}
+		SendMerkleBlock(payload.AddrYou, mb)
+	}
+
+	if payload.Type == "txproof"{
+		mb, err := chain.GetTxProof(payload.ID)
+		if err != nil{
+			fmt.Println(err)
+			return
+		}
+		SendMerkleBlock(payload.AddrYou, mb)
+	}
+}
+
+// HandleMerkleBlock checks the proofs of a merkle block sent in answer to a txproof request
+func HandleMerkleBlock(request []byte){
+	var payload MerkleBlock
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	mb, err := blockchain.DeserializeMerkleBlock(payload.MerkleBlock)
+	if err == nil{
+		err = mb.Verify()
+	}
+	if err != nil{
+		fmt.Println("Invalid merkle block:", err)
+		return
+	}
+	for _, tx := range mb.Txs{
+		fmt.Printf("Transaction %x is in block %x at height %d\n", tx.ID, mb.Header.Hash(), mb.Height)
+	}
+}
+
+func HandleGetHeaders(request []byte, chain *blockchain.BlockChain){
+	var payload GetHeaders
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	headers := chain.GetHeaders(payload.Since, blockchain.MaxHeadersPerMessage)
+	SendHeaders(payload.AddrYou, headers)
+}
+
+func HandleGetProofs(request []byte, chain *blockchain.BlockChain){
+	var payload GetProofs
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	for _, mb := range chain.FindMerkleBlocks(payload.PubKeyHashes, payload.Height){
+		SendMerkleBlock(payload.AddrYou, mb)
+	}
+}
+
+func HandleGetCFHeaders(request []byte, chain *blockchain.BlockChain){
+	var payload GetCFHeaders
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	prevHeader, hashes, err := chain.GetFilterHashes(payload.Since, blockchain.MaxHeadersPerMessage)
+	if err != nil{
+		fmt.Println(err)
+		return
+	}
+	data := CFHeaders{nodeAddr, payload.Since, prevHeader, hashes}
+	SendData(payload.AddrYou, encodePayload("cfheaders", &data))
+}
+
+func HandleGetCFilters(request []byte, chain *blockchain.BlockChain){
+	var payload GetCFilters
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	for _, blockHash := range payload.BlockHashes{
+		filter, _, err := chain.GetFilter(blockHash)
+		if err != nil{
+			fmt.Println(err)
+			return
+		}
+		data := CFilter{nodeAddr, blockHash, filter}
+		SendData(payload.AddrYou, encodePayload("cfilter", &data))
+	}
+}
+
+// HandleHeaders checks that the headers link up and carry valid proofs of work,
+// then asks for the bodies of the blocks this node does not have
+func HandleHeaders(request []byte, chain *blockchain.BlockChain){
+	var payload Headers
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	var prevHash []byte
+	var missing [][]byte
+	for i, data := range payload.Headers{
+		header, err := blockchain.DeserializeHeader(data)
+		if err != nil || !blockchain.ValidateHeader(header){
+			fmt.Println("Invalid header from", payload.AddrYou)
+			return
+		}
+		if i > 0 && !bytes.Equal(header.PrevHash, prevHash){
+			fmt.Println("Headers do not link up")
+			return
+		}
+		prevHash = header.Hash()
+		if _, err := chain.GetBlock(prevHash); err != nil{
+			missing = append(missing, prevHash)
+		}
+	}
+	fmt.Printf("Received %d headers, %d new\n", len(payload.Headers), len(missing))
+	if len(missing) > 0{
+		blocksInTransit = missing[1:]
+		SendGetData(payload.AddrYou, "block", missing[0])
+	}
 }
 
 func HandleVersion(request []byte ,chain *blockchain.BlockChain){
-	var buff bytes.Buffer
 	var payload Version
 
-	buff.Write(request[commandLen:])
-	decoder := gob.NewDecoder(&buff)
-	err := decoder.Decode(&payload)
-	handleErr(err)
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
 	bestHeight := chain.GetBestHeight()
 	otherHeight := payload.BestHeight
 
@@ -329,24 +569,36 @@ func NodeIsKnown(addr string) bool{
 }
 
 func HandleTx(request []byte, chain *blockchain.BlockChain){
-	var buff bytes.Buffer
 	var payload TX
 
-	buff.Write(request[commandLen:])
-	decoder := gob.NewDecoder(&buff)
-	err := decoder.Decode(&payload)
-	handleErr(err)
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
 
 	txData := payload.Transaction
-	tx := blockchain.DeserializeTrx(txData)
+	tx, err := blockchain.ParseTrx(txData)
+	if err != nil{
+		fmt.Println("Invalid tx:", err)
+		return
+	}
+	if err := tx.CheckSanity(); err != nil{
+		fmt.Println("Rejected tx:", err)
+		return
+	}
+	if err := tx.CheckID(); err != nil{
+		fmt.Println("Rejected tx:", err)
+		return
+	}
+	if err := chain.CheckTxLocks(&tx, chain.GetBestHeight()+1, time.Now().Unix()); err != nil{
+		fmt.Println("Rejected tx:", err)
+		return
+	}
 	memPool[hex.EncodeToString(tx.ID)] =  tx
+	chain.AddPendingTx(&tx)
 	
 	if nodeAddr == KnownNodes[0]{
-		for _, node := range KnownNodes{
-			if node != nodeAddr && node != payload.AddrYou{
-				SendInventory(node, "tx", [][]byte{tx.ID})
-			}
-		}
+		announceTx(&tx, payload.AddrYou)
 	}else{
 		if len(memPool) >= 2 && len(minerAddr) > 0{
 			MineTx(chain)
@@ -354,10 +606,24 @@ func HandleTx(request []byte, chain *blockchain.BlockChain){
 	}
 }
 
+// announceTx sends an inv of tx to every known node but the one it came from,
+// skipping peers whose Bloom filter it does not match
+func announceTx(tx *blockchain.Transaction, from string){
+	for _, node := range KnownNodes{
+		if node != nodeAddr && node != from && peerWantsTx(node, tx){
+			SendInventory(node, "tx", [][]byte{tx.ID})
+		}
+	}
+}
+
 func MineTx(chain *blockchain.BlockChain){
 	var txs []*blockchain.Transaction
+	nextHeight := chain.GetBestHeight() + 1
 	for id := range memPool{
 		tx := memPool[id]
+		if chain.CheckTxLocks(&tx, nextHeight, time.Now().Unix()) != nil{
+			continue
+		}
 		if chain.VerifyTx(&tx){
 			txs = append(txs, &tx)
 		}
@@ -370,7 +636,7 @@ func MineTx(chain *blockchain.BlockChain){
 	txs = append(txs, coinbaseTx)
 
 	newBlock := chain.MineBlock(txs)
-	UTXOSet := blockchain.UTXOset{chain}
+	UTXOSet := blockchain.UTXOset{Blockchain: chain}
 	UTXOSet.Reindex()
 
 	fmt.Println("New Block mined")
@@ -392,13 +658,12 @@ func MineTx(chain *blockchain.BlockChain){
 }
 
 func HandleInventory(request []byte, chain *blockchain.BlockChain){
-	var buff bytes.Buffer
 	var payload Inventory
 
-	buff.Write(request[commandLen:])
-	decoder := gob.NewDecoder(&buff)
-	err := decoder.Decode(&payload)
-	handleErr(err)
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
 
 	if payload.Type == "block"{
 		blocksInTransit = payload.Items
@@ -0,0 +1,423 @@
+package network
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+
+	"github.com/vrecan/death/v3"
+	"main.go/blockchain"
+	"main.go/wallet"
+)
+
+// An SPV node keeps only block headers. It syncs them from KnownNodes[0], checks that they
+// link up and carry valid proofs of work, then matches the wallet against each block's
+// compact filter and downloads only the blocks that match, so peers do not learn its addresses.
+// In Bloom mode it instead loads a Bloom filter of its wallet into the peer and asks for
+// filtered blocks, which costs less bandwidth but tells the peer roughly what it watches
+
+var spvBloom bool
+
+func CloseHeaderDB(hc *blockchain.HeaderChain){
+	close := death.NewDeath(syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+
+	close.WaitForDeathWithFunc(func (){
+		defer os.Exit(1)
+		defer runtime.Goexit()
+		hc.Database.Close()
+	})
+}
+
+func HandleSPVConn(conn net.Conn, hc *blockchain.HeaderChain, nodeID string){
+	req, err := ioutil.ReadAll(conn)
+	defer conn.Close()
+
+	handleErr(err)
+	if len(req) < commandLen{
+		fmt.Println("Invalid command")
+		return
+	}
+	command := BytesToCmd(req[:commandLen])
+	fmt.Printf("Received %s command \n", command)
+	switch command{
+	case "headers":
+		HandleSPVHeaders(req, hc, nodeID)
+	case "merkleblock":
+		HandleSPVMerkleBlock(req, hc, nodeID)
+	case "cfheaders":
+		HandleSPVCFHeaders(req, hc)
+	case "cfilter":
+		HandleSPVCFilter(req, hc, nodeID)
+	case "block":
+		HandleSPVBlock(req, hc, nodeID)
+	case "inv":
+		HandleSPVInventory(req, hc)
+	case "tx":
+		HandleSPVTx(req, nodeID)
+	case "version", "getblocks", "getdata", "getheaders":
+		// Nothing to serve without blocks
+	default:
+		fmt.Println("Invalid command")
+	}
+}
+
+func SendSPVVersion(addr string, hc *blockchain.HeaderChain){
+	data := Version{nVersion, hc.BestHeight(), nodeAddr}
+	request := encodePayload("version", &data)
+	SendData(addr, request)
+}
+
+// HandleSPVHeaders stores the headers it is sent and, once the peer has no more,
+// asks it for the filters of the blocks the wallet has not been matched against yet
+func HandleSPVHeaders(request []byte, hc *blockchain.HeaderChain, nodeID string){
+	var payload Headers
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	var headers []*blockchain.BlockHeader
+	for _, data := range payload.Headers{
+		header, err := blockchain.DeserializeHeader(data)
+		if err != nil{
+			fmt.Println("Invalid header from", payload.AddrYou)
+			return
+		}
+		headers = append(headers, header)
+	}
+	firstNew, err := hc.AddHeaders(headers)
+	if err != nil{
+		fmt.Printf("Rejected headers from %s: %s\n", payload.AddrYou, err)
+		return
+	}
+	fmt.Printf("Received %d headers, best height %d\n", len(headers), hc.BestHeight())
+	if len(headers) == blockchain.MaxHeadersPerMessage{
+		SendGetHeaders(payload.AddrYou, hc.LastHash)
+		return
+	}
+	if spvBloom{
+		RequestFilteredBlocks(payload.AddrYou, hc, firstNew)
+	}else{
+		RequestFilters(payload.AddrYou, hc, firstNew)
+	}
+}
+
+// scanStart returns the hash of the block the next wallet scan starts after: the last
+// one scanned, or the parent of firstNew if headers from there on changed. It returns
+// false when every block has been scanned
+func scanStart(hc *blockchain.HeaderChain, firstNew int) ([]byte, bool){
+	height := hc.ProofHeight() + 1
+	if firstNew >= 0 && firstNew < height{
+		height = firstNew
+	}
+	if height > hc.BestHeight(){
+		return nil, false
+	}
+	if height == 0{
+		return nil, true
+	}
+	hash, err := hc.HashAtHeight(height - 1)
+	handleErr(err)
+	return hash, true
+}
+
+// RequestFilters asks addr for the filter headers of the blocks not scanned yet.
+// The proof height moves as their filters and blocks are checked
+func RequestFilters(addr string, hc *blockchain.HeaderChain, firstNew int){
+	since, ok := scanStart(hc, firstNew)
+	if !ok{
+		return
+	}
+	SendGetCFHeaders(addr, since)
+}
+
+// RequestFilteredBlocks asks addr for the blocks not scanned yet, filtered by the Bloom filter
+// loaded at start
+func RequestFilteredBlocks(addr string, hc *blockchain.HeaderChain, firstNew int){
+	since, ok := scanStart(hc, firstNew)
+	if !ok{
+		return
+	}
+	for{
+		hashes := hc.BlocksAfter(since, blockchain.MaxHeadersPerMessage)
+		if len(hashes) == 0{
+			break
+		}
+		for _, hash := range hashes{
+			SendGetData(addr, "filteredblock", hash)
+		}
+		since = hashes[len(hashes)-1]
+	}
+}
+
+// walletBloomFilter holds the wallet's pubkey hashes and the outpoints of its proven outputs.
+// The peer adds the outpoints of new matching outputs itself
+func walletBloomFilter(hc *blockchain.HeaderChain, nodeID string) *blockchain.BloomFilter{
+	items := hc.WalletItems(walletHashes(nodeID))
+	bf := blockchain.NewBloomFilter(len(items), 0.0001, rand.Uint32(), blockchain.BloomUpdateAll)
+	for _, item := range items{
+		bf.Add(item)
+	}
+	return bf
+}
+
+// HandleSPVCFHeaders extends the filter header chain and asks for the filters it covers
+func HandleSPVCFHeaders(request []byte, hc *blockchain.HeaderChain){
+	var payload CFHeaders
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	blockHashes, err := hc.AddFilterHashes(payload.Since, payload.PrevHeader, payload.FilterHashes)
+	if err != nil{
+		fmt.Printf("Rejected filter headers from %s: %s\n", payload.AddrYou, err)
+		return
+	}
+	if len(blockHashes) == 0{
+		return
+	}
+	SendGetCFilters(payload.AddrYou, blockHashes)
+	if len(payload.FilterHashes) == blockchain.MaxHeadersPerMessage{
+		SendGetCFHeaders(payload.AddrYou, blockHashes[len(blockHashes)-1])
+	}
+}
+
+// HandleSPVCFilter checks a filter against its filter header and asks for the block
+// when the wallet may have transactions in it
+func HandleSPVCFilter(request []byte, hc *blockchain.HeaderChain, nodeID string){
+	var payload CFilter
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	if err := hc.CheckFilter(payload.BlockHash, payload.Filter); err != nil{
+		fmt.Printf("Rejected filter from %s: %s\n", payload.AddrYou, err)
+		return
+	}
+	filter, err := blockchain.DeserializeGCSFilter(blockchain.FilterKey(payload.BlockHash), payload.Filter)
+	if err != nil{
+		fmt.Println("Invalid filter:", err)
+		return
+	}
+	match, err := filter.MatchAny(hc.WalletItems(walletHashes(nodeID)))
+	handleErr(err)
+	if match{
+		SendGetData(payload.AddrYou, "block", payload.BlockHash)
+		return
+	}
+	hc.MarkScanned(payload.BlockHash)
+}
+
+// HandleSPVBlock keeps merkle proofs of the wallet's transactions in a block whose filter
+// matched. When it proves new outputs, the filters after the block are matched again
+// so spends of those outputs are found
+func HandleSPVBlock(request []byte, hc *blockchain.HeaderChain, nodeID string){
+	var payload Block
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	block, err := blockchain.ParseBlock(payload.Block)
+	if err != nil{
+		fmt.Println("Invalid block:", err)
+		return
+	}
+	if !block.CheckMerkleRoot(){
+		fmt.Println("Invalid block: transactions do not match the merkle root")
+		return
+	}
+	// the hash the block claims is not trusted, the one of its header is checked
+	hash := block.BlockHeader.Hash()
+	var ids [][]byte
+	newOutputs := false
+	for _, i := range walletTxs(hc, nodeID, block.Transactions){
+		tx := block.Transactions[i]
+		ids = append(ids, tx.ID)
+		if !hc.HasProof(tx.ID){
+			newOutputs = true
+		}
+	}
+	if len(ids) == 0{
+		hc.MarkScanned(hash)
+		return
+	}
+	mb, err := blockchain.NewMerkleBlock(block, ids)
+	if err == nil{
+		err = hc.AddProof(mb)
+	}
+	if err != nil{
+		fmt.Println("Invalid block:", err)
+		return
+	}
+	hc.MarkScanned(hash)
+	printProofs(hc, mb)
+	printSPVBalances(hc, nodeID)
+	if newOutputs{
+		if rest := hc.BlocksAfter(hash, blockchain.MaxHeadersPerMessage); len(rest) > 0{
+			SendGetCFilters(payload.AddrYou, rest)
+		}
+	}
+}
+
+// walletTxs returns the positions of the transactions that pay to or spend from the wallet,
+// or spend an output the wallet proved. Filters also let through false positives
+func walletTxs(hc *blockchain.HeaderChain, nodeID string, txs []*blockchain.Transaction) []int{
+	hashes := walletHashes(nodeID)
+	spendable := make(map[string]bool)
+	for _, item := range hc.WalletItems(hashes)[len(hashes):]{
+		spendable[string(item)] = true
+	}
+	var relevant []int
+	for i, tx := range txs{
+		match := tx.Touches(hashes)
+		for _, in := range tx.Vin{
+			match = match || spendable[string(blockchain.OutpointItem(in.TXID, in.Vout))]
+		}
+		if match{
+			relevant = append(relevant, i)
+		}
+	}
+	return relevant
+}
+
+func printProofs(hc *blockchain.HeaderChain, mb *blockchain.MerkleBlock){
+	confirmations := hc.Confirmations(mb.Header.Hash())
+	for _, tx := range mb.Txs{
+		fmt.Printf("Proved transaction %x at height %d, %d confirmations\n", tx.ID, mb.Height, confirmations)
+	}
+}
+
+func walletHashes(nodeID string) [][]byte{
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil{
+		return nil
+	}
+	var hashes [][]byte
+	for _, address := range wallets.GetAllAddress(){
+		hashes = append(hashes, wallet.AddressHash(address))
+	}
+	return hashes
+}
+
+func HandleSPVMerkleBlock(request []byte, hc *blockchain.HeaderChain, nodeID string){
+	var payload MerkleBlock
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	mb, err := blockchain.DeserializeMerkleBlock(payload.MerkleBlock)
+	if err == nil{
+		err = mb.Verify()
+	}
+	if err != nil{
+		fmt.Println("Invalid merkle block:", err)
+		return
+	}
+	var txs []*blockchain.Transaction
+	for i := range mb.Txs{
+		txs = append(txs, &mb.Txs[i])
+	}
+	wanted := blockchain.MerkleBlock{Header: mb.Header, Height: mb.Height}
+	for _, i := range walletTxs(hc, nodeID, txs){
+		wanted.Txs = append(wanted.Txs, mb.Txs[i])
+		wanted.Proofs = append(wanted.Proofs, mb.Proofs[i])
+	}
+	mb = &wanted
+	if err := hc.AddProof(mb); err != nil{
+		fmt.Println("Invalid merkle block:", err)
+		return
+	}
+	hc.MarkScanned(mb.Header.Hash())
+	if len(mb.Txs) > 0{
+		printProofs(hc, mb)
+		printSPVBalances(hc, nodeID)
+	}
+}
+
+// HandleSPVTx reports an unconfirmed transaction relayed through the Bloom filter
+func HandleSPVTx(request []byte, nodeID string){
+	var payload TX
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	tx, err := blockchain.ParseTrx(payload.Transaction)
+	if err != nil{
+		fmt.Println("Invalid tx:", err)
+		return
+	}
+	if tx.Touches(walletHashes(nodeID)){
+		fmt.Printf("Unconfirmed transaction %x touches the wallet\n", tx.ID)
+	}
+}
+
+func printSPVBalances(hc *blockchain.HeaderChain, nodeID string){
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil{
+		return
+	}
+	for _, address := range wallets.GetAllAddress(){
+		balance := 0
+		for _, out := range hc.UnspentOutputs(wallet.AddressHash(address)){
+			balance += out.Output.Value
+		}
+		fmt.Printf("Confirmed balance of %s: %d\n", address, balance)
+	}
+}
+
+func HandleSPVInventory(request []byte, hc *blockchain.HeaderChain){
+	var payload Inventory
+
+	if err := decodePayload(request, &payload); err != nil{
+		fmt.Println("Invalid payload:", err)
+		return
+	}
+	if payload.Type == "block"{
+		SendGetHeaders(payload.AddrYou, hc.LastHash)
+	}
+	if payload.Type == "tx"{
+		for _, id := range payload.Items{
+			SendGetData(payload.AddrYou, "tx", id)
+		}
+	}
+}
+
+// StartSPV runs a header only node. A rescan height of 0 or more matches the wallet
+// against every block from that height on again. With bloom, blocks are scanned through
+// a Bloom filter loaded into the peer instead of compact filters
+func StartSPV(nodeID string, rescan int, bloom bool){
+	nodeAddr = fmt.Sprintf("localhost:%s", nodeID)
+	ln, err := net.Listen(protocol, nodeAddr)
+	handleErr(err)
+	defer ln.Close()
+
+	hc := blockchain.OpenHeaderChain(nodeID)
+	defer hc.Database.Close()
+	go CloseHeaderDB(hc)
+	if rescan >= 0 && rescan <= hc.ProofHeight(){
+		hc.SetProofHeight(rescan - 1)
+	}
+
+	spvBloom = bloom
+	if bloom{
+		// Loaded first so the peer has it before any filtered block is asked for
+		SendFilterLoad(KnownNodes[0], walletBloomFilter(hc, nodeID))
+	}
+	// The version makes the peer announce new blocks and transactions to this node
+	SendSPVVersion(KnownNodes[0], hc)
+	SendGetHeaders(KnownNodes[0], hc.LastHash)
+	for{
+		conn, err := ln.Accept()
+		handleErr(err)
+		go HandleSPVConn(conn, hc, nodeID)
+	}
+}
@@ -0,0 +1,288 @@
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const unlockFile = "./tmp/wallets_%s.unlock"
+
+// scrypt cost of new encrypted wallets, about 100ms on a laptop
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// checkValue is sealed with the wallet key so a wrong passphrase is told apart
+// from a damaged key
+var checkValue = []byte("wallet passphrase check")
+
+var (
+	ErrWalletLocked    = errors.New("wallet is locked, unlock it with walletpassphrase")
+	ErrWrongPassphrase = errors.New("wrong wallet passphrase")
+)
+
+// WalletCrypt holds how the key encrypting the private keys of a wallet file is
+// derived from its passphrase: scrypt with Salt, N, R and P. Check is checkValue
+// sealed with that key
+type WalletCrypt struct {
+	Salt  []byte
+	N     int
+	R     int
+	P     int
+	Check []byte
+}
+
+func (c *WalletCrypt) deriveKey(passphrase string) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), c.Salt, c.N, c.R, c.P, 32)
+}
+
+// seal encrypts plaintext with AES-256-GCM under key, returning nonce || ciphertext.
+// additional is authenticated but not encrypted
+func seal(key, plaintext, additional []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(key, sealed, additional []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed data too short")
+	}
+	nonce := sealed[:aead.NonceSize()]
+	return aead.Open(nil, nonce, sealed[aead.NonceSize():], additional)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Locked reports whether the private key of the wallet is only held encrypted
+func (wallet *Wallet) Locked() bool {
+	return wallet.PrivKey.D == nil
+}
+
+// encryptKey seals the private key of wallet, bound to its public key
+func (wallet *Wallet) encryptKey(key []byte) error {
+	sealed, err := seal(key, wallet.PrivKey.D.Bytes(), wallet.PubKey)
+	if err != nil {
+		return err
+	}
+	wallet.EncryptedKey = sealed
+	return nil
+}
+
+func (wallet *Wallet) decryptKey(key []byte) error {
+	d, err := open(key, wallet.EncryptedKey, wallet.PubKey)
+	if err != nil {
+		return err
+	}
+	curve := elliptic.P256()
+	wallet.PrivKey.Curve = curve
+	wallet.PrivKey.D = new(big.Int).SetBytes(d)
+	wallet.PrivKey.PublicKey.X, wallet.PrivKey.PublicKey.Y = curve.ScalarBaseMult(d)
+	return nil
+}
+
+func (hd *HDChain) encryptSeed(key []byte) error {
+	sealed, err := seal(key, hd.Seed, []byte(hd.AccountXpub))
+	if err != nil {
+		return err
+	}
+	hd.EncryptedSeed = sealed
+	return nil
+}
+
+func (wf *WalletsFile) IsEncrypted() bool {
+	return wf.Crypt != nil
+}
+
+// IsLocked reports whether the wallet file is encrypted and its keys are not decrypted
+func (wf *WalletsFile) IsLocked() bool {
+	return wf.Crypt != nil && wf.key == nil
+}
+
+// Encrypt encrypts every private key with a key derived from passphrase. The keys stay
+// usable until the file is loaded again
+func (wf *WalletsFile) Encrypt(passphrase string) error {
+	if wf.IsEncrypted() {
+		return errors.New("wallet is already encrypted")
+	}
+	crypt := &WalletCrypt{Salt: make([]byte, 16), N: scryptN, R: scryptR, P: scryptP}
+	if _, err := rand.Read(crypt.Salt); err != nil {
+		return err
+	}
+	key, err := crypt.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+	if crypt.Check, err = seal(key, checkValue, nil); err != nil {
+		return err
+	}
+	for _, w := range wf.Wallets {
+		if err := w.encryptKey(key); err != nil {
+			return err
+		}
+	}
+	if wf.HD != nil {
+		if err := wf.HD.encryptSeed(key); err != nil {
+			return err
+		}
+	}
+	wf.Crypt = crypt
+	wf.key = key
+	return nil
+}
+
+// Unlock decrypts the private keys with the key derived from passphrase
+func (wf *WalletsFile) Unlock(passphrase string) error {
+	if !wf.IsEncrypted() {
+		return errors.New("wallet is not encrypted")
+	}
+	key, err := wf.Crypt.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+	return wf.unlockWithKey(key)
+}
+
+func (wf *WalletsFile) unlockWithKey(key []byte) error {
+	if check, err := open(key, wf.Crypt.Check, nil); err != nil || string(check) != string(checkValue) {
+		return ErrWrongPassphrase
+	}
+	for address, w := range wf.Wallets {
+		if err := w.decryptKey(key); err != nil {
+			return fmt.Errorf("cannot decrypt the key of %s: %s", address, err)
+		}
+	}
+	if wf.HD != nil && len(wf.HD.EncryptedSeed) > 0 {
+		seed, err := open(key, wf.HD.EncryptedSeed, []byte(wf.HD.AccountXpub))
+		if err != nil {
+			return fmt.Errorf("cannot decrypt the seed: %s", err)
+		}
+		wf.HD.Seed = seed
+	}
+	wf.key = key
+	return nil
+}
+
+// SaveUnlock lets later commands use the decrypted keys for timeout, by writing the
+// wallet key next to the wallet file, readable only by its owner. The key is stored in
+// plaintext and nothing deletes it when the timeout ends: it stays on disk until
+// RemoveUnlock, RemoveExpiredUnlocks or the next load of the wallet file after the timeout
+func (wf *WalletsFile) SaveUnlock(nodeId string, timeout time.Duration) error {
+	if wf.key == nil {
+		return ErrWalletLocked
+	}
+	var expiry [8]byte
+	binary.BigEndian.PutUint64(expiry[:], uint64(time.Now().Add(timeout).Unix()))
+	path := fmt.Sprintf(unlockFile, nodeId)
+	if err := ioutil.WriteFile(path, append(expiry[:], wf.key...), 0600); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0600)
+}
+
+// RemoveUnlock locks the wallet file of nodeId again, see SaveUnlock. The key is
+// overwritten before the file is deleted
+func RemoveUnlock(nodeId string) error {
+	return removeUnlockFile(fmt.Sprintf(unlockFile, nodeId))
+}
+
+func removeUnlockFile(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, make([]byte, info.Size()), 0600); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// RemoveExpiredUnlocks removes the unlock files of every node that are expired or damaged.
+// No process stays behind to delete an unlock file when its timeout ends, so the CLI
+// calls this on every start
+func RemoveExpiredUnlocks() error {
+	paths, err := filepath.Glob(fmt.Sprintf(unlockFile, "*"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err == nil && !unlockExpired(content) {
+			continue
+		}
+		if err := removeUnlockFile(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unlockExpired reports whether the content of an unlock file is damaged or past its timeout
+func unlockExpired(content []byte) bool {
+	return len(content) != 8+32 || time.Now().Unix() >= int64(binary.BigEndian.Uint64(content[:8]))
+}
+
+// loadUnlock decrypts the keys with the key saved by SaveUnlock. An expired, damaged
+// or stale unlock file is removed, so the key does not stay on disk
+func (wf *WalletsFile) loadUnlock(nodeId string) {
+	content, err := ioutil.ReadFile(fmt.Sprintf(unlockFile, nodeId))
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil || unlockExpired(content) {
+		HandleErr(RemoveUnlock(nodeId))
+		return
+	}
+	if err := wf.unlockWithKey(content[8:]); err != nil {
+		// the passphrase changed since the file was written
+		wf.Lock()
+		HandleErr(RemoveUnlock(nodeId))
+	}
+}
+
+// Lock forgets the decrypted private keys
+func (wf *WalletsFile) Lock() {
+	if !wf.IsEncrypted() {
+		return
+	}
+	for _, w := range wf.Wallets {
+		w.PrivKey.D = nil
+	}
+	if wf.HD != nil {
+		wf.HD.Seed = nil
+	}
+	wf.key = nil
+}
@@ -0,0 +1,88 @@
+package wallet
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUnlockFile(t *testing.T) {
+	inTempDir(t)
+	nodeId := "test"
+	// a missing wallet file comes back empty
+	wf, _ := CreateWallets(nodeId)
+	address := wf.AddWallet()
+	if err := wf.Encrypt("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	wf.SaveFile(nodeId)
+	path := fmt.Sprintf(unlockFile, nodeId)
+
+	if err := wf.SaveUnlock(nodeId, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	unlocked, err := CreateWallets(nodeId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unlocked.IsLocked() || unlocked.Wallets[address].Locked() {
+		t.Error("wallet locked while the unlock file is valid")
+	}
+
+	if err := wf.SaveUnlock(nodeId, -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	expired, err := CreateWallets(nodeId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expired.IsLocked() {
+		t.Error("wallet unlocked by an expired unlock file")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expired unlock file not removed: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("damaged"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateWallets(nodeId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("damaged unlock file not removed: %v", err)
+	}
+}
+
+// Expired and damaged unlock files are removed whichever node they belong to,
+// a valid one is kept
+func TestRemoveExpiredUnlocks(t *testing.T) {
+	inTempDir(t)
+	wf, _ := CreateWallets("valid")
+	wf.AddWallet()
+	if err := wf.Encrypt("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if err := wf.SaveUnlock("valid", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := wf.SaveUnlock("expired", -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fmt.Sprintf(unlockFile, "damaged"), []byte("damaged"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RemoveExpiredUnlocks(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fmt.Sprintf(unlockFile, "valid")); err != nil {
+		t.Errorf("valid unlock file removed: %v", err)
+	}
+	for _, nodeId := range []string{"expired", "damaged"} {
+		if _, err := os.Stat(fmt.Sprintf(unlockFile, nodeId)); !os.IsNotExist(err) {
+			t.Errorf("%s unlock file not removed: %v", nodeId, err)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// HardenedKey is the first hardened child index, written i' in paths
+const HardenedKey = uint32(0x80000000)
+
+// Version bytes of serialized extended keys, as BIP32's xprv and xpub
+var (
+	xprvVersion = []byte{0x04, 0x88, 0xad, 0xe4}
+	xpubVersion = []byte{0x04, 0x88, 0xb2, 0x1e}
+)
+
+// masterKeyHMAC keys the HMAC deriving the master key from a seed, as SLIP-0010 does for P-256
+var masterKeyHMAC = []byte("Nist256p1 seed")
+
+var ErrInvalidExtendedKey = errors.New("invalid extended key")
+
+// ExtendedKey is a BIP32 style key on P-256, derived as SLIP-0010 specifies.
+// Key is the private scalar of a private key, or the compressed point of a public key
+type ExtendedKey struct {
+	Key         []byte
+	ChainCode   []byte
+	Depth       byte
+	Fingerprint []byte
+	ChildNumber uint32
+	Private     bool
+}
+
+// NewMasterKey derives the master key of a seed
+func NewMasterKey(seed []byte) *ExtendedKey {
+	n := elliptic.P256().Params().N
+	mac := hmac.New(sha512.New, masterKeyHMAC)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	for {
+		k := new(big.Int).SetBytes(sum[:32])
+		if k.Sign() != 0 && k.Cmp(n) < 0 {
+			break
+		}
+		mac = hmac.New(sha512.New, masterKeyHMAC)
+		mac.Write(sum)
+		sum = mac.Sum(nil)
+	}
+	return &ExtendedKey{
+		Key:         sum[:32],
+		ChainCode:   sum[32:],
+		Fingerprint: make([]byte, 4),
+		Private:     true,
+	}
+}
+
+// PublicKey returns the compressed point of the key
+func (k *ExtendedKey) PublicKey() []byte {
+	if !k.Private {
+		return k.Key
+	}
+	curve := elliptic.P256()
+	x, y := curve.ScalarBaseMult(k.Key)
+	return elliptic.MarshalCompressed(curve, x, y)
+}
+
+// Neuter returns the public key of a private extended key
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	return &ExtendedKey{
+		Key:         k.PublicKey(),
+		ChainCode:   k.ChainCode,
+		Depth:       k.Depth,
+		Fingerprint: k.Fingerprint,
+		ChildNumber: k.ChildNumber,
+	}
+}
+
+// Child derives child index of the key. Public keys have only normal children
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if !k.Private && index >= HardenedKey {
+		return nil, errors.New("hardened child of a public key")
+	}
+	curve := elliptic.P256()
+	n := curve.Params().N
+	var index32 [4]byte
+	binary.BigEndian.PutUint32(index32[:], index)
+
+	var data []byte
+	if index >= HardenedKey {
+		data = append([]byte{0}, pad32(k.Key)...)
+	} else {
+		data = k.PublicKey()
+	}
+	data = append(data, index32[:]...)
+	child := &ExtendedKey{
+		Depth:       k.Depth + 1,
+		Fingerprint: PubKeyHash(k.PublicKey())[:4],
+		ChildNumber: index,
+		Private:     k.Private,
+	}
+	for {
+		mac := hmac.New(sha512.New, k.ChainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		il := new(big.Int).SetBytes(sum[:32])
+		child.ChainCode = sum[32:]
+		// an out of range result derives again from 0x01 || IR || index
+		data = append(append([]byte{1}, sum[32:]...), index32[:]...)
+		if il.Cmp(n) >= 0 {
+			continue
+		}
+		if k.Private {
+			key := new(big.Int).Add(il, new(big.Int).SetBytes(k.Key))
+			key.Mod(key, n)
+			if key.Sign() == 0 {
+				continue
+			}
+			child.Key = pad32(key.Bytes())
+			return child, nil
+		}
+		px, py := elliptic.UnmarshalCompressed(curve, k.Key)
+		if px == nil {
+			return nil, ErrInvalidExtendedKey
+		}
+		ix, iy := curve.ScalarBaseMult(sum[:32])
+		x, y := curve.Add(ix, iy, px, py)
+		if x.Sign() == 0 && y.Sign() == 0 {
+			continue
+		}
+		child.Key = elliptic.MarshalCompressed(curve, x, y)
+		return child, nil
+	}
+}
+
+// Derive follows a path such as m/44'/1'/0'/0/5 from a master key
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	key := k
+	for _, index := range indexes {
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// ParsePath reads the child indexes of a path starting at m
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("path %s does not start at m", path)
+	}
+	var indexes []uint32
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'")
+		index, err := strconv.ParseUint(strings.TrimSuffix(part, "'"), 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %s", path)
+		}
+		if hardened {
+			index += uint64(HardenedKey)
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
+
+// Wallet returns the wallet of a private extended key
+func (k *ExtendedKey) Wallet() *Wallet {
+	curve := elliptic.P256()
+	privKey := ecdsa.PrivateKey{D: new(big.Int).SetBytes(k.Key)}
+	privKey.PublicKey.Curve = curve
+	privKey.PublicKey.X, privKey.PublicKey.Y = curve.ScalarBaseMult(k.Key)
+	pubKey := append(privKey.X.Bytes(), privKey.Y.Bytes()...)
+	return &Wallet{PrivKey: privKey, PubKey: pubKey}
+}
+
+// WalletPubKey returns the public key of the extended key as wallets hold it:
+// the X and Y coordinates
+func (k *ExtendedKey) WalletPubKey() []byte {
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), k.PublicKey())
+	return append(x.Bytes(), y.Bytes()...)
+}
+
+// String serializes the key as BIP32 does: version, depth, parent fingerprint, child
+// number, chain code and key data, base58 encoded with a 4 byte checksum
+func (k *ExtendedKey) String() string {
+	version, key := xpubVersion, k.Key
+	if k.Private {
+		version, key = xprvVersion, append([]byte{0}, pad32(k.Key)...)
+	}
+	var child [4]byte
+	binary.BigEndian.PutUint32(child[:], k.ChildNumber)
+	data := append(append([]byte{}, version...), k.Depth)
+	data = append(append(data, k.Fingerprint...), child[:]...)
+	data = append(append(data, k.ChainCode...), key...)
+	return string(Base58Encode(append(data, CheckSum(data)...)))
+}
+
+// ParseExtendedKey reads a key serialized by String
+func ParseExtendedKey(s string) (*ExtendedKey, error) {
+	data := Base58Decode([]byte(s))
+	if len(data) != 78+CheckSumLength {
+		return nil, ErrInvalidExtendedKey
+	}
+	payload := data[:78]
+	if !bytes.Equal(CheckSum(payload), data[78:]) {
+		return nil, ErrInvalidExtendedKey
+	}
+	k := &ExtendedKey{
+		Depth:       payload[4],
+		Fingerprint: payload[5:9],
+		ChildNumber: binary.BigEndian.Uint32(payload[9:13]),
+		ChainCode:   payload[13:45],
+	}
+	curve := elliptic.P256()
+	switch {
+	case bytes.Equal(payload[:4], xprvVersion) && payload[45] == 0:
+		k.Private = true
+		k.Key = payload[46:]
+		d := new(big.Int).SetBytes(k.Key)
+		if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+			return nil, ErrInvalidExtendedKey
+		}
+	case bytes.Equal(payload[:4], xpubVersion):
+		k.Key = payload[45:]
+		if x, _ := elliptic.UnmarshalCompressed(curve, k.Key); x == nil {
+			return nil, ErrInvalidExtendedKey
+		}
+	default:
+		return nil, ErrInvalidExtendedKey
+	}
+	return k, nil
+}
+
+func pad32(b []byte) []byte {
+	if len(b) >= 32 {
+		return b
+	}
+	return append(make([]byte, 32-len(b)), b...)
+}
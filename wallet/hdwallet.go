@@ -0,0 +1,145 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+)
+
+// HDAccountPath is the account HD wallet files derive their keys from. Receive keys
+// are at HDAccountPath/0/i, change keys at HDAccountPath/1/i
+const HDAccountPath = "m/44'/1'/0'"
+
+// Branches of the account
+const (
+	ReceiveBranch = uint32(0)
+	ChangeBranch  = uint32(1)
+)
+
+// GapLimit is how many unused keys in a row end the discovery of a branch
+const GapLimit = 20
+
+// HDChain is the seed the keys of an HD wallet file are derived from
+type HDChain struct {
+	// Seed is empty in the file once it is encrypted, see Encrypt
+	Seed          []byte
+	EncryptedSeed []byte
+	// AccountXpub is the extended public key of HDAccountPath
+	AccountXpub string
+	// Next holds the next index of the receive and change branches
+	Next [2]uint32
+}
+
+// SetSeed makes the wallet file an HD wallet file. The keys it already holds stay
+func (wf *WalletsFile) SetSeed(seed []byte) error {
+	if wf.HD != nil {
+		return errors.New("wallet already has a seed")
+	}
+	account, err := NewMasterKey(seed).Derive(HDAccountPath)
+	if err != nil {
+		return err
+	}
+	wf.HD = &HDChain{Seed: seed, AccountXpub: account.Neuter().String()}
+	return nil
+}
+
+func (wf *WalletsFile) hdKey(branch, index uint32) (*ExtendedKey, string, error) {
+	if len(wf.HD.Seed) == 0 {
+		return nil, "", ErrWalletLocked
+	}
+	path := fmt.Sprintf("%s/%d/%d", HDAccountPath, branch, index)
+	key, err := NewMasterKey(wf.HD.Seed).Derive(path)
+	return key, path, err
+}
+
+func (wf *WalletsFile) addHDKey(branch, index uint32) (string, error) {
+	key, path, err := wf.hdKey(branch, index)
+	if err != nil {
+		return "", err
+	}
+	w := key.Wallet()
+	w.Path = path
+	address := string(w.Address())
+	wf.Wallets[address] = w
+	wf.addMeta(address, branchPurpose(branch))
+	return address, nil
+}
+
+func branchPurpose(branch uint32) string {
+	if branch == ChangeBranch {
+		return PurposeChange
+	}
+	return PurposeReceive
+}
+
+// NextHDAddress derives the next key of branch and adds it to the wallet file
+func (wf *WalletsFile) NextHDAddress(branch uint32) (string, error) {
+	if wf.HD == nil {
+		return "", errors.New("wallet has no seed")
+	}
+	address, err := wf.addHDKey(branch, wf.HD.Next[branch])
+	if err != nil {
+		return "", err
+	}
+	wf.HD.Next[branch]++
+	return address, nil
+}
+
+// LookAheadHD looks for address among the next GapLimit keys of both branches, such as a
+// change key derived by a node watching the account, and adds the keys of its branch up to it.
+// It reports whether address was found
+func (wf *WalletsFile) LookAheadHD(address string) (bool, error) {
+	if wf.HD == nil {
+		return false, errors.New("wallet has no seed")
+	}
+	for _, branch := range []uint32{ReceiveBranch, ChangeBranch} {
+		next := wf.HD.Next[branch]
+		for index := next; index < next+GapLimit; index++ {
+			key, _, err := wf.hdKey(branch, index)
+			if err != nil {
+				return false, err
+			}
+			if string(key.Wallet().Address()) != address {
+				continue
+			}
+			for ; wf.HD.Next[branch] <= index; wf.HD.Next[branch]++ {
+				if _, err := wf.addHDKey(branch, wf.HD.Next[branch]); err != nil {
+					return false, err
+				}
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DiscoverHD adds the keys of both branches up to the last one used reports as used
+// before GapLimit unused keys in a row, and moves the next indexes after it.
+// It returns how many keys it added
+func (wf *WalletsFile) DiscoverHD(used func(pubKeyHash []byte) bool) (int, error) {
+	if wf.HD == nil {
+		return 0, errors.New("wallet has no seed")
+	}
+	added := 0
+	for _, branch := range []uint32{ReceiveBranch, ChangeBranch} {
+		next := wf.HD.Next[branch]
+		for index, gap := next, 0; gap < GapLimit; index++ {
+			key, _, err := wf.hdKey(branch, index)
+			if err != nil {
+				return added, err
+			}
+			if !used(PubKeyHash(key.Wallet().PubKey)) {
+				gap++
+				continue
+			}
+			for ; next <= index; next++ {
+				if _, err := wf.addHDKey(branch, next); err != nil {
+					return added, err
+				}
+				added++
+			}
+			gap = 0
+		}
+		wf.HD.Next[branch] = next
+	}
+	return added, nil
+}
@@ -0,0 +1,56 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/gob"
+	"errors"
+	"math/big"
+)
+
+// The legacy types freeze the shape of the wallet file before Wallet had its own gob
+// encoding: the whole ecdsa.PrivateKey was stored, its curve included. The curve was
+// registered under a type name newer Go versions no longer have, so the field is left
+// out and gob skips it; every key of those files is on P256. Never change these types
+type legacyPublicKey struct {
+	X, Y *big.Int
+}
+
+type legacyPrivateKey struct {
+	PublicKey legacyPublicKey
+	D         *big.Int
+}
+
+type legacyWallet struct {
+	PrivKey legacyPrivateKey
+	PubKey  []byte
+}
+
+type legacyWalletsFile struct {
+	Wallets map[string]*legacyWallet
+}
+
+// decodeLegacyFile reads a wallet file written in the format of the first versions.
+// Addresses are kept as stored, upgrade drops the newline they may end in
+func decodeLegacyFile(content []byte) (*WalletsFile, error) {
+	var legacy legacyWalletsFile
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&legacy); err != nil {
+		return nil, err
+	}
+	wf := WalletsFile{Wallets: make(map[string]*Wallet)}
+	curve := elliptic.P256()
+	for address, lw := range legacy.Wallets {
+		if lw == nil || lw.PrivKey.D == nil {
+			return nil, errors.New("legacy wallet file holds a key without its scalar")
+		}
+		privKey := ecdsa.PrivateKey{D: lw.PrivKey.D}
+		privKey.PublicKey.Curve = curve
+		privKey.PublicKey.X, privKey.PublicKey.Y = curve.ScalarBaseMult(lw.PrivKey.D.Bytes())
+		if !bytes.Equal(append(privKey.X.Bytes(), privKey.Y.Bytes()...), lw.PubKey) {
+			return nil, errors.New("legacy wallet file holds a key that does not match its public key")
+		}
+		wf.Wallets[address] = &Wallet{PrivKey: privKey, PubKey: lw.PubKey}
+	}
+	return &wf, nil
+}
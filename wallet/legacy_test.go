@@ -0,0 +1,136 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// baselineFixture is a wallet file written by the first version of the program,
+// before Wallet had its own gob encoding
+const baselineFixture = "testdata/wallets_baseline.data"
+
+// inTempDir runs the rest of the test in a fresh working directory with a tmp directory
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "tmp"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// inTempNode copies fixture into the tmp directory of a fresh working directory and
+// returns the node ID that reads it
+func inTempNode(t *testing.T, fixture string) string {
+	t.Helper()
+	content, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inTempDir(t)
+	if err := os.WriteFile(filepath.Join("tmp", "wallets_test.data"), content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return "test"
+}
+
+func TestDecodeLegacyFile(t *testing.T) {
+	content, err := os.ReadFile(baselineFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wf, err := decodeLegacyFile(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wf.Wallets) == 0 {
+		t.Fatal("no keys read")
+	}
+	for address, w := range wf.Wallets {
+		if strings.TrimSuffix(address, "\n") != string(w.Address()) {
+			t.Errorf("key stored under %q has address %s", address, w.Address())
+		}
+	}
+}
+
+func TestLoadBaselineFile(t *testing.T) {
+	nodeId := inTempNode(t, baselineFixture)
+	wf, err := CreateWallets(nodeId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wf.Wallets) == 0 {
+		t.Fatal("no keys read")
+	}
+	hash := MessageHash("baseline")
+	for address, w := range wf.Wallets {
+		if !ValidateAddress(address) {
+			t.Errorf("invalid address %q", address)
+		}
+		if address != string(w.Address()) {
+			t.Errorf("key stored under %s has address %s", address, w.Address())
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, &w.PrivKey, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ecdsa.Verify(&w.PrivKey.PublicKey, hash, r, s) {
+			t.Errorf("key of %s does not sign", address)
+		}
+	}
+}
+
+func TestUpgradeBaselineFile(t *testing.T) {
+	nodeId := inTempNode(t, baselineFixture)
+	wf, err := CreateWallets(nodeId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wf.Version != WalletFileVersion {
+		t.Fatalf("version %d after loading, want %d", wf.Version, WalletFileVersion)
+	}
+	for _, address := range wf.GetAllAddress() {
+		if strings.HasSuffix(address, "\n") {
+			t.Errorf("address %q keeps its newline", address)
+		}
+		if _, ok := wf.Meta[address]; !ok {
+			t.Errorf("%s has no metadata", address)
+		}
+	}
+
+	// the file was saved in the current version, which reads back without the legacy decoder
+	content, err := os.ReadFile(filepath.Join("tmp", "wallets_test.data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeLegacyFile(content); err == nil {
+		t.Error("upgraded file still decodes as the baseline format")
+	}
+	reloaded, err := CreateWallets(nodeId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Version != WalletFileVersion {
+		t.Errorf("version %d after reloading, want %d", reloaded.Version, WalletFileVersion)
+	}
+	if len(reloaded.Wallets) != len(wf.Wallets) {
+		t.Fatalf("%d keys after reloading, want %d", len(reloaded.Wallets), len(wf.Wallets))
+	}
+	for address, w := range wf.Wallets {
+		r, ok := reloaded.Wallets[address]
+		if !ok || r.PrivKey.D.Cmp(w.PrivKey.D) != 0 {
+			t.Errorf("key of %s not reloaded", address)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+// MessageMagic is hashed before every signed message, so a message signature can never
+// pass for the signature of a transaction or of anything else signed with the key
+const MessageMagic = "AfriCoin Signed Message:\n"
+
+// MessageSignatureLength is the length of a message signature: a header byte, then r and s
+// as 32 bytes big endian. The header is 27 plus the recovery ID, whose bit 0 is the parity of
+// the Y coordinate of the point R and bit 1 tells that its X coordinate is r + N
+const MessageSignatureLength = 65
+
+var ErrBadMessageSignature = errors.New("malformed message signature")
+
+func writeVarString(buf *bytes.Buffer, s string) {
+	var size [binary.MaxVarintLen64]byte
+	buf.Write(size[:binary.PutUvarint(size[:], uint64(len(s)))])
+	buf.WriteString(s)
+}
+
+// MessageHash is the double sha256 of MessageMagic and message, each preceded by its
+// length as a uvarint
+func MessageHash(message string) []byte {
+	var buf bytes.Buffer
+	writeVarString(&buf, MessageMagic)
+	writeVarString(&buf, message)
+	first := sha256.Sum256(buf.Bytes())
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// SignMessage signs message with the key of w, in a form RecoverMessageKey rebuilds the
+// public key from
+func SignMessage(w *Wallet, message string) ([]byte, error) {
+	if w.PrivKey.D == nil {
+		return nil, ErrWalletLocked
+	}
+	hash := MessageHash(message)
+	r, s, err := ecdsa.Sign(rand.Reader, &w.PrivKey, hash)
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, MessageSignatureLength)
+	r.FillBytes(sig[1:33])
+	s.FillBytes(sig[33:])
+	for recID := byte(0); recID < 4; recID++ {
+		sig[0] = 27 + recID
+		pubKey, err := RecoverMessageKey(message, sig)
+		if err == nil && bytes.Equal(pubKey, w.PubKey) {
+			return sig, nil
+		}
+	}
+	return nil, errors.New("cannot find the recovery ID of the signature")
+}
+
+// RecoverMessageKey returns the public key that made sig over message, the X and Y
+// coordinates as wallets hold them
+func RecoverMessageKey(message string, sig []byte) ([]byte, error) {
+	if len(sig) != MessageSignatureLength || sig[0] < 27 || sig[0] > 30 {
+		return nil, ErrBadMessageSignature
+	}
+	curve := elliptic.P256()
+	params := curve.Params()
+	recID := sig[0] - 27
+	r := new(big.Int).SetBytes(sig[1:33])
+	s := new(big.Int).SetBytes(sig[33:])
+	if r.Sign() == 0 || s.Sign() == 0 || r.Cmp(params.N) >= 0 || s.Cmp(params.N) >= 0 {
+		return nil, ErrBadMessageSignature
+	}
+
+	// R is the point whose X coordinate gave r
+	x := new(big.Int).Set(r)
+	if recID&2 != 0 {
+		x.Add(x, params.N)
+	}
+	if x.Cmp(params.P) >= 0 {
+		return nil, ErrBadMessageSignature
+	}
+	// y² = x³ - 3x + b
+	y2 := new(big.Int).Exp(x, big.NewInt(3), params.P)
+	y2.Sub(y2, new(big.Int).Mul(x, big.NewInt(3)))
+	y2.Add(y2, params.B)
+	y2.Mod(y2, params.P)
+	y := new(big.Int).ModSqrt(y2, params.P)
+	if y == nil {
+		return nil, ErrBadMessageSignature
+	}
+	if y.Bit(0) != uint(recID&1) {
+		y.Sub(params.P, y)
+	}
+
+	// Q = r⁻¹(sR - eG)
+	hash := MessageHash(message)
+	e := new(big.Int).SetBytes(hash)
+	rInv := new(big.Int).ModInverse(r, params.N)
+	u1 := new(big.Int).Mul(e, rInv)
+	u1.Neg(u1).Mod(u1, params.N)
+	u2 := new(big.Int).Mul(s, rInv)
+	u2.Mod(u2, params.N)
+	x1, y1 := curve.ScalarBaseMult(u1.Bytes())
+	px, py := curve.ScalarMult(x, y, u2.Bytes())
+	qx, qy := curve.Add(x1, y1, px, py)
+	if qx.Sign() == 0 && qy.Sign() == 0 {
+		return nil, ErrBadMessageSignature
+	}
+	pub := ecdsa.PublicKey{Curve: curve, X: qx, Y: qy}
+	if !ecdsa.Verify(&pub, hash, r, s) {
+		return nil, ErrBadMessageSignature
+	}
+	return append(qx.Bytes(), qy.Bytes()...), nil
+}
+
+// VerifyMessage reports whether sig over message was made by the key of address
+func VerifyMessage(address string, sig []byte, message string) (bool, error) {
+	if !ValidateAddress(address) || IsScriptAddress(address) {
+		return false, errors.New("not the address of a key")
+	}
+	pubKey, err := RecoverMessageKey(message, sig)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(PubKeyHash(pubKey), AddressHash(address)), nil
+}
@@ -0,0 +1,104 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestSignMessage(t *testing.T) {
+	w := MakeWallet()
+	address := string(w.Address())
+	messages := []string{"", "hello", string(bytes.Repeat([]byte{'m'}, 300))}
+	for _, message := range messages {
+		sig, err := SignMessage(w, message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sig) != MessageSignatureLength || sig[0] < 27 || sig[0] > 30 {
+			t.Fatalf("signature %x has the wrong shape", sig)
+		}
+		pubKey, err := RecoverMessageKey(message, sig)
+		if err != nil || !bytes.Equal(pubKey, w.PubKey) {
+			t.Errorf("%d byte message: recovered %x, %v, want %x", len(message), pubKey, err, w.PubKey)
+		}
+		if ok, err := VerifyMessage(address, sig, message); !ok || err != nil {
+			t.Errorf("%d byte message: VerifyMessage = %v, %v", len(message), ok, err)
+		}
+		if ok, _ := VerifyMessage(address, sig, message+"."); ok {
+			t.Errorf("%d byte message: signature verifies for another message", len(message))
+		}
+	}
+}
+
+func TestVerifyMessageRejects(t *testing.T) {
+	w := MakeWallet()
+	address := string(w.Address())
+	message := "pay 10 to the bearer"
+	sig, err := SignMessage(w, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := VerifyMessage(string(MakeWallet().Address()), sig, message); ok || err != nil {
+		t.Errorf("another address: VerifyMessage = %v, %v, want false", ok, err)
+	}
+	if _, err := VerifyMessage(string(ScriptAddress(PubKeyHash(w.PubKey))), sig, message); err == nil {
+		t.Error("script address accepted")
+	}
+	if _, err := VerifyMessage("not an address", sig, message); err == nil {
+		t.Error("invalid address accepted")
+	}
+
+	// another recovery ID recovers another key, or none
+	for header := byte(27); header <= 30; header++ {
+		if header == sig[0] {
+			continue
+		}
+		changed := append([]byte{header}, sig[1:]...)
+		if ok, _ := VerifyMessage(address, changed, message); ok {
+			t.Errorf("header %d: signature verifies", header)
+		}
+	}
+
+	malformed := map[string][]byte{
+		"header 26": append([]byte{26}, sig[1:]...),
+		"header 31": append([]byte{31}, sig[1:]...),
+		"header 0":  append([]byte{0}, sig[1:]...),
+		"short":     sig[:MessageSignatureLength-1],
+		"long":      append(append([]byte{}, sig...), 0),
+		"zero r":    append(append([]byte{sig[0]}, make([]byte, 32)...), sig[33:]...),
+		"zero s":    append(append([]byte{}, sig[:33]...), make([]byte, 32)...),
+		"r above N": append(append([]byte{sig[0]}, bytes.Repeat([]byte{0xff}, 32)...), sig[33:]...),
+		"empty":     nil,
+	}
+	for name, bad := range malformed {
+		if _, err := RecoverMessageKey(message, bad); !errors.Is(err, ErrBadMessageSignature) {
+			t.Errorf("%s: %v, want ErrBadMessageSignature", name, err)
+		}
+		if ok, _ := VerifyMessage(address, bad, message); ok {
+			t.Errorf("%s: signature verifies", name)
+		}
+	}
+
+	if _, err := SignMessage(&Wallet{PubKey: w.PubKey}, message); !errors.Is(err, ErrWalletLocked) {
+		t.Errorf("locked wallet: %v, want ErrWalletLocked", err)
+	}
+}
+
+// The hash covers the magic prefix and the message, each after its length
+func TestMessageHash(t *testing.T) {
+	data := append([]byte{byte(len(MessageMagic))}, MessageMagic...)
+	data = append(append(data, 5), "hello"...)
+	first := sha256.Sum256(data)
+	want := sha256.Sum256(first[:])
+	if got := MessageHash("hello"); !bytes.Equal(got, want[:]) {
+		t.Errorf("MessageHash = %x, want %x", got, want)
+	}
+	plain := sha256.Sum256([]byte("hello"))
+	plain = sha256.Sum256(plain[:])
+	if bytes.Equal(MessageHash("hello"), plain[:]) {
+		t.Error("message hashed without the magic prefix")
+	}
+}
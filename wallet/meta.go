@@ -0,0 +1,143 @@
+package wallet
+
+import (
+	"fmt"
+	"time"
+)
+
+// WalletFileVersion is the version of the wallet file format SaveFile writes.
+// Version 0 files, written before the version was kept, may have keys ending in a
+// newline and no metadata; LoadFile upgrades them, see upgrade
+const WalletFileVersion = 1
+
+// Purposes of a wallet address
+const (
+	PurposeReceive = "receive"
+	PurposeChange  = "change"
+)
+
+// AddressMeta is what the wallet file knows about one of its addresses beyond the key
+type AddressMeta struct {
+	Purpose string
+	Label   string
+	Note    string
+	// Created is the unix time the address was added to the file, 0 when unknown
+	Created int64
+}
+
+// meta returns the metadata of address, made up for an address that has none
+func (wf *WalletsFile) meta(address string) *AddressMeta {
+	if wf.Meta == nil {
+		wf.Meta = make(map[string]*AddressMeta)
+	}
+	meta, ok := wf.Meta[address]
+	if !ok {
+		meta = &AddressMeta{Purpose: PurposeReceive}
+		wf.Meta[address] = meta
+	}
+	return meta
+}
+
+// addMeta records the purpose and creation time of an address added to the file.
+// An address added again keeps what is known of it
+func (wf *WalletsFile) addMeta(address, purpose string) {
+	if _, ok := wf.Meta[address]; ok {
+		return
+	}
+	meta := wf.meta(address)
+	meta.Purpose = purpose
+	meta.Created = time.Now().Unix()
+}
+
+// AddressMeta returns a copy of the metadata of address
+func (wf *WalletsFile) AddressMeta(address string) AddressMeta {
+	if meta, ok := wf.Meta[address]; ok {
+		return *meta
+	}
+	return AddressMeta{Purpose: PurposeReceive}
+}
+
+// Label returns the label of address, empty when it has none
+func (wf *WalletsFile) Label(address string) string {
+	return wf.AddressMeta(address).Label
+}
+
+// SetLabel labels an address of the file, an empty label removes it
+func (wf *WalletsFile) SetLabel(address, label string) error {
+	if !wf.HasAddress(address) {
+		return fmt.Errorf("%s is not in this wallet", address)
+	}
+	wf.meta(address).Label = label
+	return nil
+}
+
+// SetNote keeps a free text note on an address of the file, an empty note removes it
+func (wf *WalletsFile) SetNote(address, note string) error {
+	if !wf.HasAddress(address) {
+		return fmt.Errorf("%s is not in this wallet", address)
+	}
+	wf.meta(address).Note = note
+	return nil
+}
+
+// HasAddress reports whether address is a key, script or watched address of the file
+func (wf *WalletsFile) HasAddress(address string) bool {
+	_, key := wf.Wallets[address]
+	_, script := wf.Scripts[address]
+	_, watched := wf.Watch[address]
+	return key || script || watched
+}
+
+// IsChange reports whether address was made to take the change of a transaction
+func (wf *WalletsFile) IsChange(address string) bool {
+	return wf.AddressMeta(address).Purpose == PurposeChange
+}
+
+// NewChangeAddress adds a fresh key to take the change of a transaction, the next change
+// key of an HD wallet file, and returns its address
+func (wf *WalletsFile) NewChangeAddress() (string, error) {
+	if wf.HD != nil {
+		return wf.NextHDAddress(ChangeBranch)
+	}
+	newWallet := MakeWallet()
+	address := string(newWallet.Address())
+	wf.Wallets[address] = newWallet
+	wf.addMeta(address, PurposeChange)
+	return address, nil
+}
+
+// upgrade brings a file read from an older version of the format to WalletFileVersion:
+// keys are stored again under the address of their public key, which drops the newline
+// early versions left at the end, and every address gets metadata. Keys of the change
+// branch of an HD wallet are marked as change
+func (wf *WalletsFile) upgrade() {
+	if wf.Version < 1 {
+		wallets := make(map[string]*Wallet)
+		for _, w := range wf.Wallets {
+			wallets[string(w.Address())] = w
+		}
+		wf.Wallets = wallets
+		for _, address := range wf.GetAllAddress() {
+			meta := wf.meta(address)
+			if w, ok := wf.Wallets[address]; ok && isChangePath(w.Path) {
+				meta.Purpose = PurposeChange
+			} else if entry, ok := wf.Watch[address]; ok && entry.Xpub != "" && isChangePath(entry.Path) {
+				meta.Purpose = PurposeChange
+			}
+		}
+	}
+	wf.Version = WalletFileVersion
+}
+
+// isChangePath reports whether an HD derivation path, full or relative to the account,
+// ends on the change branch
+func isChangePath(path string) bool {
+	var branch, index uint32
+	if _, err := fmt.Sscanf(path, HDAccountPath+"/%d/%d", &branch, &index); err == nil {
+		return branch == ChangeBranch
+	}
+	if _, err := fmt.Sscanf(path, "%d/%d", &branch, &index); err == nil {
+		return branch == ChangeBranch
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNewChangeAddress(t *testing.T) {
+	inTempDir(t)
+	wf, _ := CreateWallets("test")
+	receive := wf.AddWallet()
+	first, err := wf.NewChangeAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := wf.NewChangeAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second || first == receive {
+		t.Error("change address used twice")
+	}
+	for _, address := range []string{first, second} {
+		if _, ok := wf.Wallets[address]; !ok || !wf.IsChange(address) {
+			t.Errorf("%s is not a change key of the wallet", address)
+		}
+	}
+	if wf.IsChange(receive) {
+		t.Error("receive address marked as change")
+	}
+
+	wf.SaveFile("test")
+	reloaded, err := CreateWallets("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.IsChange(first) || reloaded.IsChange(receive) || reloaded.AddressMeta(first).Created == 0 {
+		t.Error("purpose of the addresses lost in the file")
+	}
+}
+
+// hdTestAddress returns the address of key index of branch of the account of seed
+func hdTestAddress(t *testing.T, seed []byte, branch, index uint32) string {
+	t.Helper()
+	key, err := NewMasterKey(seed).Derive(fmt.Sprintf("%s/%d/%d", HDAccountPath, branch, index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(key.Wallet().Address())
+}
+
+// An HD wallet file takes change on the keys of its change branch, in order
+func TestHDChangeAddress(t *testing.T) {
+	inTempDir(t)
+	seed := bytes.Repeat([]byte{0x2c}, 32)
+	wf, _ := CreateWallets("test")
+	if err := wf.SetSeed(seed); err != nil {
+		t.Fatal(err)
+	}
+	for index := uint32(0); index < 2; index++ {
+		address, err := wf.NewChangeAddress()
+		if err != nil || address != hdTestAddress(t, seed, ChangeBranch, index) {
+			t.Fatalf("change address %d is %s, %v", index, address, err)
+		}
+		if !wf.IsChange(address) || !strings.HasSuffix(wf.Wallets[address].Path, fmt.Sprintf("/1/%d", index)) {
+			t.Errorf("change address %d has purpose %s and path %s", index, wf.AddressMeta(address).Purpose, wf.Wallets[address].Path)
+		}
+	}
+	receive := wf.AddWallet()
+	if receive != hdTestAddress(t, seed, ReceiveBranch, 0) || wf.IsChange(receive) {
+		t.Errorf("receive address %s after change", receive)
+	}
+	if wf.HD.Next != [2]uint32{1, 2} {
+		t.Errorf("next indexes %v, want [1 2]", wf.HD.Next)
+	}
+
+	// change taken by a node watching the account is found ahead and marked as change
+	ahead := hdTestAddress(t, seed, ChangeBranch, 4)
+	if found, err := wf.LookAheadHD(ahead); !found || err != nil {
+		t.Fatalf("LookAheadHD = %v, %v", found, err)
+	}
+	for index := uint32(2); index <= 4; index++ {
+		if address := hdTestAddress(t, seed, ChangeBranch, index); !wf.IsChange(address) {
+			t.Errorf("change key %d not marked as change", index)
+		}
+	}
+
+	if err := wf.Encrypt("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	wf.SaveFile("test")
+	locked, err := CreateWallets("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := locked.NewChangeAddress(); !errors.Is(err, ErrWalletLocked) {
+		t.Errorf("locked HD wallet: %v, want ErrWalletLocked", err)
+	}
+}
@@ -0,0 +1,96 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"errors"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// english is the BIP39 English word list
+//go:embed english.txt
+var english string
+
+var (
+	wordList  = strings.Fields(english)
+	wordIndex = func() map[string]int {
+		index := make(map[string]int, len(wordList))
+		for i, word := range wordList {
+			index[word] = i
+		}
+		return index
+	}()
+)
+
+// MnemonicEntropy is the entropy of new mnemonics in bytes, 24 words
+const MnemonicEntropy = 32
+
+var ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+// NewMnemonic returns a BIP39 mnemonic of fresh random entropy
+func NewMnemonic() string {
+	entropy := make([]byte, MnemonicEntropy)
+	_, err := rand.Read(entropy)
+	HandleErr(err)
+	return EntropyToMnemonic(entropy)
+}
+
+// EntropyToMnemonic encodes 16 to 32 bytes of entropy, a multiple of 4, as words:
+// the entropy followed by the first len*8/32 bits of its SHA-256, 11 bits a word
+func EntropyToMnemonic(entropy []byte) string {
+	checksumBits := len(entropy) * 8 / 32
+	hash := sha256.Sum256(entropy)
+	bits := new(big.Int).SetBytes(entropy)
+	bits.Lsh(bits, uint(checksumBits))
+	bits.Or(bits, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	words := make([]string, (len(entropy)*8+checksumBits)/11)
+	mask := big.NewInt(2047)
+	for i := len(words) - 1; i >= 0; i-- {
+		words[i] = wordList[new(big.Int).And(bits, mask).Int64()]
+		bits.Rsh(bits, 11)
+	}
+	return strings.Join(words, " ")
+}
+
+// MnemonicToEntropy decodes a mnemonic, checking its words and checksum
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, ErrInvalidMnemonic
+	}
+	bits := new(big.Int)
+	for _, word := range words {
+		index, ok := wordIndex[strings.ToLower(word)]
+		if !ok {
+			return nil, ErrInvalidMnemonic
+		}
+		bits.Lsh(bits, 11)
+		bits.Or(bits, big.NewInt(int64(index)))
+	}
+	checksumBits := len(words) * 11 / 33
+	checksum := byte(new(big.Int).And(bits, big.NewInt(int64(1)<<checksumBits-1)).Int64())
+	bits.Rsh(bits, uint(checksumBits))
+	entropy := make([]byte, checksumBits*4)
+	bits.FillBytes(entropy)
+	hash := sha256.Sum256(entropy)
+	if hash[0]>>(8-checksumBits) != checksum {
+		return nil, ErrInvalidMnemonic
+	}
+	return entropy, nil
+}
+
+// MnemonicSeed is the BIP39 seed of a mnemonic:
+// PBKDF2-HMAC-SHA512(words, "mnemonic" + passphrase, 2048 rounds, 64 bytes)
+func MnemonicSeed(mnemonic, passphrase string) ([]byte, error) {
+	if _, err := MnemonicToEntropy(mnemonic); err != nil {
+		return nil, err
+	}
+	normalized := strings.ToLower(strings.Join(strings.Fields(mnemonic), " "))
+	return pbkdf2.Key([]byte(normalized), []byte("mnemonic"+passphrase), 2048, 64, sha512.New), nil
+}
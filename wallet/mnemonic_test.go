@@ -0,0 +1,94 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// English vectors of BIP39, their seeds derived with the passphrase TREZOR
+var mnemonicVectors = []struct {
+	entropy, mnemonic, seed string
+}{
+	{"00000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"},
+	{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		"legal winner thank year wave sausage worth useful legal winner thank yellow",
+		"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607"},
+	{"80808080808080808080808080808080",
+		"letter advice cage absurd amount doctor acoustic avoid letter advice cage above",
+		"d71de856f81a8acc65e6fc851a38d4d7ec216fd0796d0a6827a3ad6ed5511a30fa280f12eb2e47ed2ac03b5c462a0358d18d69fe4f985ec81778c1b370b652a8"},
+	{"ffffffffffffffffffffffffffffffff",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+		"ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069"},
+	{"000000000000000000000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon agent",
+		"035895f2f481b1b0f01fcf8c289c794660b289981a78f8106447707fdd9666ca06da5a9a565181599b79f53b844d8a71dd9f439c52a3d7b3e8a79c906ac845fa"},
+	{"0000000000000000000000000000000000000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art",
+		"bda85446c68413707090a52022edd26a1c9462295029f2e60cd7c4f2bbd3097170af7a4d73245cafa9c3cca8d561a7c3de6f5d4a10be8ed2a5e608d68f92fcc8"},
+	{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		"legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth title",
+		"bc09fca1804f7e69da93c2f2028eb238c227f2e9dda30cd63699232578480a4021b146ad717fbb7e451ce9eb835f43620bf5c514db0f8add49f5d121449d3e87"},
+	{"9e885d952ad362caeb4efe34a8e91bd2",
+		"ozone drill grab fiber curtain grace pudding thank cruise elder eight picnic",
+		"274ddc525802f7c828d8ef7ddbcdc5304e87ac3535913611fbbfa986d0c9e5476c91689f9c8a54fd55bd38606aa6a8595ad213d4c9c9f9aca3fb217069a41028"},
+	{"68a79eaca2324873eacc50cb9c6eca8cc68ea5d936f98787c60c7ebc74e6ce7c",
+		"hamster diagram private dutch cause delay private meat slide toddler razor book happy fancy gospel tennis maple dilemma loan word shrug inflict delay length",
+		"64c87cde7e12ecf6704ab95bb1408bef047c22db4cc7491c4271d170a1b213d20b385bc1588d9c7b38f1b39d415665b8a9030c9ec653d75e65f847d8fc1fc440"},
+}
+
+func TestMnemonicVectors(t *testing.T) {
+	for _, vector := range mnemonicVectors {
+		entropy, _ := hex.DecodeString(vector.entropy)
+		if got := EntropyToMnemonic(entropy); got != vector.mnemonic {
+			t.Errorf("EntropyToMnemonic(%s) = %q, want %q", vector.entropy, got, vector.mnemonic)
+		}
+		decoded, err := MnemonicToEntropy(vector.mnemonic)
+		if err != nil || !bytes.Equal(decoded, entropy) {
+			t.Errorf("MnemonicToEntropy(%q) = %x, %v, want %s", vector.mnemonic, decoded, err, vector.entropy)
+		}
+		seed, err := MnemonicSeed(vector.mnemonic, "TREZOR")
+		if err != nil || hex.EncodeToString(seed) != vector.seed {
+			t.Errorf("seed of %q = %x, %v, want %s", vector.mnemonic, seed, err, vector.seed)
+		}
+	}
+}
+
+// The passphrase is part of the seed, and the words are read whatever their case and spacing
+func TestMnemonicSeedPassphrase(t *testing.T) {
+	mnemonic := mnemonicVectors[0].mnemonic
+	withTrezor, _ := MnemonicSeed(mnemonic, "TREZOR")
+	withOther, _ := MnemonicSeed(mnemonic, "trezor")
+	without, _ := MnemonicSeed(mnemonic, "")
+	if bytes.Equal(withTrezor, withOther) || bytes.Equal(withTrezor, without) || bytes.Equal(withOther, without) {
+		t.Error("different passphrases derive the same seed")
+	}
+	spaced, err := MnemonicSeed("  "+strings.ToUpper(strings.ReplaceAll(mnemonic, " ", "\t ")), "TREZOR")
+	if err != nil || !bytes.Equal(spaced, withTrezor) {
+		t.Errorf("seed of the respaced mnemonic = %x, %v", spaced, err)
+	}
+}
+
+func TestInvalidMnemonics(t *testing.T) {
+	for name, mnemonic := range map[string]string{
+		"bad checksum":    "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"bad checksum 24": strings.Repeat("zoo ", 23) + "zoo",
+		"swapped words":   "legal winner thank year wave sausage worth useful legal winner yellow thank",
+		"unknown word":    "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abuot",
+		"11 words":        "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		"13 words":        "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		"27 words":        strings.Repeat("abandon ", 26) + "about",
+		"empty":           "",
+	} {
+		if _, err := MnemonicToEntropy(mnemonic); !errors.Is(err, ErrInvalidMnemonic) {
+			t.Errorf("%s: MnemonicToEntropy = %v, want ErrInvalidMnemonic", name, err)
+		}
+		if _, err := MnemonicSeed(mnemonic, ""); !errors.Is(err, ErrInvalidMnemonic) {
+			t.Errorf("%s: MnemonicSeed = %v, want ErrInvalidMnemonic", name, err)
+		}
+	}
+}
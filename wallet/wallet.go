@@ -5,6 +5,8 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/gob"
+	"math/big"
 	// "fmt"
 	"golang.org/x/crypto/ripemd160"
 	"bytes"
@@ -14,14 +16,61 @@ const (
 	CheckSumLength = 4
 	// Hex rep of zero 0x00
 	version = byte(0x00)
+	// Version byte of addresses locked to the hash of a redeem script (multisig)
+	ScriptVersion = byte(0x05)
 )
 
 type Wallet struct {
 	PrivKey ecdsa.PrivateKey
 	PubKey  []byte
+	// EncryptedKey is the private key sealed with the key of an encrypted wallet
+	// file. Only it is stored for such files
+	EncryptedKey []byte
+	// Path is the derivation path of a key of an HD wallet file
+	Path string
 }
 
 
+// walletData is what a Wallet looks like in the wallet file. ecdsa.PrivateKey
+// holds its curve as an interface gob cannot encode, so only the scalar is kept
+type walletData struct {
+	D            []byte
+	PubKey       []byte
+	EncryptedKey []byte
+	Path         string
+}
+
+func (wallet Wallet) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	data := walletData{PubKey: wallet.PubKey, EncryptedKey: wallet.EncryptedKey, Path: wallet.Path}
+	if len(wallet.EncryptedKey) == 0 {
+		data.D = wallet.PrivKey.D.Bytes()
+	}
+	err := gob.NewEncoder(&buf).Encode(data)
+	return buf.Bytes(), err
+}
+
+func (wallet *Wallet) GobDecode(content []byte) error {
+	var data walletData
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&data); err != nil {
+		return err
+	}
+	wallet.PubKey = data.PubKey
+	wallet.EncryptedKey = data.EncryptedKey
+	wallet.Path = data.Path
+	if len(data.EncryptedKey) > 0 {
+		// locked until the wallet file is unlocked
+		wallet.PrivKey = ecdsa.PrivateKey{}
+		return nil
+	}
+	curve := elliptic.P256()
+	privKey := ecdsa.PrivateKey{D: new(big.Int).SetBytes(data.D)}
+	privKey.PublicKey.Curve = curve
+	privKey.PublicKey.X, privKey.PublicKey.Y = curve.ScalarBaseMult(data.D)
+	wallet.PrivKey = privKey
+	return nil
+}
+
 func NewKeyPair() (ecdsa.PrivateKey, []byte) {
 	curve := elliptic.P256()
 	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
@@ -33,7 +82,7 @@ func NewKeyPair() (ecdsa.PrivateKey, []byte) {
 func MakeWallet() *Wallet {
 	sk, pk := NewKeyPair()
 	// JBOK - Just a Bunch of Keys
-	wallet := &Wallet{sk, pk}
+	wallet := &Wallet{PrivKey: sk, PubKey: pk}
 	return wallet
 }
 
@@ -56,7 +105,21 @@ func CheckSum(payload []byte) []byte {
 
 func (wallet Wallet) Address() []byte {
 	pubHash := PubKeyHash(wallet.PubKey)
-	versionedHash := append([]byte{version}, pubHash...)
+	return encodeAddress(version, pubHash)
+}
+
+// PubKeyHashAddress returns the address of funds locked to a public key hash
+func PubKeyHashAddress(pubKeyHash []byte) []byte {
+	return encodeAddress(version, pubKeyHash)
+}
+
+// ScriptAddress returns the address of funds locked to a redeem script hash
+func ScriptAddress(scriptHash []byte) []byte {
+	return encodeAddress(ScriptVersion, scriptHash)
+}
+
+func encodeAddress(version byte, hash []byte) []byte {
+	versionedHash := append([]byte{version}, hash...)
 	checksum := CheckSum(versionedHash)
 
 	fullHash := append(versionedHash, checksum...)
@@ -70,8 +133,23 @@ func (wallet Wallet) Address() []byte {
 	return address
 }
 
+// AddressHash strips the version byte and checksum off an address
+func AddressHash(address string) []byte {
+	pubKeyHash := Base58Decode([]byte(address))
+	return pubKeyHash[1 : len(pubKeyHash)-CheckSumLength]
+}
+
+// IsScriptAddress reports whether the address is locked to a redeem script
+func IsScriptAddress(address string) bool {
+	decoded := Base58Decode([]byte(address))
+	return len(decoded) > 0 && decoded[0] == ScriptVersion
+}
+
 func  ValidateAddress(address string) bool{
 	pubKeyHash := Base58Decode([]byte(address))
+	if len(pubKeyHash) <= CheckSumLength{
+		return false
+	}
 	diff := len(pubKeyHash) - CheckSumLength
 	version := pubKeyHash[0]
 	actualChecksum := pubKeyHash[diff:]
@@ -2,7 +2,6 @@ package wallet
 
 import (
 	"bytes"
-	"crypto/elliptic"
 	"encoding/gob"
 	"fmt"
 	"io/ioutil"
@@ -14,24 +13,68 @@ const walletFile = "./tmp/wallets_%s.data"
 
  
 type WalletsFile struct{
+	// Version is the format version the file was read in, see WalletFileVersion
+	Version int
 	Wallets map[string]*Wallet
+	// Redeem scripts of multisig addresses, keyed by their script address
+	Scripts map[string][]byte
+	// Crypt is set once the private keys are encrypted, see Encrypt
+	Crypt *WalletCrypt
+	// HD is set for wallet files whose new keys are derived from a seed
+	HD *HDChain
+	// Watch holds watch-only addresses, Xpubs the extended public keys they may come from
+	Watch map[string]*WatchEntry
+	Xpubs map[string]*WatchedXpub
+	// Meta holds what is known of an address beyond its key, see AddressMeta
+	Meta map[string]*AddressMeta
+
+	// key decrypts the private keys of an encrypted, unlocked file
+	key []byte
 }
 
 //  
 
+// SaveFile writes the wallet file, readable only by its owner. Keys added to an
+// encrypted file are encrypted first, which needs it unlocked
 func (wf *WalletsFile) SaveFile(nodeId string) {
 	var buf bytes.Buffer
 	walletFile := fmt.Sprintf(walletFile, nodeId)
-	gob.Register(elliptic.P256())
-
+	if wf.IsEncrypted() {
+		for _, w := range wf.Wallets {
+			if len(w.EncryptedKey) > 0 {
+				continue
+			}
+			if wf.key == nil {
+				HandleErr(ErrWalletLocked)
+			}
+			HandleErr(w.encryptKey(wf.key))
+		}
+	}
+	saved := *wf
+	saved.Version = WalletFileVersion
+	if wf.HD != nil && wf.IsEncrypted() {
+		if len(wf.HD.EncryptedSeed) == 0 {
+			if wf.key == nil {
+				HandleErr(ErrWalletLocked)
+			}
+			HandleErr(wf.HD.encryptSeed(wf.key))
+		}
+		hd := *wf.HD
+		hd.Seed = nil
+		saved.HD = &hd
+	}
 	encoder := gob.NewEncoder(&buf)
-	err := encoder.Encode(wf)
+	err := encoder.Encode(&saved)
+	HandleErr(err)
+	err = ioutil.WriteFile(walletFile, buf.Bytes(), 0600)
 	HandleErr(err)
-	err = ioutil.WriteFile(walletFile, buf.Bytes(), 0644)
+	// WriteFile keeps the mode of a file written by older versions
+	err = os.Chmod(walletFile, 0600)
 	HandleErr(err)
 
 }
 
+// LoadFile reads the wallet file, upgrading one written in an older format in place
 func (wf *WalletsFile) LoadFile(nodeId string) error{
 	var wallet WalletsFile
 	walletFile := fmt.Sprintf(walletFile, nodeId)
@@ -40,17 +83,60 @@ func (wf *WalletsFile) LoadFile(nodeId string) error{
 	}
 	content , err := ioutil.ReadFile(walletFile)
 	HandleErr(err)
-	gob.Register(elliptic.P256())
+	// the version tells how to decode the rest. Decoding only it fails for version 0
+	// files, which have no field in common with the probe; a damaged file fails below
+	var probe struct{ Version int }
+	if err = gob.NewDecoder(bytes.NewReader(content)).Decode(&probe); err != nil {
+		probe.Version = 0
+	}
+	if probe.Version > WalletFileVersion {
+		HandleErr(fmt.Errorf("wallet file version %d is newer than this program supports", probe.Version))
+	}
 	decoder := gob.NewDecoder(bytes.NewReader(content))
-	err = decoder.Decode(&wallet)
-	HandleErr(err)
+	if err = decoder.Decode(&wallet); err != nil {
+		if probe.Version != 0 {
+			HandleErr(err)
+		}
+		// version 0 files may predate the encoding of Wallet
+		legacy, legacyErr := decodeLegacyFile(content)
+		if legacyErr != nil {
+			HandleErr(err)
+		}
+		wallet = *legacy
+	}
+	wf.Version = wallet.Version
 	wf.Wallets = wallet.Wallets
+	if wallet.Scripts != nil{
+		wf.Scripts = wallet.Scripts
+	}
+	wf.Crypt = wallet.Crypt
+	wf.HD = wallet.HD
+	if wallet.Watch != nil {
+		wf.Watch = wallet.Watch
+	}
+	if wallet.Xpubs != nil {
+		wf.Xpubs = wallet.Xpubs
+	}
+	if wallet.Meta != nil {
+		wf.Meta = wallet.Meta
+	}
+	if wf.Version < WalletFileVersion {
+		wf.upgrade()
+		wf.SaveFile(nodeId)
+	}
+	if wf.IsEncrypted() {
+		wf.loadUnlock(nodeId)
+	}
 	return nil
 }
 
 func CreateWallets(nodeId string) (*WalletsFile , error){
 	wallets := WalletsFile{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.Scripts = make(map[string][]byte)
+	wallets.Watch = make(map[string]*WatchEntry)
+	wallets.Xpubs = make(map[string]*WatchedXpub)
+	wallets.Meta = make(map[string]*AddressMeta)
 
 	err := wallets.LoadFile(nodeId)
 	return &wallets, err
@@ -65,13 +151,37 @@ func (wf *WalletsFile) GetAllAddress() []string{
 	for address := range wf.Wallets{
 		addresses = append(addresses, address)
 	}
+	for address := range wf.Scripts{
+		addresses = append(addresses, address)
+	}
+	for address := range wf.Watch{
+		addresses = append(addresses, address)
+	}
 	return addresses
 }
 
+// AddWallet adds a fresh key, the next receive key of an HD wallet file
 func (wf *WalletsFile) AddWallet() string{
+	if wf.HD != nil {
+		address, err := wf.NextHDAddress(ReceiveBranch)
+		HandleErr(err)
+		return address
+	}
 	newWallet := MakeWallet()
-	address := fmt.Sprintf("%s\n", newWallet.Address())
+	address := string(newWallet.Address())
 	wf.Wallets[address] = newWallet
+	wf.addMeta(address, PurposeReceive)
 	return address
 }
 
+
+// AddScript stores the redeem script of a multisig address so it can be spent later
+func (wf *WalletsFile) AddScript(address string, script []byte) {
+	wf.Scripts[address] = script
+	wf.addMeta(address, PurposeReceive)
+}
+
+func (wf *WalletsFile) GetScript(address string) ([]byte, bool) {
+	script, ok := wf.Scripts[address]
+	return script, ok
+}
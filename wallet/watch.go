@@ -0,0 +1,154 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+)
+
+// WatchEntry is an address the wallet watches without a key to spend from it
+type WatchEntry struct {
+	// PubKey is empty when only the address is known
+	PubKey []byte
+	// Xpub and Path tell where a key derived from a watched extended public key comes from
+	Xpub string
+	Path string
+}
+
+// WatchedXpub holds the next index of the receive and change branches of a watched
+// extended public key
+type WatchedXpub struct {
+	Next [2]uint32
+}
+
+var ErrWatchOnly = errors.New("address is watch-only, the wallet has no key to sign with")
+
+// IsWatchOnly reports whether address is watched without a key
+func (wf *WalletsFile) IsWatchOnly(address string) bool {
+	_, ok := wf.Watch[address]
+	return ok
+}
+
+// WatchPubKey returns the public key of a watched address, if known
+func (wf *WalletsFile) WatchPubKey(address string) []byte {
+	if entry, ok := wf.Watch[address]; ok {
+		return entry.PubKey
+	}
+	return nil
+}
+
+func (wf *WalletsFile) addWatch(address string, entry *WatchEntry) error {
+	if _, ok := wf.Wallets[address]; ok {
+		return fmt.Errorf("the key for %s is already in the wallet", address)
+	}
+	if old, ok := wf.Watch[address]; ok && len(entry.PubKey) == 0 {
+		// keep what is known of an address watched before
+		entry = old
+	}
+	wf.Watch[address] = entry
+	wf.addMeta(address, PurposeReceive)
+	return nil
+}
+
+// AddWatchAddress watches address
+func (wf *WalletsFile) AddWatchAddress(address string) error {
+	if !ValidateAddress(address) {
+		return errors.New("invalid address")
+	}
+	return wf.addWatch(address, &WatchEntry{})
+}
+
+// AddWatchPubKey watches the address of pubKey, the X and Y coordinates as wallets hold them,
+// and returns it
+func (wf *WalletsFile) AddWatchPubKey(pubKey []byte) (string, error) {
+	if len(pubKey) == 0 || len(pubKey) > 64 {
+		return "", errors.New("invalid public key")
+	}
+	address := string(PubKeyHashAddress(PubKeyHash(pubKey)))
+	return address, wf.addWatch(address, &WatchEntry{PubKey: pubKey})
+}
+
+// AddWatchXpub watches the keys of an account's extended public key: its receive
+// branch /0/i and change branch /1/i, discovered as DiscoverHD does. The first
+// receive key is always watched. It returns how many keys it added
+func (wf *WalletsFile) AddWatchXpub(xpub string, used func(pubKeyHash []byte) bool) (int, error) {
+	account, err := ParseExtendedKey(xpub)
+	if err != nil {
+		return 0, err
+	}
+	if account.Private {
+		return 0, errors.New("not an extended public key")
+	}
+	watched, ok := wf.Xpubs[xpub]
+	if !ok {
+		watched = &WatchedXpub{}
+	}
+	added := 0
+	for _, branch := range []uint32{ReceiveBranch, ChangeBranch} {
+		branchKey, err := account.Child(branch)
+		if err != nil {
+			return added, err
+		}
+		next := watched.Next[branch]
+		for index, gap := next, 0; gap < GapLimit; index++ {
+			key, err := branchKey.Child(index)
+			if err != nil {
+				return added, err
+			}
+			if !used(PubKeyHash(key.WalletPubKey())) {
+				gap++
+				continue
+			}
+			for ; next <= index; next++ {
+				if _, err := wf.watchXpubKey(xpub, branchKey, branch, next); err != nil {
+					return added, err
+				}
+				added++
+			}
+			gap = 0
+		}
+		if branch == ReceiveBranch && next == 0 {
+			if _, err := wf.watchXpubKey(xpub, branchKey, branch, next); err != nil {
+				return added, err
+			}
+			added++
+			next++
+		}
+		watched.Next[branch] = next
+	}
+	wf.Xpubs[xpub] = watched
+	return added, nil
+}
+
+// NextWatchedChange watches the next change key of a watched extended public key, to take
+// the change of a spend signed by the holder of its private key, and returns its address
+func (wf *WalletsFile) NextWatchedChange(xpub string) (string, error) {
+	watched, ok := wf.Xpubs[xpub]
+	if !ok {
+		return "", errors.New("extended public key is not watched")
+	}
+	account, err := ParseExtendedKey(xpub)
+	if err != nil {
+		return "", err
+	}
+	branchKey, err := account.Child(ChangeBranch)
+	if err != nil {
+		return "", err
+	}
+	address, err := wf.watchXpubKey(xpub, branchKey, ChangeBranch, watched.Next[ChangeBranch])
+	if err != nil {
+		return "", err
+	}
+	watched.Next[ChangeBranch]++
+	return address, nil
+}
+
+func (wf *WalletsFile) watchXpubKey(xpub string, branchKey *ExtendedKey, branch, index uint32) (string, error) {
+	key, err := branchKey.Child(index)
+	if err != nil {
+		return "", err
+	}
+	entry := &WatchEntry{PubKey: key.WalletPubKey(), Xpub: xpub, Path: fmt.Sprintf("%d/%d", branch, index)}
+	address := string(PubKeyHashAddress(PubKeyHash(entry.PubKey)))
+	wf.addMeta(address, branchPurpose(branch))
+	return address, wf.addWatch(address, entry)
+}
@@ -0,0 +1,155 @@
+package wallet
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestWatchAddress(t *testing.T) {
+	inTempDir(t)
+	wf, _ := CreateWallets("test")
+	w := MakeWallet()
+	address := string(w.Address())
+
+	if err := wf.AddWatchAddress("not an address"); err == nil {
+		t.Error("invalid address watched")
+	}
+	if err := wf.AddWatchAddress(address); err != nil {
+		t.Fatal(err)
+	}
+	if !wf.IsWatchOnly(address) || !wf.HasAddress(address) || wf.WatchPubKey(address) != nil {
+		t.Error("address not watched without a key")
+	}
+
+	// the key learned later is kept when the address is watched again
+	if got, err := wf.AddWatchPubKey(w.PubKey); err != nil || got != address {
+		t.Fatalf("AddWatchPubKey = %s, %v, want %s", got, err, address)
+	}
+	if err := wf.AddWatchAddress(address); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(wf.WatchPubKey(address), w.PubKey) {
+		t.Error("public key of a watched address lost")
+	}
+	for _, pubKey := range [][]byte{nil, make([]byte, 65)} {
+		if _, err := wf.AddWatchPubKey(pubKey); err == nil {
+			t.Errorf("%d byte public key watched", len(pubKey))
+		}
+	}
+
+	owned := wf.AddWallet()
+	if err := wf.AddWatchAddress(owned); err == nil || wf.IsWatchOnly(owned) {
+		t.Error("address of a key in the wallet watched")
+	}
+
+	wf.SaveFile("test")
+	reloaded, err := CreateWallets("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.IsWatchOnly(address) || !bytes.Equal(reloaded.WatchPubKey(address), w.PubKey) {
+		t.Error("watched address lost in the file")
+	}
+}
+
+// watchTestAccount returns the account key of a seed and its extended public key
+func watchTestAccount(t *testing.T) (*ExtendedKey, string) {
+	t.Helper()
+	account, err := NewMasterKey(bytes.Repeat([]byte{0x1d}, 32)).Derive(HDAccountPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account, account.Neuter().String()
+}
+
+// accountAddress returns the address of key index of branch of account
+func accountAddress(t *testing.T, account *ExtendedKey, branch, index uint32) string {
+	t.Helper()
+	key, err := account.Derive(fmt.Sprintf("m/%d/%d", branch, index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(key.Wallet().Address())
+}
+
+// The keys of a watched extended public key are the account's up to the last used one of
+// each branch, the ones an HD wallet of the same seed derives
+func TestWatchXpub(t *testing.T) {
+	inTempDir(t)
+	wf, _ := CreateWallets("test")
+	account, xpub := watchTestAccount(t)
+	used := map[string]bool{
+		accountAddress(t, account, ReceiveBranch, 2): true,
+		accountAddress(t, account, ChangeBranch, 1):  true,
+		// past the gap limit, so not found
+		accountAddress(t, account, ReceiveBranch, 3+GapLimit): true,
+	}
+	isUsed := func(pubKeyHash []byte) bool { return used[string(PubKeyHashAddress(pubKeyHash))] }
+
+	added, err := wf.AddWatchXpub(xpub, isUsed)
+	if err != nil || added != 5 {
+		t.Fatalf("AddWatchXpub added %d keys, %v, want 5", added, err)
+	}
+	if wf.Xpubs[xpub].Next != [2]uint32{3, 2} {
+		t.Errorf("next indexes %v, want [3 2]", wf.Xpubs[xpub].Next)
+	}
+	for branch, count := range []uint32{3, 2} {
+		for index := uint32(0); index < count; index++ {
+			address := accountAddress(t, account, uint32(branch), index)
+			entry := wf.Watch[address]
+			if entry == nil || entry.Xpub != xpub || entry.Path != fmt.Sprintf("%d/%d", branch, index) {
+				t.Errorf("key %d/%d watched as %+v", branch, index, entry)
+				continue
+			}
+			if wf.IsChange(address) != (uint32(branch) == ChangeBranch) {
+				t.Errorf("key %d/%d has purpose %s", branch, index, wf.AddressMeta(address).Purpose)
+			}
+		}
+	}
+	if len(wf.Watch) != 5 {
+		t.Errorf("%d addresses watched, want 5", len(wf.Watch))
+	}
+
+	hd, _ := CreateWallets("hd")
+	if err := hd.SetSeed(bytes.Repeat([]byte{0x1d}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	if hd.HD.AccountXpub != xpub {
+		t.Error("HD wallet of the seed has another account")
+	}
+	if address, _ := hd.NextHDAddress(ReceiveBranch); !wf.IsWatchOnly(address) {
+		t.Error("first HD receive address not watched")
+	}
+
+	if added, err := wf.AddWatchXpub(xpub, isUsed); err != nil || added != 0 {
+		t.Errorf("watching again added %d keys, %v", added, err)
+	}
+	change, err := wf.NextWatchedChange(xpub)
+	if err != nil || change != accountAddress(t, account, ChangeBranch, 2) || !wf.IsChange(change) {
+		t.Errorf("NextWatchedChange = %s, %v, want change key 2", change, err)
+	}
+	if wf.Xpubs[xpub].Next[ChangeBranch] != 3 {
+		t.Errorf("next change index %d, want 3", wf.Xpubs[xpub].Next[ChangeBranch])
+	}
+}
+
+func TestWatchXpubUnused(t *testing.T) {
+	inTempDir(t)
+	wf, _ := CreateWallets("test")
+	account, xpub := watchTestAccount(t)
+	added, err := wf.AddWatchXpub(xpub, func([]byte) bool { return false })
+	if err != nil || added != 1 || !wf.IsWatchOnly(accountAddress(t, account, ReceiveBranch, 0)) {
+		t.Errorf("unused account: added %d keys, %v, want the first receive key", added, err)
+	}
+
+	if _, err := wf.AddWatchXpub(account.String(), func([]byte) bool { return false }); err == nil {
+		t.Error("extended private key watched")
+	}
+	if _, err := wf.AddWatchXpub("xpub", func([]byte) bool { return false }); err == nil {
+		t.Error("invalid extended key watched")
+	}
+	if _, err := wf.NextWatchedChange(NewMasterKey(make([]byte, 32)).Neuter().String()); err == nil {
+		t.Error("change taken for an extended public key not watched")
+	}
+}
@@ -0,0 +1,61 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// PrivKeyVersion is the version byte of exported private keys
+const PrivKeyVersion = byte(0x80)
+
+var ErrInvalidPrivKey = errors.New("invalid private key encoding")
+
+// EncodePrivKey exports the private key of wallet: the version byte and the 32 byte
+// scalar, base58 encoded with a 4 byte checksum as addresses are
+func EncodePrivKey(wallet *Wallet) (string, error) {
+	if wallet.Locked() {
+		return "", ErrWalletLocked
+	}
+	payload := make([]byte, 33)
+	payload[0] = PrivKeyVersion
+	wallet.PrivKey.D.FillBytes(payload[1:])
+	return string(Base58Encode(append(payload, CheckSum(payload)...))), nil
+}
+
+// DecodePrivKey reads a key written by EncodePrivKey
+func DecodePrivKey(encoded string) (*Wallet, error) {
+	data := Base58Decode([]byte(encoded))
+	if len(data) != 33+CheckSumLength || data[0] != PrivKeyVersion {
+		return nil, ErrInvalidPrivKey
+	}
+	if !bytes.Equal(CheckSum(data[:33]), data[33:]) {
+		return nil, ErrInvalidPrivKey
+	}
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(data[1:33])
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, ErrInvalidPrivKey
+	}
+	privKey := ecdsa.PrivateKey{D: d}
+	privKey.PublicKey.Curve = curve
+	privKey.PublicKey.X, privKey.PublicKey.Y = curve.ScalarBaseMult(data[1:33])
+	pubKey := append(privKey.X.Bytes(), privKey.Y.Bytes()...)
+	return &Wallet{PrivKey: privKey, PubKey: pubKey}, nil
+}
+
+// ImportWallet adds a key to the wallet file and returns its address. A watch-only
+// entry for the address becomes spendable
+func (wf *WalletsFile) ImportWallet(w *Wallet) (string, error) {
+	address := string(w.Address())
+	if _, ok := wf.Wallets[address]; ok {
+		return address, fmt.Errorf("the key for %s is already in the wallet", address)
+	}
+	delete(wf.Watch, address)
+	wf.Wallets[address] = w
+	wf.addMeta(address, PurposeReceive)
+	return address, nil
+}
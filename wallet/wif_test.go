@@ -0,0 +1,81 @@
+package wallet
+
+import (
+	"crypto/elliptic"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// encodeKeyPayload base58 encodes a version byte and key data with their checksum
+func encodeKeyPayload(version byte, key []byte) string {
+	payload := append([]byte{version}, key...)
+	return string(Base58Encode(append(payload, CheckSum(payload)...)))
+}
+
+func TestPrivKeyRoundTrip(t *testing.T) {
+	w := MakeWallet()
+	encoded, err := EncodePrivKey(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodePrivKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.PrivKey.D.Cmp(w.PrivKey.D) != 0 || string(decoded.Address()) != string(w.Address()) {
+		t.Errorf("%s decoded to another key", encoded)
+	}
+
+	// the scalar 1, whose public key is the generator
+	one, err := DecodePrivKey("5HpHagT65TZzG1PH3CSu63k8DbpvD8s5ip4nEB3kEsreAnchuDf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	generator := "6b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c296" +
+		"4fe342e2fe1a7f9b8ee7eb4a7c0f9e162bce33576b315ececbb6406837bf51f5"
+	if one.PrivKey.D.Int64() != 1 || hex.EncodeToString(one.PubKey) != generator {
+		t.Errorf("key 1 decoded to %d with public key %x", one.PrivKey.D, one.PubKey)
+	}
+	if encoded, _ := EncodePrivKey(one); encoded != "5HpHagT65TZzG1PH3CSu63k8DbpvD8s5ip4nEB3kEsreAnchuDf" {
+		t.Errorf("key 1 encoded as %s", encoded)
+	}
+
+	if _, err := EncodePrivKey(&Wallet{PubKey: w.PubKey}); !errors.Is(err, ErrWalletLocked) {
+		t.Errorf("locked wallet: %v, want ErrWalletLocked", err)
+	}
+}
+
+func TestDecodePrivKeyRejects(t *testing.T) {
+	n := elliptic.P256().Params().N
+	scalar := func(d *big.Int) []byte { return d.FillBytes(make([]byte, 32)) }
+	valid := encodeKeyPayload(PrivKeyVersion, scalar(big.NewInt(1)))
+	badChecksum := []byte(valid)
+	badChecksum[len(badChecksum)-1] = 'z'
+	if badChecksum[len(valid)-1] == valid[len(valid)-1] {
+		badChecksum[len(badChecksum)-1] = 'y'
+	}
+
+	tests := map[string]string{
+		"bad checksum":    string(badChecksum),
+		"address version": encodeKeyPayload(0x00, scalar(big.NewInt(1))),
+		"testnet version": encodeKeyPayload(0xef, scalar(big.NewInt(1))),
+		"compressed flag": encodeKeyPayload(PrivKeyVersion, append(scalar(big.NewInt(1)), 0x01)),
+		"short key":       encodeKeyPayload(PrivKeyVersion, scalar(big.NewInt(1))[1:]),
+		"zero scalar":     encodeKeyPayload(PrivKeyVersion, scalar(big.NewInt(0))),
+		"order":           encodeKeyPayload(PrivKeyVersion, scalar(n)),
+		"above the order": encodeKeyPayload(PrivKeyVersion, scalar(new(big.Int).Add(n, big.NewInt(1)))),
+		"address":         string(MakeWallet().Address()),
+		"empty":           "",
+	}
+	for name, encoded := range tests {
+		if _, err := DecodePrivKey(encoded); !errors.Is(err, ErrInvalidPrivKey) {
+			t.Errorf("%s: %v, want ErrInvalidPrivKey", name, err)
+		}
+	}
+	maxKey := encodeKeyPayload(PrivKeyVersion, scalar(new(big.Int).Sub(n, big.NewInt(1))))
+	if _, err := DecodePrivKey(maxKey); err != nil {
+		t.Errorf("largest scalar rejected: %v", err)
+	}
+}